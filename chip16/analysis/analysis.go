@@ -0,0 +1,336 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Control-flow related operations
+const (
+	opJMP     = 0x10 // JMP HHLL
+	opJMC     = 0x11 // JMC HHLL
+	opJx      = 0x12 // Jx HHLL
+	opJME     = 0x13 // JME Rx, Ry, HHLL
+	opCALL    = 0x14 // CALL HHLL
+	opRET     = 0x15 // RET
+	opJMPRx   = 0x16 // JMP Rx
+	opCx      = 0x17 // Cx HHLL
+	opCALLRx  = 0x18 // CALL Rx
+	instrSize = 4
+)
+
+// Block is a basic block: a straight sequence of instructions with a single
+// entry point, which only branches at its end.
+type Block struct {
+	// Start is the address of the first instruction of the block.
+	Start vm.Pointer
+
+	// End is the address right after the last instruction of the block.
+	End vm.Pointer
+
+	// Succs are the addresses of the blocks control can flow to.
+	Succs []vm.Pointer
+
+	// Preds are the addresses of the blocks control can flow from.
+	Preds []vm.Pointer
+
+	// Calls are the targets of the direct calls made from this block.
+	Calls []vm.Pointer
+
+	// Indirect is true if the block ends with a JMP Rx.
+	Indirect bool
+}
+
+// Function is a set of blocks reachable from a call target (or the entry
+// point) without following calls.
+type Function struct {
+	// Entry is the address of the function.
+	Entry vm.Pointer
+
+	// Blocks are the start addresses of the function's blocks, sorted.
+	Blocks []vm.Pointer
+
+	// Callees are the targets of the direct calls made by the function, sorted.
+	Callees []vm.Pointer
+}
+
+// Program is the result of the static analysis of a ROM.
+type Program struct {
+	// Entry is the address where the analysis started.
+	Entry vm.Pointer
+
+	// Blocks maps start addresses to basic blocks.
+	Blocks map[vm.Pointer]*Block
+
+	// Functions maps entry addresses to functions.
+	Functions map[vm.Pointer]*Function
+
+	// Indirect lists the addresses of the JMP Rx and CALL Rx instructions,
+	// whose targets can only be resolved at runtime (see Resolve).
+	Indirect []vm.Pointer
+
+	// Invalid lists the addresses of the unknown opcodes reached by the
+	// analysis.
+	Invalid []vm.Pointer
+
+	mem      []byte
+	code     []bool // code[addr] is true if addr starts an instruction
+	covered  []bool // covered[addr] is true if addr belongs to an instruction
+	leaders  map[vm.Pointer]bool
+	entries  map[vm.Pointer]bool
+	resolved map[vm.Pointer][]vm.Pointer
+}
+
+// Analyze walks the program in mem from the entry point, following the
+// control flow to tell code from data and build the program's CFG and call
+// graph.
+func Analyze(mem []byte, entry vm.Pointer) *Program {
+	p := &Program{
+		Entry:    entry,
+		mem:      mem,
+		code:     make([]bool, vm.MemSize),
+		covered:  make([]bool, vm.MemSize),
+		leaders:  map[vm.Pointer]bool{entry: true},
+		entries:  map[vm.Pointer]bool{entry: true},
+		resolved: make(map[vm.Pointer][]vm.Pointer),
+	}
+	p.explore(entry)
+	p.build()
+	return p
+}
+
+// Resolve records target as a runtime destination of the indirect jump or
+// call at site, and extends the analysis accordingly. Sites that don't hold
+// a JMP Rx or CALL Rx reached by the analysis are ignored.
+func (p *Program) Resolve(site, target vm.Pointer) {
+	if !p.code[site] {
+		return
+	}
+	op := p.opcodeAt(site).Op()
+	if op != opJMPRx && op != opCALLRx {
+		return
+	}
+	for _, t := range p.resolved[site] {
+		if t == target {
+			return
+		}
+	}
+	p.resolved[site] = append(p.resolved[site], target)
+	p.leaders[target] = true
+	if op == opCALLRx {
+		p.entries[target] = true
+	}
+	p.explore(target)
+	p.build()
+}
+
+// IsCode tells whether addr belongs to an instruction reached by the analysis.
+func (p *Program) IsCode(addr vm.Pointer) bool {
+	return p.covered[addr]
+}
+
+// IsInstruction tells whether an instruction reached by the analysis starts
+// at addr.
+func (p *Program) IsInstruction(addr vm.Pointer) bool {
+	return p.code[addr]
+}
+
+// BlockAt returns the block containing addr, or nil if addr isn't code.
+func (p *Program) BlockAt(addr vm.Pointer) *Block {
+	for _, b := range p.Blocks {
+		if addr >= b.Start && addr < b.End {
+			return b
+		}
+	}
+	return nil
+}
+
+// SortedBlocks returns the program's blocks sorted by address.
+func (p *Program) SortedBlocks() []*Block {
+	blocks := make([]*Block, 0, len(p.Blocks))
+	for _, b := range p.Blocks {
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Start < blocks[j].Start
+	})
+	return blocks
+}
+
+func (p *Program) opcodeAt(addr vm.Pointer) vm.Opcode {
+	return vm.ReadOpcode(p.mem[addr:])
+}
+
+// valid tells whether an instruction fits in memory at addr
+func (p *Program) valid(addr vm.Pointer) bool {
+	return int(addr)+instrSize <= len(p.mem) && addr < vm.StackStart
+}
+
+// explore decodes every instruction reachable from start
+func (p *Program) explore(start vm.Pointer) {
+	work := []vm.Pointer{start}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for p.valid(addr) && !p.code[addr] {
+			o := p.opcodeAt(addr)
+			if !cpu.Known(o.Op()) {
+				p.Invalid = appendUnique(p.Invalid, addr)
+				break
+			}
+			p.code[addr] = true
+			for i := vm.Pointer(0); i < instrSize; i++ {
+				p.covered[addr+i] = true
+			}
+			next := addr + instrSize
+			target := vm.Pointer(o.HHLL())
+
+			switch o.Op() {
+			case opJMP:
+				p.leaders[target] = true
+				work = append(work, target)
+				next = addr // stop here
+
+			case opJMC, opJx, opJME:
+				p.leaders[target] = true
+				p.leaders[next] = true
+				work = append(work, target)
+
+			case opCALL, opCx:
+				p.leaders[target] = true
+				p.entries[target] = true
+				work = append(work, target)
+
+			case opRET:
+				next = addr
+
+			case opJMPRx:
+				p.Indirect = appendUnique(p.Indirect, addr)
+				for _, t := range p.resolved[addr] {
+					work = append(work, t)
+				}
+				next = addr
+
+			case opCALLRx:
+				p.Indirect = appendUnique(p.Indirect, addr)
+			}
+
+			if next == addr {
+				break
+			}
+			addr = next
+		}
+	}
+}
+
+// build splits decoded instructions into blocks and functions
+func (p *Program) build() {
+	p.Blocks = make(map[vm.Pointer]*Block)
+
+	for leader := range p.leaders {
+		if !p.valid(leader) || !p.code[leader] {
+			continue
+		}
+		b := &Block{Start: leader}
+		addr := leader
+		for {
+			o := p.opcodeAt(addr)
+			next := addr + instrSize
+			target := vm.Pointer(o.HHLL())
+			done := true
+
+			switch o.Op() {
+			case opJMP:
+				b.Succs = append(b.Succs, target)
+			case opJMC, opJx, opJME:
+				b.Succs = append(b.Succs, target, next)
+			case opRET:
+			case opJMPRx:
+				b.Indirect = true
+				b.Succs = append(b.Succs, p.resolved[addr]...)
+			case opCALL, opCx:
+				b.Calls = appendUnique(b.Calls, target)
+				done = false
+			case opCALLRx:
+				for _, t := range p.resolved[addr] {
+					b.Calls = appendUnique(b.Calls, t)
+				}
+				done = false
+			default:
+				done = false
+			}
+
+			if !done && (!p.valid(next) || !p.code[next]) {
+				// Falls through to data or out of memory
+				done = true
+			} else if !done && p.leaders[next] {
+				b.Succs = append(b.Succs, next)
+				done = true
+			}
+			if done {
+				b.End = next
+				break
+			}
+			addr = next
+		}
+		p.Blocks[leader] = b
+	}
+
+	for _, b := range p.Blocks {
+		for _, s := range b.Succs {
+			if succ, ok := p.Blocks[s]; ok {
+				succ.Preds = appendUnique(succ.Preds, b.Start)
+			}
+		}
+	}
+	for _, b := range p.Blocks {
+		sortPointers(b.Preds)
+	}
+
+	p.Functions = make(map[vm.Pointer]*Function)
+	for entry := range p.entries {
+		if _, ok := p.Blocks[entry]; ok {
+			p.Functions[entry] = p.function(entry)
+		}
+	}
+}
+
+// function gathers the blocks reachable from entry without following calls
+func (p *Program) function(entry vm.Pointer) *Function {
+	f := &Function{Entry: entry}
+	seen := map[vm.Pointer]bool{entry: true}
+	work := []vm.Pointer{entry}
+	for len(work) > 0 {
+		b := p.Blocks[work[0]]
+		work = work[1:]
+		f.Blocks = append(f.Blocks, b.Start)
+		for _, c := range b.Calls {
+			f.Callees = appendUnique(f.Callees, c)
+		}
+		for _, s := range b.Succs {
+			if _, ok := p.Blocks[s]; ok && !seen[s] {
+				seen[s] = true
+				work = append(work, s)
+			}
+		}
+	}
+	sortPointers(f.Blocks)
+	sortPointers(f.Callees)
+	return f
+}
+
+func appendUnique(s []vm.Pointer, p vm.Pointer) []vm.Pointer {
+	for _, q := range s {
+		if q == p {
+			return s
+		}
+	}
+	return append(s, p)
+}
+
+func sortPointers(s []vm.Pointer) {
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+}
@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// assemble writes opcodes to a fresh memory image, starting at addr 0
+func assemble(ops ...vm.Opcode) []byte {
+	mem := make([]byte, vm.MemSize)
+	for i, o := range ops {
+		binary.BigEndian.PutUint32(mem[4*i:], uint32(o))
+	}
+	return mem
+}
+
+// testProgram is laid out as follows:
+//
+//	0x00: CALL 0x0010
+//	0x04: JMP  0x0004
+//	0x08: data
+//	0x0C: data
+//	0x10: JZ   0x0018
+//	0x14: NOP
+//	0x18: RET
+//	0x1C: data
+var testProgram = []vm.Opcode{
+	vm.Opcode(0x14000000).WithHHLL(0x0010),
+	vm.Opcode(0x10000000).WithHHLL(0x0004),
+	0xFFFFFFFF,
+	0xFFFFFFFF,
+	vm.Opcode(0x12000000).WithHHLL(0x0018),
+	0x00000000,
+	0x15000000,
+	0xFFFFFFFF,
+}
+
+func TestAnalyze(t *testing.T) {
+	a := assert.New(t)
+	p := Analyze(assemble(testProgram...), 0)
+
+	for _, addr := range []vm.Pointer{0x00, 0x04, 0x10, 0x14, 0x18} {
+		a.Truef(p.IsInstruction(addr), "%#04x should be code", addr)
+	}
+	for _, addr := range []vm.Pointer{0x08, 0x0C, 0x1C} {
+		a.Falsef(p.IsCode(addr), "%#04x should be data", addr)
+	}
+	a.True(p.IsCode(0x05))
+	a.False(p.IsInstruction(0x05))
+	a.Empty(p.Invalid)
+	a.Empty(p.Indirect)
+
+	if a.Len(p.Blocks, 5) {
+		entry := p.Blocks[0x00]
+		a.Equal(vm.Pointer(0x04), entry.End)
+		a.Equal([]vm.Pointer{0x10}, entry.Calls)
+		a.Equal([]vm.Pointer{0x04}, entry.Succs)
+
+		loop := p.Blocks[0x04]
+		a.Equal([]vm.Pointer{0x04}, loop.Succs)
+		a.Equal([]vm.Pointer{0x00, 0x04}, loop.Preds)
+
+		a.Equal([]vm.Pointer{0x18, 0x14}, p.Blocks[0x10].Succs)
+		a.Equal([]vm.Pointer{0x18}, p.Blocks[0x14].Succs)
+		a.Equal([]vm.Pointer{0x10, 0x14}, p.Blocks[0x18].Preds)
+		a.Empty(p.Blocks[0x18].Succs)
+	}
+
+	if a.Len(p.Functions, 2) {
+		a.Equal([]vm.Pointer{0x00, 0x04}, p.Functions[0x00].Blocks)
+		a.Equal([]vm.Pointer{0x10}, p.Functions[0x00].Callees)
+		a.Equal([]vm.Pointer{0x10, 0x14, 0x18}, p.Functions[0x10].Blocks)
+		a.Empty(p.Functions[0x10].Callees)
+	}
+
+	a.Equal(p.Blocks[0x14], p.BlockAt(0x16))
+	a.Nil(p.BlockAt(0x08))
+}
+
+func TestAnalyzeIndirect(t *testing.T) {
+	a := assert.New(t)
+
+	//	0x00: CALL R1
+	//	0x04: JMP  R2
+	//	0x08: data
+	//	0x0C: RET
+	//	0x10: JMP 0x0010
+	p := Analyze(assemble(
+		0x18010000,
+		0x16020000,
+		0xFFFFFFFF,
+		0x15000000,
+		vm.Opcode(0x10000000).WithHHLL(0x0010),
+	), 0)
+
+	a.Equal([]vm.Pointer{0x00, 0x04}, p.Indirect)
+	a.False(p.IsCode(0x0C))
+	a.False(p.IsCode(0x10))
+	a.True(p.Blocks[0x00].Indirect)
+
+	p.Resolve(0x00, 0x0C)
+	p.Resolve(0x04, 0x10)
+	p.Resolve(0x04, 0x10)
+
+	a.True(p.IsCode(0x0C))
+	a.True(p.IsCode(0x10))
+	a.Equal([]vm.Pointer{0x0C}, p.Blocks[0x00].Calls)
+	a.Equal([]vm.Pointer{0x10}, p.Blocks[0x00].Succs)
+	a.Contains(p.Functions, vm.Pointer(0x0C))
+	a.NotContains(p.Functions, vm.Pointer(0x10))
+
+	// Bogus sites, e.g. from a trace of another ROM
+	p.Resolve(vm.StackStart, 0x0C)
+	p.Resolve(0xFFFE, 0x0C)
+	a.NotContains(p.resolved, vm.Pointer(vm.StackStart))
+	a.NotContains(p.resolved, vm.Pointer(0xFFFE))
+
+	// Sites that aren't indirect jumps or calls
+	p.Resolve(0x08, 0x0C)
+	p.Resolve(0x0C, 0x08)
+	a.NotContains(p.resolved, vm.Pointer(0x08))
+	a.NotContains(p.resolved, vm.Pointer(0x0C))
+	a.False(p.IsCode(0x08))
+
+	// Sites past the end of the image
+	p = Analyze(assemble(0x16020000)[:6], 0)
+	p.Resolve(0x04, 0x00)
+	a.Empty(p.resolved)
+}
+
+func TestAnalyzeInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	p := Analyze(assemble(0x00000000, 0xFFFFFFFF), 0)
+	a.Equal([]vm.Pointer{0x04}, p.Invalid)
+	if a.Contains(p.Blocks, vm.Pointer(0x00)) {
+		a.Equal(vm.Pointer(0x04), p.Blocks[0x00].End)
+		a.Empty(p.Blocks[0x00].Succs)
+	}
+}
+
+func BenchmarkAnalyze(b *testing.B) {
+	mem := assemble(testProgram...)
+	for n := 0; n < b.N; n++ {
+		Analyze(mem, 0)
+	}
+}
@@ -0,0 +1,198 @@
+package audio
+
+import "math"
+
+const (
+	// SampleRate is the number of samples per second of the generated
+	// stream
+	SampleRate = 44100
+
+	// SamplesPerFrame is the number of samples generated per frame, at 60
+	// frames per second
+	SamplesPerFrame = SampleRate / 60
+
+	// amplitude is the peak amplitude of a sound at full volume, leaving
+	// some headroom
+	amplitude = math.MaxInt16 / 2
+)
+
+// Waveform is the shape of the generated sound wave.
+type Waveform uint8
+
+const (
+	// Triangle is a triangle wave.
+	Triangle Waveform = iota
+	// Sawtooth is a sawtooth wave.
+	Sawtooth
+	// Pulse is a square wave.
+	Pulse
+	// Noise is white noise.
+	Noise
+)
+
+// Attack durations, by index (in ms)
+var attackTimes = [16]int{
+	2, 8, 16, 24, 38, 56, 68, 80, 100, 250, 500, 800, 1000, 3000, 5000, 8000,
+}
+
+// Decay and release durations, by index (in ms)
+var decayTimes = [16]int{
+	6, 24, 48, 72, 114, 168, 204, 240, 300, 750, 1500, 2400, 3000, 9000, 15000, 24000,
+}
+
+// State describes the state of the chip16's sound generator.
+//
+// Samples are generated on demand, in emulated time: generating n samples
+// moves the generator n/SampleRate seconds forward.
+type State struct {
+	// Attack, Decay, Sustain and Release define the volume envelope of the
+	// tones played by SNP (indices in the attack and decay tables, and
+	// sustain level out of 15).
+	Attack, Decay, Sustain, Release uint8
+
+	// Volume is the volume of the tones played by SNP (out of 15).
+	Volume uint8
+
+	// Wave is the waveform of the tones played by SNP.
+	Wave Waveform
+
+	freq     int  // frequency of the current tone (in Hz), 0 if none
+	envelope bool // whether the current tone follows the envelope
+	wave     Waveform
+	elapsed  int     // samples since the tone started
+	length   int     // samples before the tone is released
+	level    float64 // envelope level of the last sample
+	released float64 // envelope level when the tone was released
+	phase    uint32  // position in the wave's period
+	noise    uint16  // noise generator (LFSR)
+	sample   float64 // current noise sample
+}
+
+// NewState creates a silent sound generator.
+func NewState() *State {
+	return &State{Volume: 15, noise: 0xACE1}
+}
+
+// Tone plays a square wave at full volume for the given duration (in ms),
+// as SND1, SND2 and SND3 do.
+func (s *State) Tone(freq, ms int) {
+	s.start(freq, ms, Pulse, false)
+}
+
+// Play plays a tone for the given duration (in ms), following the
+// generator's envelope and waveform, as SNP does. The tone is released
+// after the duration.
+func (s *State) Play(freq, ms int) {
+	s.start(freq, ms, s.Wave, true)
+}
+
+func (s *State) start(freq, ms int, w Waveform, envelope bool) {
+	s.freq, s.wave, s.envelope = freq, w, envelope
+	s.elapsed = 0
+	s.length = ms * SampleRate / 1000
+	s.level = 0
+}
+
+// Stop stops playing sounds.
+func (s *State) Stop() {
+	s.freq = 0
+}
+
+// Playing tells whether a sound is being played.
+func (s *State) Playing() bool {
+	return s.freq != 0
+}
+
+// Reset silences the generator and restores its default parameters.
+func (s *State) Reset() {
+	*s = *NewState()
+}
+
+// ms converts a duration in milliseconds to samples
+func ms(n int) int {
+	return n * SampleRate / 1000
+}
+
+// gain returns the envelope level after the tone has been played for t
+// samples, or a negative value once it has faded out.
+func (s *State) gain(t int) float64 {
+	if !s.envelope {
+		if t < s.length {
+			return 1
+		}
+		return -1
+	}
+
+	if t >= s.length {
+		r := ms(decayTimes[s.Release&0x0F])
+		if t-s.length >= r {
+			return -1
+		}
+		return s.released * (1 - float64(t-s.length)/float64(r))
+	}
+
+	a, d := ms(attackTimes[s.Attack&0x0F]), ms(decayTimes[s.Decay&0x0F])
+	sustain := float64(s.Sustain&0x0F) / 15
+	switch {
+	case t < a:
+		return float64(t) / float64(a)
+	case t < a+d:
+		return 1 - (1-sustain)*float64(t-a)/float64(d)
+	}
+	return sustain
+}
+
+// waveValue returns the value of the current waveform, between -1 and 1
+func (s *State) waveValue() float64 {
+	p := float64(s.phase) / (1 << 32)
+	switch s.wave {
+	case Triangle:
+		return 1 - 4*math.Abs(p-0.5)
+	case Sawtooth:
+		return 2*p - 1
+	case Pulse:
+		if p < 0.5 {
+			return 1
+		}
+		return -1
+	}
+	return s.sample
+}
+
+// Generate fills buf with the next samples of the stream.
+func (s *State) Generate(buf []int16) {
+	inc := uint32(uint64(s.freq) << 32 / SampleRate)
+	for i := range buf {
+		if s.freq == 0 {
+			buf[i] = 0
+			continue
+		}
+
+		if s.elapsed == s.length {
+			s.released = s.level
+		}
+		g := s.gain(s.elapsed)
+		if g < 0 {
+			s.freq = 0
+			buf[i] = 0
+			continue
+		}
+		s.level = g
+
+		volume := 1.0
+		if s.envelope {
+			volume = float64(s.Volume&0x0F) / 15
+		}
+		buf[i] = int16(amplitude * volume * g * s.waveValue())
+
+		old := s.phase
+		s.phase += inc
+		if s.wave == Noise && (s.phase < old || s.phase >= 1<<31 && old < 1<<31) {
+			// Step the noise generator twice per period
+			bit := (s.noise ^ s.noise>>2 ^ s.noise>>3 ^ s.noise>>5) & 1
+			s.noise = s.noise>>1 | bit<<15
+			s.sample = float64(s.noise)/(1<<15) - 1
+		}
+		s.elapsed++
+	}
+}
@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// crossings counts the sign changes of a signal
+func crossings(buf []int16) int {
+	n := 0
+	for i := 1; i < len(buf); i++ {
+		if (buf[i-1] < 0) != (buf[i] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTone(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+
+	buf := make([]int16, SampleRate/10)
+	s.Generate(buf)
+	a.Equal(0, crossings(buf), "the generator should be silent")
+
+	s.Tone(500, 50)
+	a.True(s.Playing())
+	s.Generate(buf)
+	a.InDelta(50, crossings(buf[:SampleRate/20]), 1, "500Hz should cross zero 1000 times per second")
+	a.Equal(int16(amplitude), buf[0])
+	a.Equal(make([]int16, SampleRate/20), buf[SampleRate/20:], "the tone should stop after 50ms")
+	a.False(s.Playing())
+
+	s.Tone(1000, 1000)
+	s.Stop()
+	s.Generate(buf)
+	a.Equal(0, crossings(buf))
+}
+
+func TestEnvelope(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+
+	// Attack: 16ms, decay: 6ms, sustain: 1/3, release: 24ms, half volume
+	s.Attack, s.Decay, s.Sustain, s.Release = 2, 0, 5, 1
+	s.Volume, s.Wave = 0x8, Pulse
+	s.Play(100, 50)
+
+	buf := make([]int16, SampleRate/10)
+	s.Generate(buf)
+
+	peak := float64(amplitude) * 8 / 15
+	level := func(t int) float64 { return math.Abs(float64(buf[ms(t)])) }
+	a.InDelta(0, level(0), 1, "attack should start from silence")
+	a.InDelta(peak/2, level(8), peak/50, "attack should be halfway at 8ms")
+	a.InDelta(peak, level(16), peak/50, "attack should peak at 16ms")
+	a.InDelta(peak/3, level(30), peak/50, "sustain level should be reached after decay")
+	a.InDelta(peak/6, level(62), peak/50, "release should be halfway at 62ms")
+	a.Equal(make([]int16, ms(100)-ms(75)), buf[ms(75):], "the tone should fade out after release")
+}
+
+func TestWaveforms(t *testing.T) {
+	a := assert.New(t)
+
+	for _, w := range []Waveform{Triangle, Sawtooth, Pulse, Noise} {
+		s := NewState()
+		s.Attack, s.Sustain, s.Wave = 0, 15, w
+		s.Play(441, 100)
+		buf := make([]int16, SampleRate/10)
+		s.Generate(buf)
+
+		var min, max int16
+		for _, v := range buf[ms(10):] {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		a.InDelta(amplitude, max, amplitude/10, "waveform %d", w)
+		a.InDelta(-amplitude, min, amplitude/10, "waveform %d", w)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	a := assert.New(t)
+
+	gen := func() []int16 {
+		s := NewState()
+		s.Wave = Noise
+		s.Play(1000, 100)
+		buf := make([]int16, SampleRate/10)
+		s.Generate(buf)
+		return buf
+	}
+	a.Equal(gen(), gen())
+}
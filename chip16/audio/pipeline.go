@@ -0,0 +1,172 @@
+package audio
+
+import (
+	"sync"
+	"time"
+)
+
+// Ring is a fixed-size FIFO of samples. It is safe for concurrent use.
+type Ring struct {
+	mu   sync.Mutex
+	buf  []int16
+	r, n int // read position, number of samples
+}
+
+// NewRing creates a Ring holding up to size samples.
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]int16, size)}
+}
+
+// Len returns the number of samples in the ring.
+func (r *Ring) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// Cap returns the capacity of the ring.
+func (r *Ring) Cap() int {
+	return len(r.buf)
+}
+
+// Write adds samples to the ring, and returns how many of them fit.
+func (r *Ring) Write(samples []int16) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	written := 0
+	for written < len(samples) && r.n < len(r.buf) {
+		w := (r.r + r.n) % len(r.buf)
+		end := len(r.buf)
+		if w < r.r {
+			end = r.r
+		}
+		c := copy(r.buf[w:end], samples[written:])
+		written += c
+		r.n += c
+	}
+	return written
+}
+
+// Read takes samples out of the ring into out, and returns how many were
+// read.
+func (r *Ring) Read(out []int16) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	read := 0
+	for read < len(out) && r.n > 0 {
+		end := r.r + r.n
+		if end > len(r.buf) {
+			end = len(r.buf)
+		}
+		c := copy(out[read:], r.buf[r.r:end])
+		read += c
+		r.n -= c
+		r.r = (r.r + c) % len(r.buf)
+	}
+	return read
+}
+
+// DefaultMaxAdjust is the default maximum rate adjustment of a Pipeline.
+// Half a percent is small enough to be inaudible.
+const DefaultMaxAdjust = 0.005
+
+// Pipeline carries generated samples to a host audio output running at its
+// own rate, with callbacks of irregular sizes.
+//
+// Samples are resampled to the host rate and buffered. To keep emulation and
+// output in sync without drifting, the resampling ratio is adjusted
+// according to the buffer level (dynamic rate control): samples are
+// stretched when it runs low, and squeezed when it fills up.
+//
+// Push and Read may be called from different goroutines.
+type Pipeline struct {
+	// MaxAdjust is the maximum relative adjustment of the resampling
+	// ratio.
+	MaxAdjust float64
+
+	// Underruns counts the samples output as silence because the buffer
+	// was empty.
+	Underruns int
+
+	// Overruns counts the samples dropped because the buffer was full.
+	Overruns int
+
+	mu     sync.Mutex // protects the fields above, and rs
+	rs     *Resampler
+	ratio  float64 // nominal resampling ratio
+	ring   *Ring
+	target int // buffer level to maintain
+	out    []int16
+	last   int16 // last sample read
+}
+
+// NewPipeline creates a Pipeline for a host playing hostRate samples per
+// second, buffering about latency worth of samples (at least one).
+func NewPipeline(hostRate int, latency time.Duration) *Pipeline {
+	target := int(int64(hostRate) * int64(latency) / int64(time.Second))
+	if target < 1 {
+		target = 1
+	}
+	rs := NewResampler(SampleRate, hostRate)
+	return &Pipeline{
+		MaxAdjust: DefaultMaxAdjust,
+		rs:        rs,
+		ratio:     rs.Ratio,
+		ring:      NewRing(4 * target), // leave room for bursts
+		target:    target,
+	}
+}
+
+// Push adds generated samples to the pipeline.
+func (p *Pipeline) Push(samples []int16) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Fill level, between -1 (empty) and 1 (full)
+	fill := float64(p.ring.Len()-p.target) / float64(p.target)
+	if fill > 1 {
+		fill = 1
+	} else if fill < -1 {
+		fill = -1
+	}
+	p.rs.Ratio = p.ratio * (1 - p.MaxAdjust*fill)
+
+	p.out = p.rs.Resample(p.out[:0], samples)
+	p.Overruns += len(p.out) - p.ring.Write(p.out)
+}
+
+// Read fills out with samples at the host rate, as an audio callback would.
+// It returns the number of buffered samples read: on underruns, the rest of
+// out is filled with silence.
+func (p *Pipeline) Read(out []int16) int {
+	n := p.ring.Read(out)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n > 0 {
+		p.last = out[n-1]
+	}
+	if n < len(out) {
+		// Fade to silence to avoid clicks
+		for i := n; i < len(out); i++ {
+			p.last = int16(int32(p.last) * 15 / 16)
+			out[i] = p.last
+		}
+		p.Underruns += len(out) - n
+	}
+	return n
+}
+
+// Buffered returns the number of samples waiting to be read.
+func (p *Pipeline) Buffered() int {
+	return p.ring.Len()
+}
+
+// Ratio returns the current resampling ratio.
+func (p *Pipeline) Ratio() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rs.Ratio
+}
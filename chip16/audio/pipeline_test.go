@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	a := assert.New(t)
+	r := NewRing(4)
+
+	a.Equal(3, r.Write([]int16{1, 2, 3}))
+	out := make([]int16, 2)
+	a.Equal(2, r.Read(out))
+	a.Equal([]int16{1, 2}, out)
+
+	// Wrap around
+	a.Equal(3, r.Write([]int16{4, 5, 6, 7}), "the ring should only take what fits")
+	a.Equal(4, r.Len())
+	out = make([]int16, 5)
+	a.Equal(4, r.Read(out))
+	a.Equal([]int16{3, 4, 5, 6, 0}, out)
+	a.Equal(0, r.Read(out))
+}
+
+// TestPipelineDrift simulates an emulator running 0.3% too fast, feeding a
+// 48kHz host whose callbacks come with jittery sizes.
+func TestPipelineDrift(t *testing.T) {
+	a := assert.New(t)
+	p := NewPipeline(48000, 50*time.Millisecond)
+
+	frame := make([]int16, SamplesPerFrame)
+	for i := range frame {
+		frame[i] = 1000
+	}
+	frames, produced := 0.0, 0.0
+	out := make([]int16, 2048)
+	sizes := []int{512, 300, 1024, 700, 480, 2048, 64}
+
+	// 60 seconds of host time, one callback at a time
+	consumed := 0
+	for i := 0; consumed < 60*48000; i++ {
+		n := sizes[i%len(sizes)]
+		consumed += n
+		// Emulated frames due by now
+		for frames += float64(n) / 48000 * 60 * 1.003; produced < frames; produced++ {
+			p.Push(frame)
+		}
+		p.Read(out[:n])
+		if i == 100 {
+			// Ignore the startup
+			p.Underruns, p.Overruns = 0, 0
+		}
+	}
+
+	a.Zero(p.Underruns)
+	a.Zero(p.Overruns)
+	// The rate adjustment is proportional to the buffer level: it settles
+	// where the adjustment matches the drift, i.e. above the target.
+	a.True(p.Buffered() > 2400 && p.Buffered() < 2*2400, "the buffer should stay close to its target")
+	a.Less(p.Ratio(), 48000.0/SampleRate, "the ratio should compensate the drift")
+}
+
+func TestPipelineUnderrun(t *testing.T) {
+	a := assert.New(t)
+	p := NewPipeline(SampleRate, 10*time.Millisecond)
+
+	frame := make([]int16, SamplesPerFrame)
+	for i := range frame {
+		frame[i] = 1000
+	}
+	p.Push(frame)
+
+	out := make([]int16, 2*SamplesPerFrame)
+	n := p.Read(out)
+	a.True(n < len(out))
+	a.Equal(len(out)-n, p.Underruns)
+	a.Equal(int16(0), out[len(out)-1], "underruns should fade to silence")
+	for i := n + 1; i < len(out); i++ {
+		if !a.True(out[i] <= out[i-1], "the fade should be smooth") {
+			return
+		}
+	}
+}
+
+func TestPipelineNoLatency(t *testing.T) {
+	a := assert.New(t)
+	p := NewPipeline(48000, 0)
+
+	p.Push(make([]int16, SamplesPerFrame))
+	a.False(math.IsNaN(p.Ratio()))
+	a.Equal(4, p.Buffered(), "the ring should hold a few samples")
+}
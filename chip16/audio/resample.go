@@ -0,0 +1,108 @@
+package audio
+
+import "math"
+
+const (
+	// resampleTaps is the number of input samples on each side of an output
+	// sample used to compute it
+	resampleTaps = 16
+
+	// resamplePhases is the resolution of the precomputed kernel, in steps
+	// per input sample
+	resamplePhases = 256
+)
+
+// Resampler converts a stream of samples to another sample rate, with a
+// Blackman-windowed sinc filter.
+//
+// The ratio may be changed while streaming, e.g. for dynamic rate control.
+type Resampler struct {
+	// Ratio is the output rate over the input rate.
+	Ratio float64
+
+	kernel []float64 // kernel(x) for x in [0, resampleTaps], by phase
+	buf    []float64 // input samples, history first
+	pos    float64   // position of the next output sample in buf
+}
+
+// NewResampler creates a Resampler converting from inRate to outRate.
+func NewResampler(inRate, outRate int) *Resampler {
+	r := &Resampler{
+		Ratio: float64(outRate) / float64(inRate),
+		buf:   make([]float64, 2*resampleTaps),
+		pos:   resampleTaps,
+	}
+
+	// When downsampling, the cutoff is lowered to the output's Nyquist
+	// frequency to avoid aliasing. Leave some room for the transition band.
+	cutoff := 0.95 * math.Min(1, r.Ratio)
+	r.kernel = make([]float64, resampleTaps*resamplePhases+2)
+	for i := range r.kernel {
+		x := float64(i) / resamplePhases
+		if x >= resampleTaps {
+			break
+		}
+		// Blackman window over [-taps, taps]
+		w := 0.42 + 0.5*math.Cos(math.Pi*x/resampleTaps) + 0.08*math.Cos(2*math.Pi*x/resampleTaps)
+		r.kernel[i] = cutoff * sinc(cutoff*x) * w
+	}
+	return r
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// weight returns the kernel's value at distance x from the output sample
+func (r *Resampler) weight(x float64) float64 {
+	x = math.Abs(x) * resamplePhases
+	i := int(x)
+	if i >= len(r.kernel)-1 {
+		return 0
+	}
+	f := x - float64(i)
+	return r.kernel[i]*(1-f) + r.kernel[i+1]*f
+}
+
+// Resample converts in, and appends the output samples to dst.
+//
+// Output lags input by resampleTaps input samples, since the filter needs
+// samples on both sides of its position.
+func (r *Resampler) Resample(dst []int16, in []int16) []int16 {
+	for _, s := range in {
+		r.buf = append(r.buf, float64(s))
+	}
+
+	step := 1 / r.Ratio
+	for r.pos+resampleTaps < float64(len(r.buf)) {
+		c := int(r.pos)
+		var sum float64
+		for k := c - resampleTaps + 1; k <= c+resampleTaps; k++ {
+			sum += r.buf[k] * r.weight(r.pos-float64(k))
+		}
+		dst = append(dst, clamp(sum))
+		r.pos += step
+	}
+
+	// Drop the samples that won't be used anymore
+	if drop := int(r.pos) - resampleTaps; drop > 0 {
+		n := copy(r.buf, r.buf[drop:])
+		r.buf = r.buf[:n]
+		r.pos -= float64(drop)
+	}
+	return dst
+}
+
+func clamp(x float64) int16 {
+	x = math.Round(x)
+	switch {
+	case x > math.MaxInt16:
+		return math.MaxInt16
+	case x < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(x)
+}
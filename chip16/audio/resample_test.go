@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sine generates n samples of a sine wave at freq Hz
+func sine(freq float64, rate, n int) []int16 {
+	buf := make([]int16, n)
+	for i := range buf {
+		buf[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return buf
+}
+
+func TestResamplerIdentity(t *testing.T) {
+	a := assert.New(t)
+
+	r := NewResampler(SampleRate, SampleRate)
+	in := sine(1000, SampleRate, 1000)
+	out := r.Resample(nil, in)
+	if a.Len(out, len(in)) {
+		for i := range in[:len(in)-resampleTaps] {
+			if !a.InDelta(in[i], out[i+resampleTaps], 200, "sample %d", i) {
+				return
+			}
+		}
+	}
+}
+
+func TestResampler(t *testing.T) {
+	a := assert.New(t)
+
+	for _, rate := range []int{48000, 22050} {
+		r := NewResampler(SampleRate, rate)
+		var out []int16
+
+		// Streaming by chunks of various sizes
+		in := sine(1000, SampleRate, SampleRate)
+		for i := 0; i < len(in); i += 700 {
+			end := i + 700
+			if end > len(in) {
+				end = len(in)
+			}
+			out = r.Resample(out, in[i:end])
+		}
+		a.InDelta(rate, len(out), float64(rate)/100, "%d Hz: output length", rate)
+
+		// Skip the filter's warmup
+		out = out[rate/10:]
+		a.InDelta(2000*len(out)/rate, crossings(out), 2, "%d Hz: frequency should be kept", rate)
+		peak := 0
+		for _, s := range out {
+			if int(s) > peak {
+				peak = int(s)
+			}
+		}
+		a.InDelta(10000, peak, 200, "%d Hz: amplitude should be kept", rate)
+	}
+}
+
+func TestResamplerAliasing(t *testing.T) {
+	a := assert.New(t)
+
+	// 20kHz is above the Nyquist frequency of 22050Hz: it must be filtered
+	// out rather than folded back
+	r := NewResampler(SampleRate, 22050)
+	out := r.Resample(nil, sine(20000, SampleRate, SampleRate/10))
+	for _, s := range out[100:] {
+		if !a.InDelta(0, s, 500) {
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// snapshot is the fixed-size encoding of a State
+type snapshot struct {
+	Attack, Decay, Sustain, Release, Volume uint8
+	Wave                                    Waveform
+
+	Freq     int32
+	Envelope bool
+	Playing  Waveform
+	Elapsed  int32
+	Length   int32
+	Level    float64
+	Released float64
+	Phase    uint32
+	Noise    uint16
+	Sample   float64
+}
+
+// MarshalBinary encodes the generator's state, including the sound being
+// played.
+func (s *State) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, snapshot{
+		s.Attack, s.Decay, s.Sustain, s.Release, s.Volume, s.Wave,
+		int32(s.freq), s.envelope, s.wave, int32(s.elapsed), int32(s.length),
+		s.level, s.released, s.phase, s.noise, s.sample,
+	})
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary restores a state encoded by MarshalBinary.
+func (s *State) UnmarshalBinary(b []byte) error {
+	var snap snapshot
+	if len(b) != binary.Size(snap) {
+		return fmt.Errorf("invalid sound state size: %d bytes", len(b))
+	}
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &snap); err != nil {
+		return err
+	}
+	*s = State{
+		Attack: snap.Attack, Decay: snap.Decay, Sustain: snap.Sustain,
+		Release: snap.Release, Volume: snap.Volume, Wave: snap.Wave,
+
+		freq:     int(snap.Freq),
+		envelope: snap.Envelope,
+		wave:     snap.Playing,
+		elapsed:  int(snap.Elapsed),
+		length:   int(snap.Length),
+		level:    snap.Level,
+		released: snap.Released,
+		phase:    snap.Phase,
+		noise:    snap.Noise,
+		sample:   snap.Sample,
+	}
+	return nil
+}
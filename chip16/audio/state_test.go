@@ -0,0 +1,36 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	a := assert.New(t)
+
+	s := NewState()
+	s.Attack, s.Decay, s.Sustain, s.Release = 1, 2, 10, 3
+	s.Wave = Noise
+	s.Play(440, 100)
+	buf := make([]int16, 1000)
+	s.Generate(buf)
+
+	b, err := s.MarshalBinary()
+	if !a.NoError(err) {
+		return
+	}
+	restored := NewState()
+	if !a.NoError(restored.UnmarshalBinary(b)) {
+		return
+	}
+	a.Equal(s, restored)
+
+	// Both generate the same sound
+	other := make([]int16, len(buf))
+	s.Generate(buf)
+	restored.Generate(other)
+	a.Equal(buf, other)
+
+	a.Error(restored.UnmarshalBinary(b[1:]))
+}
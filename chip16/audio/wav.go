@@ -0,0 +1,86 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// wavHeaderSize is the size of the RIFF and format headers of a WAV file,
+// up to the sample data
+const wavHeaderSize = 44
+
+// WAVWriter writes samples as a 16-bit mono PCM WAV file, at SampleRate.
+type WAVWriter struct {
+	w   io.Writer
+	n   int64 // size of the sample data written (in bytes)
+	buf []byte
+}
+
+// NewWAVWriter writes the WAV header to w, and returns a WAVWriter writing
+// samples after it.
+//
+// The header gives the size of the sample data. If w is an io.WriteSeeker,
+// Close writes the actual size, otherwise the size is left unknown, which
+// most readers accept.
+func NewWAVWriter(w io.Writer) (*WAVWriter, error) {
+	wr := &WAVWriter{w: w}
+	if _, err := w.Write(wr.header(0xFFFFFFFF - wavHeaderSize + 8)); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+func (w *WAVWriter) header(size uint32) []byte {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], size+wavHeaderSize-8)
+	copy(h[8:], "WAVE")
+
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)           // format chunk size
+	binary.LittleEndian.PutUint16(h[20:], 1)            // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1)            // mono
+	binary.LittleEndian.PutUint32(h[24:], SampleRate)   // sample rate
+	binary.LittleEndian.PutUint32(h[28:], SampleRate*2) // byte rate
+	binary.LittleEndian.PutUint16(h[32:], 2)            // block align
+	binary.LittleEndian.PutUint16(h[34:], 16)           // bits per sample
+
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], size)
+	return h
+}
+
+// Write writes samples.
+func (w *WAVWriter) Write(samples []int16) error {
+	if cap(w.buf) < 2*len(samples) {
+		w.buf = make([]byte, 2*len(samples))
+	}
+	b := w.buf[:2*len(samples)]
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(s))
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return err
+}
+
+// Close writes the size of the sample data in the header, if the underlying
+// writer is an io.WriteSeeker. It doesn't close the underlying writer.
+func (w *WAVWriter) Close() error {
+	ws, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(end-w.n-wavHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(w.header(uint32(w.n))); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
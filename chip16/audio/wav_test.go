@@ -0,0 +1,55 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAVWriter(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := ioutil.TempFile("", "chip16-*.wav")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWAVWriter(f)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(w.Write([]int16{1, -1}))
+	a.NoError(w.Write([]int16{0x1234}))
+	a.NoError(w.Close())
+
+	b, err := ioutil.ReadFile(f.Name())
+	if !a.NoError(err) || !a.Len(b, wavHeaderSize+6) {
+		return
+	}
+	a.Equal("RIFF", string(b[0:4]))
+	a.Equal(uint32(wavHeaderSize-8+6), binary.LittleEndian.Uint32(b[4:]))
+	a.Equal("WAVEfmt ", string(b[8:16]))
+	a.Equal(uint32(SampleRate), binary.LittleEndian.Uint32(b[24:]))
+	a.Equal("data", string(b[36:40]))
+	a.Equal(uint32(6), binary.LittleEndian.Uint32(b[40:]))
+	a.Equal([]byte{0x01, 0x00, 0xFF, 0xFF, 0x34, 0x12}, b[wavHeaderSize:])
+}
+
+func TestWAVWriterStream(t *testing.T) {
+	a := assert.New(t)
+
+	var b bytes.Buffer
+	w, err := NewWAVWriter(&b)
+	if a.NoError(err) {
+		a.NoError(w.Write([]int16{1}))
+		a.NoError(w.Close())
+		a.Equal(wavHeaderSize+2, b.Len())
+		a.Equal(uint32(0xFFFFFFFF), binary.LittleEndian.Uint32(b.Bytes()[4:]), "size should be unknown")
+	}
+}
@@ -0,0 +1,178 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+)
+
+// Recorder records the screen, frame by frame.
+type Recorder interface {
+	// Capture records the current screen of s. It is expected to be
+	// called once per frame, at the vertical blank.
+	Capture(s *graphics.State) error
+
+	// Close finishes the recording. It doesn't close the underlying writer.
+	Close() error
+}
+
+// opaque returns a copy of a palette with all colors opaque, since color 0 is
+// only transparent in the foreground
+func opaque(p []color.RGBA) color.Palette {
+	pal := make(color.Palette, len(p))
+	for i, c := range p {
+		c.A = 0xFF
+		pal[i] = c
+	}
+	return pal
+}
+
+// GIF records frames as an animated GIF. Frames use the chip16 palette, so
+// that they are recorded losslessly.
+//
+// Consecutive identical frames are merged, and frames are kept in memory
+// until the recording is closed.
+type GIF struct {
+	// Exact keeps every frame. Since GIF delays are in hundredths of a
+	// second, frames then last 1 or 2 centiseconds in turn, and most viewers
+	// slow down the shorter ones. By default, frames are dropped when needed
+	// to keep all delays at 2 centiseconds or more.
+	Exact bool
+
+	w      io.Writer
+	anim   gif.GIF
+	frames int // number of captured frames
+	start  int // frame at which the last image starts
+}
+
+// NewGIF creates a GIF recorder writing to w.
+func NewGIF(w io.Writer) *GIF {
+	return &GIF{w: w}
+}
+
+// centiseconds returns the time at which a frame starts, in hundredths of a
+// second
+func centiseconds(frame int) int {
+	return frame * 100 / cpu.FrameRate
+}
+
+// Capture implements Recorder.
+func (g *GIF) Capture(s *graphics.State) error {
+	img := image.NewPaletted(image.Rect(0, 0, graphics.ScreenW, graphics.ScreenH), opaque(s.Palette))
+	s.Compose(img.Pix)
+	defer func() { g.frames++ }()
+
+	n := len(g.anim.Image)
+	if n == 0 {
+		g.append(img)
+		return nil
+	}
+
+	last := g.anim.Image[n-1]
+	if bytes.Equal(last.Pix, img.Pix) && samePalette(last.Palette, img.Palette) {
+		return nil
+	}
+	if !g.Exact && centiseconds(g.frames)-centiseconds(g.start) < 2 {
+		g.anim.Image[n-1] = img
+		return nil
+	}
+	g.anim.Delay[n-1] = centiseconds(g.frames) - centiseconds(g.start)
+	g.append(img)
+	return nil
+}
+
+func (g *GIF) append(img *image.Paletted) {
+	g.anim.Image = append(g.anim.Image, img)
+	g.anim.Delay = append(g.anim.Delay, 0)
+	g.start = g.frames
+}
+
+func samePalette(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Close implements Recorder: it encodes the recorded frames.
+func (g *GIF) Close() error {
+	n := len(g.anim.Image)
+	if n == 0 {
+		return fmt.Errorf("no frames recorded")
+	}
+	g.anim.Delay[n-1] = centiseconds(g.frames) - centiseconds(g.start)
+	return gif.EncodeAll(g.w, &g.anim)
+}
+
+// Y4M records frames as a raw YUV4MPEG2 stream (4:4:4, BT.601 limited
+// range), as read by most video tools (e.g. ffmpeg).
+type Y4M struct {
+	w     *bufio.Writer
+	frame []uint8
+	yuv   [16][3]uint8
+	err   error
+}
+
+// NewY4M creates a Y4M recorder writing to w.
+func NewY4M(w io.Writer) *Y4M {
+	y := &Y4M{
+		w:     bufio.NewWriter(w),
+		frame: make([]uint8, graphics.ScreenW*graphics.ScreenH),
+	}
+	_, y.err = fmt.Fprintf(
+		y.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444\n",
+		graphics.ScreenW, graphics.ScreenH, cpu.FrameRate,
+	)
+	return y
+}
+
+// Capture implements Recorder.
+func (y *Y4M) Capture(s *graphics.State) error {
+	if y.err != nil {
+		return y.err
+	}
+	for i, c := range s.Palette {
+		y.yuv[i] = toYUV(c)
+	}
+	s.Compose(y.frame)
+
+	y.w.WriteString("FRAME\n")
+	for plane := 0; plane < 3; plane++ {
+		for _, c := range y.frame {
+			y.w.WriteByte(y.yuv[c][plane])
+		}
+	}
+	// Write errors are sticky
+	_, y.err = y.w.Write(nil)
+	return y.err
+}
+
+// Close implements Recorder: it flushes the stream.
+func (y *Y4M) Close() error {
+	if y.err != nil {
+		return y.err
+	}
+	return y.w.Flush()
+}
+
+// toYUV converts a color to BT.601 limited range YCbCr
+func toYUV(c color.RGBA) [3]uint8 {
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	return [3]uint8{
+		uint8(16 + (65481*r+128553*g+24966*b+127500)/255000),
+		uint8(128 + (-37797*r-74203*g+112000*b)/255000),
+		uint8(128 + (112000*r-93786*g-18214*b)/255000),
+	}
+}
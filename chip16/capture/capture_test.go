@@ -0,0 +1,104 @@
+package capture
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/stretchr/testify/assert"
+)
+
+// record captures frames of s, calling update before each of them
+func record(r Recorder, s *graphics.State, frames int, update func(n int)) error {
+	for n := 0; n < frames; n++ {
+		update(n)
+		if err := r.Capture(s); err != nil {
+			return err
+		}
+	}
+	return r.Close()
+}
+
+func TestGIF(t *testing.T) {
+	a := assert.New(t)
+	s := graphics.NewState()
+
+	var b bytes.Buffer
+	g := NewGIF(&b)
+	g.Exact = true
+	err := record(g, s, 6, func(n int) {
+		switch n {
+		case 2:
+			s.SetPixel(0, 0, 0xF)
+		case 4:
+			s.Palette[0xF] = color.RGBA{0x12, 0x34, 0x56, 0xFF}
+		}
+	})
+	if !a.NoError(err) {
+		return
+	}
+
+	anim, err := gif.DecodeAll(&b)
+	if !a.NoError(err) {
+		return
+	}
+	if a.Len(anim.Image, 3) {
+		a.Equal([]int{3, 3, 4}, anim.Delay)
+		a.Equal(uint8(0x0), anim.Image[0].Pix[0])
+		a.Equal(uint8(0xF), anim.Image[1].Pix[0])
+		a.Equal(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, anim.Image[1].Palette[0xF])
+		a.Equal(color.RGBA{0x12, 0x34, 0x56, 0xFF}, anim.Image[2].Palette[0xF])
+		a.Equal(color.RGBA{0x00, 0x00, 0x00, 0xFF}, anim.Image[2].Palette[0x0], "colors should be opaque")
+	}
+}
+
+func TestGIFDrop(t *testing.T) {
+	a := assert.New(t)
+	s := graphics.NewState()
+
+	// Every frame is different
+	var b bytes.Buffer
+	err := record(NewGIF(&b), s, 6, func(n int) { s.BG = uint8(n) })
+	if !a.NoError(err) {
+		return
+	}
+	anim, err := gif.DecodeAll(&b)
+	if a.NoError(err) {
+		// Frames start at 0, 1, 3, 5, 6 and 8 centiseconds, and the
+		// recording ends at 10.
+		a.Equal([]int{3, 2, 3, 2}, anim.Delay)
+		if a.Len(anim.Image, 4) {
+			a.Equal(uint8(1), anim.Image[0].Pix[0])
+			a.Equal(uint8(4), anim.Image[2].Pix[0])
+		}
+	}
+
+	a.Error(NewGIF(&b).Close(), "empty recordings should yield an error")
+}
+
+func TestY4M(t *testing.T) {
+	a := assert.New(t)
+	s := graphics.NewState()
+
+	var b bytes.Buffer
+	err := record(NewY4M(&b), s, 2, func(n int) { s.BG = uint8(0xF * n) })
+	if !a.NoError(err) {
+		return
+	}
+
+	header := "YUV4MPEG2 W320 H240 F60:1 Ip A1:1 C444\n"
+	frame := len("FRAME\n") + 3*graphics.ScreenW*graphics.ScreenH
+	if a.Equal(len(header)+2*frame, b.Len()) {
+		out := b.String()
+		a.True(strings.HasPrefix(out, header+"FRAME\n"))
+
+		// Black, then white
+		y := len(header) + len("FRAME\n")
+		u := y + graphics.ScreenW*graphics.ScreenH
+		a.Equal([]byte{16, 128}, []byte{out[y], out[u]})
+		a.Equal([]byte{235, 128}, []byte{out[frame+y], out[frame+u]})
+	}
+}
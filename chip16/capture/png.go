@@ -0,0 +1,20 @@
+package capture
+
+import (
+	"image"
+	"image/png"
+	"os"
+)
+
+// WritePNG saves an image (e.g. a screenshot) to a PNG file.
+func WritePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,43 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePNG(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := ioutil.TempFile("", "chip16-*.png")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	a.NoError(f.Close())
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(1, 0, color.RGBA{0xFF, 0, 0, 0xFF})
+	if !a.NoError(WritePNG(f.Name(), img)) {
+		return
+	}
+
+	f, err = os.Open(f.Name())
+	if !a.NoError(err) {
+		return
+	}
+	defer f.Close()
+	got, err := png.Decode(f)
+	if a.NoError(err) {
+		a.Equal(img.Bounds(), got.Bounds())
+		r, _, _, _ := got.At(1, 0).RGBA()
+		a.Equal(uint32(0xFFFF), r)
+	}
+
+	a.Error(WritePNG(f.Name()+"/missing.png", img))
+}
@@ -0,0 +1,271 @@
+package cheat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Op is a comparison operator.
+type Op int
+
+const (
+	// Eq is ==
+	Eq Op = iota
+	// Ne is !=
+	Ne
+	// Lt is <
+	Lt
+	// Le is <=
+	Le
+	// Gt is >
+	Gt
+	// Ge is >=
+	Ge
+)
+
+var opNames = []string{"==", "!=", "<", "<=", ">", ">="}
+
+func (o Op) String() string {
+	if o >= 0 && int(o) < len(opNames) {
+		return opNames[o]
+	}
+	return fmt.Sprintf("Op(%d)", int(o))
+}
+
+// Condition compares a variable in RAM with a value.
+type Condition struct {
+	Kind  Kind
+	Addr  vm.Pointer
+	Op    Op
+	Value int
+}
+
+// Holds tells whether the condition is true.
+func (c *Condition) Holds(ram []byte) bool {
+	return c.holdsFor(c.Kind.Get(ram, c.Addr))
+}
+
+// holdsFor tells whether the condition is true when its variable is x
+func (c *Condition) holdsFor(x int) bool {
+	y := c.Kind.Wrap(c.Value)
+	switch c.Op {
+	case Eq:
+		return x == y
+	case Ne:
+		return x != y
+	case Lt:
+		return x < y
+	case Le:
+		return x <= y
+	case Gt:
+		return x > y
+	case Ge:
+		return x >= y
+	}
+	return false
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s 0x%04X %s %d", c.Kind, uint16(c.Addr), c.Op, c.Value)
+}
+
+// Cheat patches a variable in RAM.
+type Cheat struct {
+	// Name describes the cheat (e.g. "Infinite lives").
+	Name string
+
+	// Enabled tells whether the cheat is applied.
+	Enabled bool
+
+	// Kind, Addr and Value tell what to write, and where.
+	Kind  Kind
+	Addr  vm.Pointer
+	Value int
+
+	// If is the condition under which the cheat is applied. If nil, the
+	// cheat is always applied.
+	If *Condition
+}
+
+// Apply writes the cheat's value, if it is enabled and its condition holds.
+// RAM is left untouched (and unshared) if it already holds the value.
+//
+// Cheats and conditions whose variable doesn't fit in memory (e.g. a u16 at
+// 0xFFFF) are never applied.
+func (c *Cheat) Apply(v *vm.State) {
+	if !c.Enabled || !c.Kind.fits(c.Addr) {
+		return
+	}
+	if c.If != nil && (!c.If.Kind.fits(c.If.Addr) || !c.If.holdsFor(c.If.Kind.read(&v.RAM, c.If.Addr))) {
+		return
+	}
+	var b [2]byte
+	c.Kind.Put(b[:], 0, c.Value)
+	v.RAM.Write(c.Addr, b[:c.Kind.Size()])
+}
+
+func (c *Cheat) String() string {
+	s := fmt.Sprintf("%s 0x%04X %d", c.Kind, uint16(c.Addr), c.Value)
+	if c.If != nil {
+		s += " if " + c.If.String()
+	}
+	if c.Name != "" {
+		s += " ; " + c.Name
+	}
+	return s
+}
+
+// List is a set of cheats.
+type List struct {
+	Cheats []*Cheat
+}
+
+// Apply applies the cheats, in order. Machines apply their cheats at the
+// start of every frame.
+func (l *List) Apply(v *vm.State) {
+	for _, c := range l.Cheats {
+		c.Apply(v)
+	}
+}
+
+// Read parses a cheat file.
+//
+// Cheat files are line-oriented text files. Blank lines and lines starting
+// with ';' are ignored, others are cheats, optionally followed by a
+// condition and a name:
+//
+//		KIND ADDR VALUE [if KIND ADDR OP VALUE] [; NAME]
+//
+// where KIND is u8, i8, u16 or i16, ADDR is an hexadecimal address (with or
+// without 0x prefix), VALUE is a decimal or 0x-prefixed hexadecimal number,
+// and OP is one of == != < <= > >=. For instance:
+//
+//		u8 0x2002 3 ; Infinite lives
+//		i16 0x2004 100 if i16 0x2004 < 10 ; Heal when low
+//
+// Cheats are enabled when read.
+func Read(r io.Reader) (*List, error) {
+	l := &List{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == ';' {
+			continue
+		}
+		c, err := parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		l.Cheats = append(l.Cheats, c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Load reads a cheat file from disk.
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return l, nil
+}
+
+// Path returns the path of the cheat file that goes with a ROM: the ROM's
+// path, with a .cht extension.
+func Path(rom string) string {
+	return strings.TrimSuffix(rom, filepath.Ext(rom)) + ".cht"
+}
+
+// LoadFor reads the cheats of a ROM: those of the given file, or those of
+// the ROM's cheat file (see Path) if path is empty. It returns a nil list if
+// path is empty and the ROM has no cheat file.
+func LoadFor(rom, path string) (*List, error) {
+	if path == "" {
+		path = Path(rom)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	return Load(path)
+}
+
+// Write writes the cheats as a cheat file (see Read).
+func (l *List) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range l.Cheats {
+		fmt.Fprintln(bw, c)
+	}
+	return bw.Flush()
+}
+
+func parse(text string) (*Cheat, error) {
+	c := &Cheat{Enabled: true}
+	if i := strings.IndexByte(text, ';'); i >= 0 {
+		c.Name = strings.TrimSpace(text[i+1:])
+		text = text[:i]
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 3 && (len(fields) != 8 || fields[3] != "if") {
+		return nil, fmt.Errorf("expected KIND ADDR VALUE [if KIND ADDR OP VALUE]")
+	}
+	var err error
+	if c.Kind, c.Addr, c.Value, err = parseVar(fields[0], fields[1], fields[2]); err != nil {
+		return nil, err
+	}
+	if len(fields) == 3 {
+		return c, nil
+	}
+
+	cond := &Condition{}
+	if cond.Kind, cond.Addr, cond.Value, err = parseVar(fields[4], fields[5], fields[7]); err != nil {
+		return nil, err
+	}
+	if cond.Op, err = parseOp(fields[6]); err != nil {
+		return nil, err
+	}
+	c.If = cond
+	return c, nil
+}
+
+// parseVar parses the kind, address and value of a variable
+func parseVar(kind, addr, value string) (Kind, vm.Pointer, int, error) {
+	k, err := ParseKind(kind)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	a, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(addr), "0x"), 16, 16)
+	if err != nil || !k.fits(vm.Pointer(a)) {
+		return 0, 0, 0, fmt.Errorf("bad address %q", addr)
+	}
+	x, err := strconv.ParseInt(value, 0, 32)
+	if err != nil || int(x) < -(1<<(8*uint(k.Size())-1)) || int(x) >= 1<<(8*uint(k.Size())) {
+		return 0, 0, 0, fmt.Errorf("bad %s value %q", k, value)
+	}
+	return k, vm.Pointer(a), int(x), nil
+}
+
+func parseOp(s string) (Op, error) {
+	for o, name := range opNames {
+		if s == name {
+			return Op(o), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operator %q", s)
+}
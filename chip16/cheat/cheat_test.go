@@ -0,0 +1,153 @@
+package cheat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFile = `; Test cheats
+u8 0x2002 3 ; Infinite lives
+
+i16 2004 100 if i16 0x2004 < 10 ; Heal when low
+u16 0x2006 0xFFFF
+`
+
+func TestRead(t *testing.T) {
+	a := assert.New(t)
+	l, err := Read(strings.NewReader(testFile))
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]*Cheat{
+		{Name: "Infinite lives", Enabled: true, Kind: Uint8, Addr: 0x2002, Value: 3},
+		{Name: "Heal when low", Enabled: true, Kind: Int16, Addr: 0x2004, Value: 100,
+			If: &Condition{Kind: Int16, Addr: 0x2004, Op: Lt, Value: 10}},
+		{Enabled: true, Kind: Uint16, Addr: 0x2006, Value: 0xFFFF},
+	}, l.Cheats)
+
+	var b bytes.Buffer
+	if a.NoError(l.Write(&b)) {
+		a.Equal("u8 0x2002 3 ; Infinite lives\n"+
+			"i16 0x2004 100 if i16 0x2004 < 10 ; Heal when low\n"+
+			"u16 0x2006 65535\n", b.String())
+		r, err := Read(&b)
+		a.NoError(err)
+		a.Equal(l, r)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	a := assert.New(t)
+	for _, line := range []string{
+		"u8 0x2002",
+		"u32 0x2002 3",
+		"u8 0x12345 3",
+		"u16 0xFFFF 3",
+		"u8 0x2002 256",
+		"i8 0x2002 -129",
+		"u8 0x2002 three",
+		"u8 0x2002 3 when u8 0x2002 == 1",
+		"u8 0x2002 3 if u8 0x2002 =< 1",
+		"u8 0x2002 3 if u8 0x2002 == 1 2",
+	} {
+		_, err := Read(strings.NewReader("\n" + line))
+		if a.Error(err, line) {
+			a.True(strings.HasPrefix(err.Error(), "line 2: "), err.Error())
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	a := assert.New(t)
+	l, err := Read(strings.NewReader(testFile))
+	if !a.NoError(err) {
+		return
+	}
+	v := vm.NewState()
+	v.PutInt16At(50, 0x2004)
+	l.Apply(v)
+	a.Equal(byte(3), v.RAM.At(0x2002))
+	a.Equal([]byte{50, 0, 0xFF, 0xFF}, v.RAM.View(0x2004, 4))
+
+	v.PutInt16At(-5, 0x2004)
+	v.RAM.Set(0x2002, 1)
+	l.Cheats[0].Enabled = false
+	l.Apply(v)
+	a.Equal(byte(1), v.RAM.At(0x2002))
+	x, _ := v.Int16At(0x2004)
+	a.Equal(int16(100), x)
+
+	// Cheats that change nothing don't unshare memory
+	c := v.Clone()
+	l.Apply(c)
+	a.True(&v.RAM.View(0x2000, 1)[0] == &c.RAM.View(0x2000, 1)[0])
+}
+
+func TestApplyOutOfBounds(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	c := &Cheat{Enabled: true, Kind: Uint16, Addr: 0xFFFF, Value: 0x1234}
+	a.NotPanics(func() { c.Apply(v) })
+	a.Equal(byte(0), v.RAM.At(0xFFFF), "variables past the end of memory shouldn't be written")
+
+	c = &Cheat{Enabled: true, Kind: Uint8, Addr: 0x1000, Value: 1}
+	c.If = &Condition{Kind: Int16, Addr: 0xFFFF, Op: Eq, Value: 0}
+	a.NotPanics(func() { c.Apply(v) })
+	a.Equal(byte(0), v.RAM.At(0x1000))
+}
+
+func TestConditions(t *testing.T) {
+	a := assert.New(t)
+	ram := []byte{5}
+	for op, exp := range map[Op][3]bool{
+		Eq: {false, true, false},
+		Ne: {true, false, true},
+		Lt: {false, false, true},
+		Le: {false, true, true},
+		Gt: {true, false, false},
+		Ge: {true, true, false},
+	} {
+		for i, x := range []int{4, 5, 6} {
+			c := Condition{Kind: Uint8, Op: op, Value: x}
+			a.Equal(exp[i], c.Holds(ram), "5 %s %d", op, x)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "roms/game.cht", Path("roms/game.c16"))
+}
+
+func TestLoadFor(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "chip16-")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "game.c16")
+
+	// No cheat file is fine, unless one is asked for
+	l, err := LoadFor(rom, "")
+	a.NoError(err)
+	a.Nil(l)
+	_, err = LoadFor(rom, filepath.Join(dir, "other.cht"))
+	a.Error(err)
+
+	if !a.NoError(ioutil.WriteFile(Path(rom), []byte(testFile), 0644)) {
+		return
+	}
+	l, err = LoadFor(rom, "")
+	if a.NoError(err) {
+		a.Len(l.Cheats, 3)
+	}
+}
@@ -0,0 +1,217 @@
+// Package cheat finds game variables in RAM, and patches them.
+//
+// A Search narrows down the addresses of a variable by comparing successive
+// snapshots of the RAM, e.g. the number of lives, which decreases when the
+// player dies:
+//
+//		s := cheat.NewSearch(cheat.Uint8, m.State().RAM.Bytes())
+//		... // die
+//		s.Decreased(m.State().RAM.Bytes())
+//		... // don't die
+//		s.Unchanged(m.State().RAM.Bytes())
+//		for _, r := range s.Results(m.State().RAM.Bytes()) {
+//			...
+//		}
+//
+// Cheats then keep variables at given values (see List).
+package cheat
+
+import (
+	"fmt"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Kind is the type of a variable in RAM.
+type Kind int
+
+const (
+	// Uint8 is an unsigned byte.
+	Uint8 Kind = iota
+
+	// Int8 is a signed byte.
+	Int8
+
+	// Uint16 is an unsigned little-endian 16-bit word.
+	Uint16
+
+	// Int16 is a signed little-endian 16-bit word.
+	Int16
+)
+
+var kindNames = []string{"u8", "i8", "u16", "i16"}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// ParseKind parses the name of a kind: u8, i8, u16 or i16.
+func ParseKind(s string) (Kind, error) {
+	for k, name := range kindNames {
+		if s == name {
+			return Kind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown kind %q", s)
+}
+
+// Size returns the size of variables of kind k, in bytes.
+func (k Kind) Size() int {
+	if k == Uint16 || k == Int16 {
+		return 2
+	}
+	return 1
+}
+
+// Get reads a variable at addr.
+func (k Kind) Get(ram []byte, addr vm.Pointer) int {
+	x := int(ram[addr])
+	if k.Size() == 2 {
+		x |= int(ram[addr+1]) << 8
+	}
+	return k.Wrap(x)
+}
+
+// fits tells whether a variable at addr fits in memory
+func (k Kind) fits(addr vm.Pointer) bool {
+	return int(addr)+k.Size() <= vm.MemSize
+}
+
+// read reads a variable at addr in memory
+func (k Kind) read(m *vm.Memory, addr vm.Pointer) int {
+	return k.Get(m.View(addr, k.Size()), 0)
+}
+
+// Put writes a variable at addr.
+func (k Kind) Put(ram []byte, addr vm.Pointer, x int) {
+	ram[addr] = byte(x)
+	if k.Size() == 2 {
+		ram[addr+1] = byte(x >> 8)
+	}
+}
+
+// Wrap converts x to the range of kind k, as if stored and read back.
+func (k Kind) Wrap(x int) int {
+	switch k {
+	case Int8:
+		return int(int8(x))
+	case Uint16:
+		return int(uint16(x))
+	case Int16:
+		return int(int16(x))
+	}
+	return int(uint8(x))
+}
+
+// Result is a candidate address of a search.
+type Result struct {
+	Addr vm.Pointer
+
+	// Prev is the value in the last snapshot.
+	Prev int
+
+	// Value is the current value.
+	Value int
+}
+
+// Search narrows down the addresses of a variable. Each filter keeps the
+// candidates matching a condition, then takes a new snapshot of the RAM.
+type Search struct {
+	// Kind is the type of the variable.
+	Kind Kind
+
+	addrs []vm.Pointer // candidates, sorted
+	prev  []byte       // last snapshot
+}
+
+// NewSearch starts a search, with every address as a candidate.
+func NewSearch(k Kind, ram []byte) *Search {
+	s := &Search{Kind: k}
+	s.Reset(ram)
+	return s
+}
+
+// Reset makes every address a candidate again, and takes a snapshot.
+func (s *Search) Reset(ram []byte) {
+	n := len(ram) - s.Kind.Size() + 1
+	if n < 0 {
+		n = 0
+	}
+	s.addrs = make([]vm.Pointer, n)
+	for i := range s.addrs {
+		s.addrs[i] = vm.Pointer(i)
+	}
+	s.Snapshot(ram)
+}
+
+// Snapshot takes a new snapshot of the RAM, without filtering.
+func (s *Search) Snapshot(ram []byte) {
+	s.prev = append(s.prev[:0], ram...)
+}
+
+// Len returns the number of candidates.
+func (s *Search) Len() int {
+	return len(s.addrs)
+}
+
+// Results returns the candidates, with their values in the last snapshot and
+// in ram.
+func (s *Search) Results(ram []byte) []Result {
+	res := make([]Result, len(s.addrs))
+	for i, addr := range s.addrs {
+		res[i] = Result{addr, s.Kind.Get(s.prev, addr), s.Kind.Get(ram, addr)}
+	}
+	return res
+}
+
+// Filter keeps the candidates for which keep returns true, given their
+// values in the last snapshot and in ram. It returns the number of remaining
+// candidates.
+func (s *Search) Filter(ram []byte, keep func(prev, cur int) bool) int {
+	n := 0
+	for _, addr := range s.addrs {
+		if keep(s.Kind.Get(s.prev, addr), s.Kind.Get(ram, addr)) {
+			s.addrs[n] = addr
+			n++
+		}
+	}
+	s.addrs = s.addrs[:n]
+	s.Snapshot(ram)
+	return n
+}
+
+// Equal keeps the candidates whose value is x.
+func (s *Search) Equal(ram []byte, x int) int {
+	x = s.Kind.Wrap(x)
+	return s.Filter(ram, func(prev, cur int) bool { return cur == x })
+}
+
+// NotEqual keeps the candidates whose value isn't x.
+func (s *Search) NotEqual(ram []byte, x int) int {
+	x = s.Kind.Wrap(x)
+	return s.Filter(ram, func(prev, cur int) bool { return cur != x })
+}
+
+// Changed keeps the candidates that changed since the last snapshot.
+func (s *Search) Changed(ram []byte) int {
+	return s.Filter(ram, func(prev, cur int) bool { return cur != prev })
+}
+
+// Unchanged keeps the candidates that didn't change since the last
+// snapshot.
+func (s *Search) Unchanged(ram []byte) int {
+	return s.Filter(ram, func(prev, cur int) bool { return cur == prev })
+}
+
+// Increased keeps the candidates that increased since the last snapshot.
+func (s *Search) Increased(ram []byte) int {
+	return s.Filter(ram, func(prev, cur int) bool { return cur > prev })
+}
+
+// Decreased keeps the candidates that decreased since the last snapshot.
+func (s *Search) Decreased(ram []byte) int {
+	return s.Filter(ram, func(prev, cur int) bool { return cur < prev })
+}
@@ -0,0 +1,86 @@
+package cheat
+
+import (
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKind(t *testing.T) {
+	a := assert.New(t)
+	ram := []byte{0xFF, 0x80}
+
+	a.Equal(255, Uint8.Get(ram, 0))
+	a.Equal(-1, Int8.Get(ram, 0))
+	a.Equal(0x80FF, Uint16.Get(ram, 0))
+	a.Equal(-0x7F01, Int16.Get(ram, 0))
+
+	Int16.Put(ram, 0, -2)
+	a.Equal([]byte{0xFE, 0xFF}, ram)
+	Uint8.Put(ram, 1, 0x12)
+	a.Equal([]byte{0xFE, 0x12}, ram)
+
+	for _, k := range []Kind{Uint8, Int8, Uint16, Int16} {
+		p, err := ParseKind(k.String())
+		a.NoError(err)
+		a.Equal(k, p)
+	}
+	_, err := ParseKind("u32")
+	a.Error(err)
+}
+
+func TestSearch(t *testing.T) {
+	a := assert.New(t)
+	ram := make([]byte, 16)
+	ram[3] = 3 // lives
+	ram[7] = 3
+
+	s := NewSearch(Uint8, ram)
+	a.Equal(16, s.Len())
+	a.Equal(2, s.Equal(ram, 3))
+
+	// Die
+	ram[3]--
+	ram[7]++
+	a.Equal(1, s.Decreased(ram))
+	a.Equal([]Result{{3, 2, 2}}, s.Results(ram))
+	a.Equal(1, s.Unchanged(ram))
+
+	ram[3] = 0xFF
+	a.Equal([]Result{{3, 2, 255}}, s.Results(ram))
+	a.Equal(1, s.Increased(ram))
+	a.Equal(0, s.Changed(ram))
+
+	s.Reset(ram)
+	a.Equal(16, s.Len())
+}
+
+func TestSearchSigned(t *testing.T) {
+	a := assert.New(t)
+	ram := make([]byte, 8)
+	put := func(addr vm.Pointer, x int) { Int16.Put(ram, addr, x) }
+	put(2, 10)
+	put(4, 10)
+
+	s := NewSearch(Int16, ram)
+	a.Equal(7, s.Len(), "words must fit in RAM")
+	put(2, -1)
+	put(4, 20)
+	a.Equal(2, s.Decreased(ram), "0xFFFF should read as -1")
+	a.Equal([]vm.Pointer{1, 2}, addrs(s.Results(ram)))
+
+	s = NewSearch(Uint16, ram)
+	a.Equal(1, s.Equal(ram, -1), "-1 should match 0xFFFF")
+	a.Equal([]Result{{2, 0xFFFF, 0xFFFF}}, s.Results(ram))
+
+	a.Equal(0, NewSearch(Uint16, ram[:1]).Len())
+}
+
+func addrs(res []Result) []vm.Pointer {
+	var a []vm.Pointer
+	for _, r := range res {
+		a = append(a, r.Addr)
+	}
+	return a
+}
@@ -0,0 +1,19 @@
+package chip16
+
+import "github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+
+// Clone returns an independent copy of the machine, in the same state, e.g.
+// to explore several futures from the same point. Memory is shared
+// copy-on-write (see vm.State.Clone), so cloning is cheap. Clones may be taken
+// from several goroutines at once, as long as the machine doesn't run
+// meanwhile.
+func (m *Machine) Clone() *Machine {
+	c := *m
+	c.v = m.v.Clone()
+	c.hook = nil
+	c.renderer = graphics.NewRenderer(m.renderer.Scale, m.renderer.Filter)
+	c.renderer.Layers = m.renderer.Layers
+	c.image = c.renderer.NewImage()
+	c.samples = append([]int16(nil), m.samples...)
+	return &c
+}
@@ -0,0 +1,61 @@
+package chip16
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+	a.NoError(m.RunFrame())
+
+	c := m.Clone()
+	a.Equal(m.State().Regs, c.State().Regs)
+	a.Equal(m.Cycles(), c.Cycles())
+
+	// Clones are independent
+	c.SetInput(0, ButtonA)
+	a.NoError(c.RunFrame())
+	c.State().RAM.Set(0x1000, 0x42)
+	c.State().Graphics.SetPixel(0, 0, 5)
+	c.State().Graphics.Palette[3].R = 0
+
+	a.Equal(int16(1), m.State().Regs[1])
+	a.Equal(int16(2), c.State().Regs[1])
+	a.Equal(byte(0), m.State().RAM.At(0x1000))
+	a.Equal(uint8(0), m.State().Graphics.Pixel(0, 0))
+	a.Equal(uint8(0xBF), m.State().Graphics.Palette[3].R)
+
+	// Both still sound the same
+	a.NoError(m.RunFrame())
+	a.Equal(m.AudioSamples(), c.AudioSamples())
+
+	mi, err := m.Framebuffer()
+	a.NoError(err)
+	ci, err := c.Framebuffer()
+	a.NoError(err)
+	a.False(mi == ci, "framebuffers shouldn't be shared")
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+	a.NoError(m.RunFrame())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := m.Clone()
+			c.SetInput(0, ButtonA)
+			a.NoError(c.RunFrame())
+			a.Equal(int16(2), c.State().Regs[1])
+		}()
+	}
+	wg.Wait()
+	a.Equal(int16(1), m.State().Regs[1])
+}
@@ -6,6 +6,19 @@ import (
 	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
 )
 
+const (
+	// ClockRate is the CPU frequency (in Hz)
+	ClockRate = 1000000
+
+	// FrameRate is the number of frames per second
+	FrameRate = 60
+
+	// CyclesPerFrame is the number of cycles in a frame, rounded down: as
+	// ClockRate isn't a multiple of FrameRate, some frames last one more
+	// cycle (see RunFrame).
+	CyclesPerFrame = ClockRate / FrameRate
+)
+
 type opCallback func(*vm.State, vm.Opcode) error
 
 type operation struct {
@@ -25,6 +38,11 @@ func setOp(code byte, desc string, exec opCallback) {
 	cpuOps[c] = &operation{code, desc, exec}
 }
 
+// Known tells whether an operation is registered for the given leading byte
+func Known(op int) bool {
+	return op >= 0 && op < len(cpuOps) && cpuOps[op] != nil
+}
+
 // Eval evaluates an Opcode
 func Eval(v *vm.State, o vm.Opcode) error {
 	op := o.Op()
@@ -38,3 +56,61 @@ func Eval(v *vm.State, o vm.Opcode) error {
 
 	return v.Check()
 }
+
+// Step fetches the instruction at PC, moves PC to the next instruction and
+// evaluates the fetched one. The cycles it took are added to the cycle
+// counter, then the VM's hook is called, if any.
+func Step(v *vm.State) error {
+	if uint16(v.PC) > vm.StackStart-4 {
+		return fmt.Errorf("PC overflow: PC = %#04x", v.PC)
+	}
+	pc, sp := v.PC, v.SP
+	o := vm.ReadOpcode(v.RAM.View(pc, 4))
+	v.PC += 4
+	if err := Eval(v, o); err != nil {
+		return err
+	}
+	cycles := uint64(1)
+	if v.Timing != nil {
+		if cycles = v.Timing(v, o); cycles == 0 {
+			cycles = 1
+		}
+	}
+	v.Cycles += cycles
+	if v.Hook != nil {
+		v.Hook(v, vm.Executed{PC: pc, SP: sp, Op: o, Cycles: cycles})
+	}
+	return nil
+}
+
+// RunFrame runs the CPU until the end of the current frame. Frame n ends at
+// cycle (n+1)*ClockRate/FrameRate, rounded down, so that FrameRate frames
+// last exactly ClockRate cycles.
+//
+// When the program waits for the vertical blank with VBLNK, the CPU idles
+// until the end of the frame. Instructions that overrun the frame eat into
+// the next one.
+func RunFrame(v *vm.State) error {
+	end := frameEnd(v.Cycles)
+	v.WaitVBlank = false
+	for v.Cycles < end && !v.WaitVBlank {
+		if err := Step(v); err != nil {
+			return err
+		}
+	}
+	if v.Cycles < end {
+		v.Cycles = end
+	}
+	return nil
+}
+
+// frameEnd returns the cycle at which the frame running at the given cycle
+// ends
+func frameEnd(cycles uint64) uint64 {
+	start := func(n uint64) uint64 { return n * ClockRate / FrameRate }
+	n := cycles * FrameRate / ClockRate
+	if start(n+1) <= cycles {
+		n++
+	}
+	return start(n + 1)
+}
@@ -61,3 +61,92 @@ func BenchmarkEvalNop(b *testing.B) {
 		Eval(v, vm.Opcode(0x000000))
 	}
 }
+
+func TestStep(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	v.RAM.Write(0, []byte{0x20, 0x01, 0x37, 0x13}) // LDI R1, 0x1337
+	if a.NoError(Step(v)) {
+		a.Equal(vm.Pointer(4), v.PC, "PC didn't move to the next instruction")
+		a.Equal(int16(0x1337), v.Regs[1])
+		a.Equal(uint64(1), v.Cycles)
+	}
+
+	v.PC = vm.StackStart - 2
+	a.Error(Step(v), "fetching past the stack start should yield an error")
+}
+
+func TestStepHook(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+	var executed []vm.Executed
+	v.Hook = func(v *vm.State, e vm.Executed) { executed = append(executed, e) }
+	v.Timing = func(v *vm.State, o vm.Opcode) uint64 { return 3 }
+
+	v.RAM.Write(0, []byte{
+		0x14, 0x00, 0x10, 0x00, // CALL 0x0010
+		0xFF, 0x00, 0x00, 0x00, // invalid
+	})
+	a.NoError(Step(v))
+	v.PC = 4
+	a.Error(Step(v))
+	a.Equal([]vm.Executed{{PC: 0, SP: vm.StackStart, Op: 0x14001000, Cycles: 3}}, executed,
+		"only successful instructions should be hooked")
+}
+
+func TestRunFrame(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	// Infinite loop
+	v.RAM.Write(0, []byte{0x10, 0x00, 0x00, 0x00}) // JMP 0x0000
+	a.NoError(RunFrame(v))
+	a.Equal(uint64(CyclesPerFrame), v.Cycles)
+
+	// Count frames
+	v.RAM.Write(0, []byte{
+		0x02, 0x00, 0x00, 0x00, // VBLNK
+		0x40, 0x01, 0x01, 0x00, // ADDI R1, 1
+		0x10, 0x00, 0x00, 0x00, // JMP 0x0000
+	})
+	for i := 0; i < 3; i++ {
+		a.NoError(RunFrame(v))
+	}
+	a.Equal(int16(2), v.Regs[1], "should have run 2 frames after the first VBLNK")
+	a.Equal(vm.Pointer(4), v.PC, "should be waiting after VBLNK")
+	a.Equal(uint64(4*ClockRate/FrameRate), v.Cycles, "should idle until the end of frames")
+
+	// Overruns eat into the next frame
+	v.PC = 0
+	v.Cycles = 0
+	v.Timing = func(v *vm.State, o vm.Opcode) uint64 { return CyclesPerFrame + 10 }
+	a.NoError(RunFrame(v))
+	a.Equal(uint64(CyclesPerFrame+10), v.Cycles)
+	a.Equal(vm.Pointer(4), v.PC, "VBLNK took the whole frame")
+	a.NoError(RunFrame(v))
+	a.Equal(uint64(2*CyclesPerFrame+20), v.Cycles)
+	a.Equal(vm.Pointer(8), v.PC, "the rest of the frame should run a single instruction")
+	v.Timing = nil
+
+	v.RAM.Write(0, []byte{0xFF, 0x00, 0x00, 0x00})
+	v.PC = 0
+	a.Error(RunFrame(v), "errors should stop the frame")
+}
+
+func TestFrameEnd(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(uint64(16666), frameEnd(0))
+	a.Equal(uint64(16666), frameEnd(16665))
+	a.Equal(uint64(33333), frameEnd(16666))
+	a.Equal(uint64(50000), frameEnd(33333))
+	a.Equal(uint64(66666), frameEnd(50000))
+
+	// A second lasts exactly ClockRate cycles
+	v := vm.NewState()
+	v.RAM.Write(0, []byte{0x10, 0x00, 0x00, 0x00}) // JMP 0x0000
+	for i := 0; i < 2*FrameRate; i++ {
+		a.NoError(RunFrame(v))
+	}
+	a.Equal(uint64(2*ClockRate), v.Cycles)
+}
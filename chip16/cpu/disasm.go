@@ -0,0 +1,88 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Condition mnemonics, by index (see vm.CPUFlags.Condition)
+var conditions = [...]string{
+	"Z", "NZ", "N", "NN", "P", "O", "NO", "A",
+	"AE", "B", "BE", "G", "GE", "L", "LE",
+}
+
+// Operations whose HHLL argument is an address
+var addressOps = map[int]bool{
+	0x05: true, // DRW Rx, Ry, HHLL
+	0x10: true, // JMP HHLL
+	0x11: true, // JMC HHLL
+	0x12: true, // Jx HHLL
+	0x13: true, // JME Rx, Ry, HHLL
+	0x14: true, // CALL HHLL
+	0x17: true, // Cx HHLL
+	0x22: true, // LDM Rx, HHLL
+	0x30: true, // STM Rx, HHLL
+	0xD0: true, // PAL HHLL
+}
+
+// Disassemble returns the assembly representation of an Opcode.
+//
+// Unknown opcodes are rendered as raw data (db).
+func Disassemble(o vm.Opcode) string {
+	return DisassembleWith(o, nil)
+}
+
+// DisassembleWith works like Disassemble, but renders address arguments
+// using symbolize (e.g. to display labels instead of raw addresses).
+func DisassembleWith(o vm.Opcode, symbolize func(vm.Pointer) string) string {
+	inst := cpuOps[o.Op()]
+	if inst == nil {
+		return fmt.Sprintf(
+			"db 0x%02X, 0x%02X, 0x%02X, 0x%02X",
+			uint8(o>>24), uint8(o>>16), uint8(o>>8), uint8(o),
+		)
+	}
+
+	fields := strings.SplitN(inst.Description, " ", 2)
+	mnemonic := fields[0]
+	switch mnemonic {
+	case "Jx", "Cx":
+		if int(o.X()) < len(conditions) {
+			mnemonic = mnemonic[:1] + conditions[o.X()]
+		} else {
+			mnemonic = mnemonic[:1] + "?"
+		}
+	}
+	if len(fields) == 1 {
+		return mnemonic
+	}
+
+	args := strings.Split(fields[1], ", ")
+	for i, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "RX":
+			args[i] = fmt.Sprintf("R%X", o.X())
+		case "RY":
+			args[i] = fmt.Sprintf("R%X", o.Y())
+		case "RZ":
+			args[i] = fmt.Sprintf("R%X", o.Z())
+		case "HHLL":
+			if symbolize != nil && addressOps[o.Op()] {
+				args[i] = symbolize(vm.Pointer(o.HHLL()))
+			} else {
+				args[i] = fmt.Sprintf("0x%04X", o.HHLL())
+			}
+		case "HH", "SR":
+			args[i] = fmt.Sprintf("0x%02X", o.HH())
+		case "AD":
+			args[i] = fmt.Sprintf("0x%02X", o.Y()<<4|o.X())
+		case "VT":
+			args[i] = fmt.Sprintf("0x%02X", o.LL())
+		case "N":
+			args[i] = fmt.Sprintf("%d", o.N())
+		}
+	}
+	return mnemonic + " " + strings.Join(args, ", ")
+}
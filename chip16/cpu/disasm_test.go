@@ -0,0 +1,51 @@
+package cpu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	a := assert.New(t)
+
+	for _, test := range []struct {
+		o   vm.Opcode
+		exp string
+	}{
+		{0x00000000, "NOP"},
+		{0x10003713, "JMP 0x1337"},
+		{0x12013713, "JNZ 0x1337"},
+		{0x170D3713, "CL 0x1337"},
+		{0x120F3713, "J? 0x1337"},
+		{0x40013713, "ADDI R1, 0x1337"},
+		{0x42A10F00, "ADD R1, RA, RF"},
+		{0x13453713, "JME R5, R4, 0x1337"},
+		{0x03000400, "BGC 4"},
+		{0xB1020300, "SHR R2, 3"},
+		{0x08000003, "FLIP 0x03"},
+		{0x21003713, "LDI SP, 0x1337"},
+		{0x0E12F334, "SNG 0x12, 0xF3, 0x34"},
+		{0x0D02E803, "SNP R2, 0x03E8"},
+		{0xFF123456, "db 0xFF, 0x12, 0x34, 0x56"},
+	} {
+		a.Equal(test.exp, Disassemble(test.o))
+	}
+}
+
+func TestDisassembleWith(t *testing.T) {
+	a := assert.New(t)
+
+	symbolize := func(p vm.Pointer) string { return fmt.Sprintf("label_%d", p) }
+	a.Equal("CALL label_16", DisassembleWith(vm.Opcode(0x14001000), symbolize))
+	a.Equal("LDI R0, 0x0010", DisassembleWith(vm.Opcode(0x20001000), symbolize))
+	a.Equal("NOP", DisassembleWith(vm.Opcode(0x00000000), symbolize))
+}
+
+func BenchmarkDisassemble(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		Disassemble(vm.Opcode(0x42A10F00))
+	}
+}
@@ -3,6 +3,7 @@ package cpu
 import "github.com/ArnaudCalmettes/go-chip16/chip16/vm"
 
 func call(v *vm.State, p vm.Pointer) {
+	v.EnterCall(vm.Frame{Caller: v.PC - 4, Target: p, SP: v.SP})
 	v.PutPointerAt(v.PC, v.SP)
 	v.SP += 2
 	v.PC = p
@@ -48,10 +49,16 @@ func callHHLL(v *vm.State, o vm.Opcode) error {
 
 // Return from function call
 func ret(v *vm.State, _ vm.Opcode) error {
-	var err error
-	v.SP -= 2
-	v.PC, err = v.PointerAt(v.SP)
-	return err
+	sp := v.SP - 2
+	pc, err := v.PointerAt(sp)
+	if err != nil {
+		return err
+	}
+	if err = v.LeaveCall(sp, pc); err != nil && v.StrictCalls {
+		return err
+	}
+	v.SP, v.PC = sp, pc
+	return nil
 }
 
 // Unconditional jump to Rx
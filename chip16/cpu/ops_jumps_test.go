@@ -194,6 +194,27 @@ func TestRet(t *testing.T) {
 	}
 }
 
+func TestRetMismatch(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	v.PC = vm.Pointer(0x0004)
+	a.NoError(Eval(v, vm.Opcode(0x14003713))) // CALL 1337
+	a.Equal([]vm.Frame{{Caller: 0x0000, Target: 0x1337, SP: vm.StackStart}}, v.Backtrace())
+	a.NoError(Eval(v, vm.Opcode(0xC0000000))) // PUSH R0
+
+	// Returning with data on the stack only fails in strict mode
+	v.StrictCalls = true
+	a.IsType(&vm.CallMismatchError{}, ret(v, vm.Opcode(0x15000000)))
+	a.Equal(vm.Pointer(vm.StackStart+4), v.SP, "SP shouldn't move on failure")
+
+	v.StrictCalls = false
+	if a.NoError(Eval(v, vm.Opcode(0x15000000))) {
+		a.Equal(vm.Pointer(0x0000), v.PC)
+		a.Len(v.Calls, 1, "the call should still be outstanding")
+	}
+}
+
 func BenchmarkRet(b *testing.B) {
 	v := vm.NewState()
 	for n := 0; n < b.N; n++ {
@@ -15,12 +15,25 @@ func cls(v *vm.State, _ vm.Opcode) error {
 	return nil
 }
 
+// Wait for the vertical blank
+func vblnk(v *vm.State, _ vm.Opcode) error {
+	v.WaitVBlank = true
+	return nil
+}
+
+// sprite returns the data of the current sprite, stored at addr (truncated
+// at the end of memory)
+func sprite(v *vm.State, addr vm.Pointer) []byte {
+	g := v.Graphics
+	return v.RAM.View(addr, int(g.SpriteW)*int(g.SpriteH))
+}
+
 // Draw sprite from [HHLL] at (Rx, Ry)
 func drwRxRyHHLL(v *vm.State, o vm.Opcode) error {
 	c, err := v.Graphics.DrawSprite(
 		int(v.Regs[o.X()]),
 		int(v.Regs[o.Y()]),
-		v.RAM[o.HHLL():],
+		sprite(v, vm.Pointer(o.HHLL())),
 	)
 	v.Flags.SetCarry(c)
 	return err
@@ -31,7 +44,7 @@ func drwRxRyRz(v *vm.State, o vm.Opcode) error {
 	c, err := v.Graphics.DrawSprite(
 		int(v.Regs[o.X()]),
 		int(v.Regs[o.Y()]),
-		v.RAM[uint16(o.Z()):],
+		sprite(v, vm.Pointer(v.Regs[o.Z()])),
 	)
 	v.Flags.SetCarry(c)
 	return err
@@ -67,17 +80,11 @@ func flip(v *vm.State, o vm.Opcode) error {
 func init() {
 	setOp(0x00, "NOP", nop)
 	setOp(0x01, "CLS", cls)
-	// VBLNK
+	setOp(0x02, "VBLNK", vblnk)
 	setOp(0x03, "BGC N", bgcN)
 	setOp(0x04, "SPR HHLL", sprHHLL)
 	setOp(0x05, "DRW RX, RY, HHLL", drwRxRyHHLL)
 	setOp(0x06, "DRW RX, RY, RZ", drwRxRyRz)
 	setOp(0x07, "RND Rx, HHLL", rndRxHHLL)
 	setOp(0x08, "FLIP HH", flip)
-	// SND0
-	// SND1 HHLL
-	// SND2 HHLL
-	// SND3 HHLL
-	// SNP Rx, HHLL
-	// SNG AD VT SR
 }
@@ -63,6 +63,17 @@ func BenchmarkSprHHLL(b *testing.B) {
 	}
 }
 
+// VBLNK
+func TestVblnk(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	if a.NoError(Eval(v, vm.Opcode(0x02000000))) {
+		a.True(v.WaitVBlank, "VBLNK should wait for the vertical blank")
+		a.Equal(vm.Pointer(0), v.PC, "PC shouldn't move")
+	}
+}
+
 // DRW Rx, Ry, HHLL
 func TestDrwRxRyHHLL(t *testing.T) {
 	a := assert.New(t)
@@ -81,12 +92,30 @@ func TestDrwRxRyHHLL(t *testing.T) {
 	a.NoError(Eval(v, vm.Opcode(0x05000000)))
 }
 
+// DRW Rx, Ry, Rz
+func TestDrwRxRyRz(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	v.Graphics.SpriteW = 1
+	v.Graphics.SpriteH = 1
+	v.RAM.Set(0x1337, 0x12)
+	v.Regs[0] = 10
+	v.Regs[1] = 20
+	v.Regs[2] = 0x1337
+	if a.NoError(Eval(v, vm.Opcode(0x06100200))) {
+		a.Equal(uint8(0x1), v.Graphics.Pixel(10, 20))
+		a.Equal(uint8(0x2), v.Graphics.Pixel(11, 20))
+		a.False(v.Flags.Carry())
+	}
+}
+
 func BenchmarkDrwRxRyHHLL(b *testing.B) {
 	v := vm.NewState()
 
 	// fill RAM with non-null pixels
 	for i := 0; i < vm.StackStart; i++ {
-		v.RAM[i] = 0xAA
+		v.RAM.Set(vm.Pointer(i), 0xAA)
 	}
 
 	benches := []uint8{4, 8, 16, 32, 64, 128}
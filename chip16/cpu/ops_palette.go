@@ -1,19 +1,20 @@
 package cpu
 
 import (
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
 	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
 )
 
 // Load palette from [HHLL]
 func palHHLL(v *vm.State, o vm.Opcode) error {
-	addr := o.HHLL()
-	return v.Graphics.LoadPalette(v.RAM[addr:])
+	addr := vm.Pointer(o.HHLL())
+	return v.Graphics.LoadPalette(v.RAM.View(addr, graphics.PaletteSize))
 }
 
 // Load palette from [Rx]
 func palRx(v *vm.State, o vm.Opcode) error {
-	addr := uint16(v.Regs[o.X()])
-	return v.Graphics.LoadPalette(v.RAM[addr:])
+	addr := vm.Pointer(v.Regs[o.X()])
+	return v.Graphics.LoadPalette(v.RAM.View(addr, graphics.PaletteSize))
 }
 
 func init() {
@@ -10,7 +10,7 @@ import (
 
 func setupTestPalette(v *vm.State) {
 	for i := 0; i < graphics.PaletteSize; i++ {
-		v.RAM[0x1337+i] = byte(i)
+		v.RAM.Set(vm.Pointer(0x1337+i), byte(i))
 	}
 }
 
@@ -0,0 +1,59 @@
+package cpu
+
+import (
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Stop playing sounds
+func snd0(v *vm.State, _ vm.Opcode) error {
+	v.Audio.Stop()
+	return nil
+}
+
+// Play 500Hz tone for HHLL ms
+func snd1(v *vm.State, o vm.Opcode) error {
+	v.Audio.Tone(500, int(o.HHLL()))
+	return nil
+}
+
+// Play 1000Hz tone for HHLL ms
+func snd2(v *vm.State, o vm.Opcode) error {
+	v.Audio.Tone(1000, int(o.HHLL()))
+	return nil
+}
+
+// Play 1500Hz tone for HHLL ms
+func snd3(v *vm.State, o vm.Opcode) error {
+	v.Audio.Tone(1500, int(o.HHLL()))
+	return nil
+}
+
+// Play tone from [Rx] for HHLL ms, following the SNG parameters
+func snpRxHHLL(v *vm.State, o vm.Opcode) error {
+	freq, err := v.Int16At(vm.Pointer(v.Regs[o.X()]))
+	if err != nil {
+		return err
+	}
+	v.Audio.Play(int(uint16(freq)), int(o.HHLL()))
+	return nil
+}
+
+// Set sound generation parameters: attack A, decay D, volume V, waveform T,
+// sustain S and release R
+func sng(v *vm.State, o vm.Opcode) error {
+	a := v.Audio
+	a.Attack, a.Decay = o.Y(), o.X()
+	a.Volume, a.Wave = o.LL()>>4, audio.Waveform(o.LL()&0x0F)
+	a.Sustain, a.Release = o.HH()>>4, o.HH()&0x0F
+	return nil
+}
+
+func init() {
+	setOp(0x09, "SND0", snd0)
+	setOp(0x0A, "SND1 HHLL", snd1)
+	setOp(0x0B, "SND2 HHLL", snd2)
+	setOp(0x0C, "SND3 HHLL", snd3)
+	setOp(0x0D, "SNP Rx, HHLL", snpRxHHLL)
+	setOp(0x0E, "SNG AD, VT, SR", sng)
+}
@@ -0,0 +1,58 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// SND0, SND1, SND2, SND3
+
+func TestSnd(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	for _, op := range []vm.Opcode{0x0A006400, 0x0B006400, 0x0C006400} {
+		if a.NoError(Eval(v, op)) {
+			a.True(v.Audio.Playing(), "%08X should play a tone", uint32(op))
+		}
+		if a.NoError(Eval(v, vm.Opcode(0x09000000))) {
+			a.False(v.Audio.Playing(), "SND0 should stop the tone")
+		}
+	}
+}
+
+// SNP Rx, HHLL
+
+func TestSnpRxHHLL(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	v.Regs[2] = 0x1000
+	v.PutInt16At(440, 0x1000)
+	if a.NoError(Eval(v, vm.Opcode(0x0D02E803))) {
+		a.True(v.Audio.Playing())
+	}
+
+	v.Regs[2] = -1 // 0xFFFF
+	a.Error(Eval(v, vm.Opcode(0x0D02E803)), "reading the frequency out of bounds should fail")
+}
+
+// SNG AD, VT, SR
+
+func TestSng(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	if a.NoError(Eval(v, vm.Opcode(0x0E12F334))) {
+		s := v.Audio
+		a.Equal(uint8(1), s.Attack)
+		a.Equal(uint8(2), s.Decay)
+		a.Equal(uint8(0xF), s.Volume)
+		a.Equal(audio.Noise, s.Wave)
+		a.Equal(uint8(3), s.Sustain)
+		a.Equal(uint8(4), s.Release)
+	}
+}
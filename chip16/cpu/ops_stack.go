@@ -1,7 +1,6 @@
 package cpu
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
@@ -36,7 +35,7 @@ func pushAll(v *vm.State, o vm.Opcode) error {
 		return errStackOverflow
 	}
 	for _, rx := range v.Regs {
-		binary.LittleEndian.PutUint16(v.RAM[v.SP:], uint16(rx))
+		v.RAM.PutUint16(v.SP, uint16(rx))
 		v.SP += 2
 	}
 	return nil
@@ -49,7 +48,7 @@ func popAll(v *vm.State, o vm.Opcode) error {
 	}
 	for i := len(v.Regs) - 1; i >= 0; i-- {
 		v.SP -= 2
-		v.Regs[i] = int16(binary.LittleEndian.Uint16(v.RAM[v.SP:]))
+		v.Regs[i] = int16(v.RAM.Uint16(v.SP))
 	}
 	return nil
 }
@@ -59,7 +58,7 @@ func pushF(v *vm.State, o vm.Opcode) error {
 	if v.SP >= vm.IOStart {
 		return errStackOverflow
 	}
-	v.RAM[v.SP] = uint8(v.Flags)
+	v.RAM.Set(v.SP, uint8(v.Flags))
 	v.SP += 2
 	return nil
 }
@@ -70,7 +69,7 @@ func popF(v *vm.State, o vm.Opcode) error {
 		return errStackUnderflow
 	}
 	v.SP -= 2
-	v.Flags = vm.CPUFlags(v.RAM[v.SP])
+	v.Flags = vm.CPUFlags(v.RAM.At(v.SP))
 	return nil
 }
 
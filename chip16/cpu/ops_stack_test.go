@@ -113,7 +113,7 @@ func TestPopAll(t *testing.T) {
 	v := vm.NewState()
 
 	for i := 0; i < 16; i++ {
-		v.RAM[vm.StackStart+2*i] = byte(i)
+		v.RAM.Set(vm.Pointer(vm.StackStart+2*i), byte(i))
 	}
 	v.SP += 32
 	if a.NoError(Eval(v, vm.Opcode(0xC3000000))) {
@@ -150,7 +150,7 @@ func TestPushF(t *testing.T) {
 	if a.NoError(Eval(v, vm.Opcode(0xC4000000))) {
 		a.Equal(vm.Pointer(vm.RAMStart), v.PC, "PC shouldn't move")
 		a.Equal(vm.Pointer(vm.StackStart+2), v.SP, "SP didn't move")
-		a.Equal(vm.CPUFlags(0xAA), vm.CPUFlags(v.RAM[vm.StackStart]))
+		a.Equal(vm.CPUFlags(0xAA), vm.CPUFlags(v.RAM.At(vm.StackStart)))
 	}
 
 	v.SP = vm.IOStart
@@ -177,7 +177,7 @@ func TestPopF(t *testing.T) {
 	a := assert.New(t)
 	v := vm.NewState()
 
-	v.RAM[v.SP] = 0xAA
+	v.RAM.Set(v.SP, 0xAA)
 	v.SP += 2
 
 	if a.NoError(Eval(v, vm.Opcode(0xC5000000))) {
@@ -202,3 +202,23 @@ func BenchmarkPopF(b *testing.B) {
 		}
 	}
 }
+
+// Pushes on a clone write to its own copy of memory
+
+func TestPushClone(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+	v.Regs[0] = 0x1337
+	v.Flags.SetCarry(true)
+	c := v.Clone()
+
+	for _, o := range []vm.Opcode{0xC2000000, 0xC4000000} {
+		if !a.NoError(Eval(c, o)) {
+			return
+		}
+	}
+	x, _ := c.Int16At(vm.StackStart)
+	a.Equal(int16(0x1337), x)
+	a.NotZero(c.RAM.At(vm.StackStart + 32))
+	a.Equal(make([]byte, 34), v.RAM.View(vm.StackStart, 34))
+}
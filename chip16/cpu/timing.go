@@ -0,0 +1,57 @@
+package cpu
+
+import "github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+
+// Timing returns the number of cycles taken by an instruction. It is called
+// once the instruction is executed. Zero counts as one cycle, so that frames
+// always end.
+type Timing func(v *vm.State, o vm.Opcode) uint64
+
+// Fixed returns the timing of instructions taking n cycles.
+func Fixed(n uint64) Timing {
+	return func(*vm.State, vm.Opcode) uint64 {
+		return n
+	}
+}
+
+// SpriteTiming returns the timing of DRW instructions taking base cycles,
+// plus perByte cycles per byte of the drawn sprite.
+func SpriteTiming(base, perByte uint64) Timing {
+	return func(v *vm.State, o vm.Opcode) uint64 {
+		g := v.Graphics
+		return base + perByte*uint64(g.SpriteW)*uint64(g.SpriteH)
+	}
+}
+
+// Timings is a table of instruction timings, indexed by operation (leading
+// byte). Operations without a timing take one cycle.
+//
+// Timings can be tuned to match other emulators, e.g. to charge sprite draws
+// by size:
+//
+//		t := cpu.SpecTimings()
+//		t[0x05] = cpu.SpriteTiming(1, 1) // DRW Rx, Ry, HHLL
+//		t[0x06] = cpu.SpriteTiming(1, 1) // DRW Rx, Ry, Rz
+//		v.Timing = t.Cycles
+type Timings [256]Timing
+
+// SpecTimings returns a table where every instruction takes one cycle, as per
+// spec.
+func SpecTimings() *Timings {
+	t := new(Timings)
+	for op := range t {
+		if cpuOps[op] != nil {
+			t[op] = Fixed(1)
+		}
+	}
+	return t
+}
+
+// Cycles returns the number of cycles taken by an executed instruction. It
+// can be used as a vm.State's Timing.
+func (t *Timings) Cycles(v *vm.State, o vm.Opcode) uint64 {
+	if timing := t[o.Op()]; timing != nil {
+		return timing(v, o)
+	}
+	return 1
+}
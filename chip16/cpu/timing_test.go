@@ -0,0 +1,51 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimings(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	tm := SpecTimings()
+	for op := 0; op < 256; op++ {
+		a.Equalf(Known(op), tm[op] != nil, "(%#02x) wrong timing", op)
+	}
+	tm[0x05] = SpriteTiming(2, 3)
+	tm[0x01] = Fixed(100)
+	v.Timing = tm.Cycles
+
+	v.Graphics.SpriteW, v.Graphics.SpriteH = 4, 8
+	v.RAM.Write(0, []byte{
+		0x00, 0x00, 0x00, 0x00, // NOP
+		0x05, 0x10, 0x00, 0x10, // DRW R0, R1, 0x1000
+		0x01, 0x00, 0x00, 0x00, // CLS
+		0xFF, 0x00, 0x00, 0x00, // Unknown
+	})
+	for _, cycles := range []uint64{1, 1 + 2 + 3*4*8, 1 + 2 + 3*4*8 + 100} {
+		if a.NoError(Step(v)) {
+			a.Equal(cycles, v.Cycles)
+		}
+	}
+	a.Error(Step(v))
+	a.Equal(uint64(1+2+3*4*8+100), v.Cycles, "failed instructions take no cycles")
+
+	a.Equal(uint64(1), tm.Cycles(v, vm.Opcode(0xFF000000)), "unknown operations take one cycle")
+}
+
+func TestZeroTiming(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+	v.RAM.Write(0, []byte{0x10, 0x00, 0x00, 0x00}) // JMP 0x0000
+
+	tm := SpecTimings()
+	tm[0x10] = Fixed(0)
+	v.Timing = tm.Cycles
+	a.NoError(Step(v))
+	a.Equal(uint64(1), v.Cycles, "instructions should take at least one cycle")
+	a.NoError(RunFrame(v), "frames should end")
+}
@@ -0,0 +1,546 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/rom"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// We only have one thread of execution
+const threadID = 1
+
+// Variable references of the scopes
+const (
+	refRegisters = iota + 1
+	refFlags
+	refStack
+)
+
+// session is a Debug Adapter Protocol session
+type session struct {
+	d    *debugger.Debugger
+	syms *symbols.Table
+	root vm.Pointer // entry of the outermost function
+
+	stopOnEntry bool
+	breakpoints map[string][]vm.Pointer // by source path
+
+	mu      sync.Mutex // protects w, seq and running
+	w       io.Writer
+	seq     int
+	running bool
+	wg      sync.WaitGroup
+
+	// pausing is set to stop the running target. It also stops runs that
+	// didn't start yet.
+	pausing int32
+}
+
+// Serve runs a Debug Adapter Protocol session over rw, until the client
+// disconnects or the connection gets closed.
+//
+// syms maps source lines to addresses and names functions. It may be nil,
+// and can be replaced by the "symbols" attribute of the launch request,
+// along with the ROM, which can be loaded from the "program" attribute.
+func Serve(rw io.ReadWriter, d *debugger.Debugger, syms *symbols.Table) error {
+	if syms == nil {
+		syms = symbols.New()
+	}
+	s := &session{
+		d:           d,
+		syms:        syms,
+		root:        d.State.PC,
+		breakpoints: make(map[string][]vm.Pointer),
+		w:           rw,
+	}
+	defer s.wg.Wait()
+
+	r := bufio.NewReader(rw)
+	for {
+		b, err := readMessage(r)
+		if err == io.EOF {
+			s.interrupt()
+			return nil
+		} else if err != nil {
+			s.interrupt()
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			s.interrupt()
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if done, err := s.handle(&req); err != nil || done {
+			s.interrupt()
+			return err
+		}
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr and serves DAP
+// sessions, one at a time. Sessions that fail are logged, and don't stop the
+// server.
+func ListenAndServe(addr string, d *debugger.Debugger, syms *symbols.Table) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = Serve(nc, d, syms)
+		nc.Close()
+		if err != nil {
+			log.Printf("dap: %s: %s", nc.RemoteAddr(), err)
+		}
+	}
+}
+
+func (s *session) send(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	return writeMessage(s.w, msg)
+}
+
+func (s *session) respond(req *request, body interface{}) error {
+	return s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    true,
+		Command:    req.Command,
+		Body:       body,
+	})
+}
+
+func (s *session) fail(req *request, format string, args ...interface{}) error {
+	return s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (s *session) emit(name string, body interface{}) error {
+	return s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *session) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// pause stops the machine if it's running
+func (s *session) pause() {
+	if s.isRunning() {
+		atomic.StoreInt32(&s.pausing, 1)
+	}
+}
+
+// interrupt stops the machine if it's running, and waits for it
+func (s *session) interrupt() {
+	s.pause()
+	s.wg.Wait()
+}
+
+// handle processes a request, and tells whether the session is over
+func (s *session) handle(req *request) (bool, error) {
+	switch req.Command {
+	case "pause":
+		s.pause()
+		return false, s.respond(req, nil)
+
+	case "disconnect", "terminate":
+		s.interrupt()
+		return true, s.respond(req, nil)
+
+	case "threads":
+		return false, s.respond(req, map[string]interface{}{
+			"threads": []thread{{threadID, "chip16"}},
+		})
+	}
+
+	if s.isRunning() {
+		return false, s.fail(req, "%s: target is running", req.Command)
+	}
+
+	switch req.Command {
+	case "initialize":
+		if err := s.respond(req, capabilities{true, true, true}); err != nil {
+			return false, err
+		}
+		return false, s.emit("initialized", nil)
+
+	case "launch", "attach":
+		var args launchArguments
+		if err := req.decode(&args); err != nil {
+			return false, s.fail(req, "bad arguments: %s", err)
+		}
+		if err := s.launch(&args); err != nil {
+			return false, s.fail(req, "%s", err)
+		}
+		return false, s.respond(req, nil)
+
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := req.decode(&args); err != nil {
+			return false, s.fail(req, "bad arguments: %s", err)
+		}
+		return false, s.respond(req, map[string]interface{}{
+			"breakpoints": s.setBreakpoints(&args),
+		})
+
+	case "setExceptionBreakpoints":
+		return false, s.respond(req, nil)
+
+	case "configurationDone":
+		if err := s.respond(req, nil); err != nil {
+			return false, err
+		}
+		if s.stopOnEntry {
+			return false, s.stopped("entry", "")
+		}
+		s.run(nil)
+		return false, nil
+
+	case "continue":
+		if err := s.respond(req, map[string]bool{"allThreadsContinued": true}); err != nil {
+			return false, err
+		}
+		s.run(nil)
+		return false, nil
+
+	case "next", "stepIn", "stepOut":
+		if err := s.respond(req, nil); err != nil {
+			return false, err
+		}
+		s.run(s.stepper(req.Command))
+		return false, nil
+
+	case "stackTrace":
+		frames := s.stackTrace()
+		return false, s.respond(req, map[string]interface{}{
+			"stackFrames": frames,
+			"totalFrames": len(frames),
+		})
+
+	case "scopes":
+		return false, s.respond(req, map[string]interface{}{
+			"scopes": []scope{
+				{"Registers", refRegisters, false},
+				{"Flags", refFlags, false},
+				{"Stack", refStack, false},
+			},
+		})
+
+	case "variables":
+		var args variablesArguments
+		if err := req.decode(&args); err != nil {
+			return false, s.fail(req, "bad arguments: %s", err)
+		}
+		return false, s.respond(req, map[string]interface{}{
+			"variables": s.variables(args.VariablesReference),
+		})
+
+	case "readMemory":
+		var args readMemoryArguments
+		if err := req.decode(&args); err != nil {
+			return false, s.fail(req, "bad arguments: %s", err)
+		}
+		addr, n, err := s.memoryRange(args.MemoryReference, args.Offset, args.Count)
+		if err != nil {
+			return false, s.fail(req, "%s", err)
+		}
+		return false, s.respond(req, map[string]interface{}{
+			"address":         memoryReference(vm.Pointer(addr)),
+			"data":            base64.StdEncoding.EncodeToString(s.d.State.RAM.View(vm.Pointer(addr), n)),
+			"unreadableBytes": args.Count - n,
+		})
+
+	case "writeMemory":
+		var args writeMemoryArguments
+		if err := req.decode(&args); err != nil {
+			return false, s.fail(req, "bad arguments: %s", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(args.Data)
+		if err != nil {
+			return false, s.fail(req, "bad data: %s", err)
+		}
+		addr, n, err := s.memoryRange(args.MemoryReference, args.Offset, len(data))
+		if err != nil {
+			return false, s.fail(req, "%s", err)
+		}
+		s.d.State.RAM.Write(vm.Pointer(addr), data[:n])
+		return false, s.respond(req, map[string]int{"bytesWritten": n})
+	}
+
+	return false, s.fail(req, "unsupported request %q", req.Command)
+}
+
+func (s *session) launch(args *launchArguments) error {
+	if args.Program != "" {
+		f, err := os.Open(args.Program)
+		if err != nil {
+			return err
+		}
+		r, err := rom.Read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", args.Program, err)
+		}
+		if err := r.Load(s.d.State); err != nil {
+			return err
+		}
+	}
+	if args.Symbols != "" {
+		syms, err := symbols.Load(args.Symbols)
+		if err != nil {
+			return err
+		}
+		s.syms = syms
+	}
+	s.stopOnEntry = args.StopOnEntry
+	s.root = s.d.State.PC
+	s.d.State.Calls = nil
+	return nil
+}
+
+func (s *session) setBreakpoints(args *setBreakpointsArguments) []breakpoint {
+	path := s.syms.Path(args.Source.Path)
+	for _, addr := range s.breakpoints[path] {
+		s.d.ClearBreakpoint(addr)
+	}
+	s.breakpoints[path] = nil
+
+	bps := make([]breakpoint, len(args.Breakpoints))
+	for i, sb := range args.Breakpoints {
+		addrs := s.syms.Addresses(args.Source.Path, sb.Line)
+		if len(addrs) == 0 {
+			bps[i] = breakpoint{Line: sb.Line, Message: "no code at this line"}
+			continue
+		}
+		for _, addr := range addrs {
+			s.d.SetBreakpoint(addr)
+		}
+		s.breakpoints[path] = append(s.breakpoints[path], addrs...)
+		bps[i] = breakpoint{
+			Verified:             true,
+			Line:                 sb.Line,
+			InstructionReference: memoryReference(addrs[0]),
+		}
+	}
+	return bps
+}
+
+// run continues the execution in the background until done returns true
+// (see debugger.RunUntil), and reports the stop to the client. A nil done
+// continues until a breakpoint.
+func (s *session) run(done func(v *vm.State) bool) {
+	s.mu.Lock()
+	s.running = true
+	atomic.StoreInt32(&s.pausing, 0)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		stop := s.d.RunUntil(func(v *vm.State) bool {
+			return atomic.LoadInt32(&s.pausing) != 0 || done != nil && done(v)
+		})
+		if atomic.LoadInt32(&s.pausing) != 0 && stop.Reason == debugger.Stepped {
+			stop.Reason = debugger.Interrupted
+		}
+
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+
+		switch stop.Reason {
+		case debugger.Breakpoint:
+			s.stopped("breakpoint", "")
+		case debugger.Watchpoint:
+			s.stopped("data breakpoint", "")
+		case debugger.Interrupted:
+			s.stopped("pause", "")
+		case debugger.Failed:
+			s.stopped("exception", stop.Err.Error())
+		default:
+			s.stopped("step", "")
+		}
+	}()
+}
+
+func (s *session) stopped(reason, text string) error {
+	return s.emit("stopped", stoppedEvent{
+		Reason:            reason,
+		ThreadID:          threadID,
+		AllThreadsStopped: true,
+		Text:              text,
+	})
+}
+
+// stepper returns the stop condition of a stepping request
+func (s *session) stepper(command string) func(v *vm.State) bool {
+	v := s.d.State
+	start, hasLine := s.syms.LineAt(v.PC)
+	depth := len(v.Calls)
+
+	// newLine tells whether we reached the start of another source line.
+	// Without line information, we step by instruction.
+	newLine := func(pc vm.Pointer) bool {
+		if !hasLine {
+			return true
+		}
+		l, ok := s.syms.LineAt(pc)
+		return ok && l != start
+	}
+
+	switch command {
+	case "stepIn":
+		return func(v *vm.State) bool {
+			return newLine(v.PC)
+		}
+	case "stepOut":
+		return func(v *vm.State) bool {
+			return len(v.Calls) < depth
+		}
+	default:
+		// Step over calls
+		return func(v *vm.State) bool {
+			return len(v.Calls) <= depth && newLine(v.PC)
+		}
+	}
+}
+
+func (s *session) stackTrace() []stackFrame {
+	v := s.d.State
+	calls := v.Backtrace()
+
+	// The innermost frame is the current instruction. Outer frames are
+	// located by the shadow call stack.
+	frames := make([]stackFrame, 0, len(calls)+1)
+	pc := v.PC
+	for i := 0; i <= len(calls); i++ {
+		entry := s.root
+		if i < len(calls) {
+			entry = calls[i].Target
+		}
+		f := stackFrame{
+			ID:                          len(frames),
+			Name:                        s.syms.FuncName(entry),
+			InstructionPointerReference: memoryReference(pc),
+		}
+		if l, ok := s.syms.LineAt(pc); ok {
+			f.Source = &source{Name: l.File, Path: s.syms.Path(l.File)}
+			f.Line = l.Line
+			f.Column = 1
+		}
+		frames = append(frames, f)
+
+		if i < len(calls) {
+			pc = calls[i].Caller
+		}
+	}
+	return frames
+}
+
+func (s *session) variables(ref int) []variable {
+	v := s.d.State
+	var vars []variable
+
+	switch ref {
+	case refRegisters:
+		for i, r := range v.Regs {
+			vars = append(vars, variable{
+				Name:  fmt.Sprintf("R%X", i),
+				Value: fmt.Sprintf("%d (0x%04X)", r, uint16(r)),
+			})
+		}
+		vars = append(vars,
+			variable{
+				Name:            "PC",
+				Value:           fmt.Sprintf("0x%04X (%s)", uint16(v.PC), s.syms.Symbolize(v.PC)),
+				MemoryReference: memoryReference(v.PC),
+			},
+			variable{
+				Name:            "SP",
+				Value:           fmt.Sprintf("0x%04X", uint16(v.SP)),
+				MemoryReference: memoryReference(v.SP),
+			},
+		)
+
+	case refFlags:
+		for _, f := range []struct {
+			name string
+			val  bool
+		}{
+			{"C", v.Flags.Carry()},
+			{"Z", v.Flags.Zero()},
+			{"O", v.Flags.Overflow()},
+			{"N", v.Flags.Negative()},
+		} {
+			vars = append(vars, variable{Name: f.name, Value: strconv.FormatBool(f.val)})
+		}
+
+	case refStack:
+		for addr := vm.Pointer(vm.StackStart); addr < v.SP && addr < vm.IOStart; addr += 2 {
+			val, _ := v.Int16At(addr)
+			vars = append(vars, variable{
+				Name:            fmt.Sprintf("[0x%04X]", uint16(addr)),
+				Value:           fmt.Sprintf("0x%04X", uint16(val)),
+				MemoryReference: memoryReference(addr),
+			})
+		}
+	}
+	return vars
+}
+
+// memoryRange resolves a memory reference and offset, and returns the
+// readable part of the requested range
+func (s *session) memoryRange(ref string, offset, count int) (int, int, error) {
+	base, err := strconv.ParseUint(strings.TrimPrefix(ref, "0x"), 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad memory reference %q", ref)
+	}
+	addr := int(base) + offset
+	if addr < 0 || addr >= vm.MemSize || count < 0 {
+		return 0, 0, fmt.Errorf("address out of bounds")
+	}
+	if addr+count > vm.MemSize {
+		count = vm.MemSize - addr
+	}
+	return addr, count, nil
+}
+
+func memoryReference(addr vm.Pointer) string {
+	return fmt.Sprintf("0x%04X", uint16(addr))
+}
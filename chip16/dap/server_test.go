@@ -0,0 +1,323 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSymbols = `
+label 0x0010 update
+line 0x0000 main.s:1
+line 0x0004 main.s:2
+line 0x0010 main.s:5
+line 0x0014 main.s:6
+`
+
+// message is a generic incoming message
+type message struct {
+	Type       string          `json:"type"`
+	Event      string          `json:"event"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a scripted DAP client
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	seq  int
+	errs chan error
+}
+
+// newTestDebugger debugs the following program:
+//
+//	0x00: CALL 0x0010  ; main.s:1
+//	0x04: JMP  0x0000  ; main.s:2
+//	0x10: ADDI R0, 1   ; main.s:5
+//	0x14: RET          ; main.s:6
+func newTestDebugger(t *testing.T) (*debugger.Debugger, *symbols.Table) {
+	v := vm.NewState()
+	for addr, o := range map[int]vm.Opcode{
+		0x00: vm.Opcode(0x14000000).WithHHLL(0x0010),
+		0x04: vm.Opcode(0x10000000).WithHHLL(0x0000),
+		0x10: vm.Opcode(0x40000000).WithHHLL(1),
+		0x14: 0x15000000,
+	} {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(o))
+		v.RAM.Write(vm.Pointer(addr), b[:])
+	}
+	d := debugger.New(v)
+	syms, err := symbols.Read(strings.NewReader(testSymbols))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, syms
+}
+
+// newClient starts a session on the test program
+func newClient(t *testing.T) (*client, *debugger.Debugger) {
+	d, syms := newTestDebugger(t)
+	server, conn := net.Pipe()
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn), errs: make(chan error, 1)}
+	go func() {
+		c.errs <- Serve(server, d, syms)
+		server.Close()
+	}()
+	return c, d
+}
+
+func (c *client) send(command string, args interface{}) {
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		req["arguments"] = args
+	}
+	if err := writeMessage(c.conn, req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() *message {
+	b, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		c.t.Fatal(err)
+	}
+	return &m
+}
+
+// call sends a request, and decodes the body of its response into body
+func (c *client) call(command string, args, body interface{}) *message {
+	c.send(command, args)
+	m := c.read()
+	if m.Type != "response" || m.Command != command || m.RequestSeq != c.seq {
+		c.t.Fatalf("unexpected message %+v", m)
+	}
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// expectStop waits for a stopped event, and returns its reason
+func (c *client) expectStop() string {
+	m := c.read()
+	var ev stoppedEvent
+	if m.Type != "event" || m.Event != "stopped" {
+		c.t.Fatalf("unexpected message %+v", m)
+	}
+	if err := json.Unmarshal(m.Body, &ev); err != nil {
+		c.t.Fatal(err)
+	}
+	return ev.Reason
+}
+
+func (c *client) stackTrace() []stackFrame {
+	var body struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	c.call("stackTrace", map[string]int{"threadId": threadID}, &body)
+	return body.StackFrames
+}
+
+func TestSession(t *testing.T) {
+	a := assert.New(t)
+	c, d := newClient(t)
+
+	var caps capabilities
+	if a.True(c.call("initialize", nil, &caps).Success) {
+		a.True(caps.SupportsReadMemoryRequest)
+	}
+	a.Equal("initialized", c.read().Event)
+
+	a.True(c.call("launch", map[string]bool{"stopOnEntry": true}, nil).Success)
+
+	var bps struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	c.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": "/src/main.s"},
+		"breakpoints": []map[string]int{{"line": 5}, {"line": 3}},
+	}, &bps)
+	if a.Len(bps.Breakpoints, 2) {
+		a.True(bps.Breakpoints[0].Verified)
+		a.Equal("0x0010", bps.Breakpoints[0].InstructionReference)
+		a.False(bps.Breakpoints[1].Verified)
+	}
+
+	c.call("configurationDone", nil, nil)
+	a.Equal("entry", c.expectStop())
+
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	a.Equal("breakpoint", c.expectStop())
+	a.Equal(vm.Pointer(0x10), d.State.PC)
+
+	frames := c.stackTrace()
+	if a.Len(frames, 2) {
+		a.Equal("update", frames[0].Name)
+		a.Equal(5, frames[0].Line)
+		a.Equal("main.s", frames[0].Source.Name)
+		a.Equal("sub_0000", frames[1].Name)
+		a.Equal(1, frames[1].Line)
+		a.Equal("0x0000", frames[1].InstructionPointerReference)
+	}
+
+	var vars struct {
+		Variables []variable `json:"variables"`
+	}
+	c.call("variables", map[string]int{"variablesReference": refStack}, &vars)
+	if a.Len(vars.Variables, 1) {
+		a.Equal("[0xFDF0]", vars.Variables[0].Name)
+		a.Equal("0x0004", vars.Variables[0].Value)
+	}
+	c.call("variables", map[string]int{"variablesReference": refRegisters}, &vars)
+	if a.Len(vars.Variables, 18) {
+		a.Equal("PC", vars.Variables[16].Name)
+		a.Equal("0x0010 (update)", vars.Variables[16].Value)
+	}
+
+	c.call("next", map[string]int{"threadId": threadID}, nil)
+	a.Equal("step", c.expectStop())
+	a.Equal(vm.Pointer(0x14), d.State.PC)
+
+	// Step over the RET, back to main.s:2
+	c.call("next", map[string]int{"threadId": threadID}, nil)
+	a.Equal("step", c.expectStop())
+	a.Equal(vm.Pointer(0x04), d.State.PC)
+	a.Len(c.stackTrace(), 1)
+
+	c.call("stepIn", map[string]int{"threadId": threadID}, nil)
+	a.Equal("step", c.expectStop())
+	a.Equal(vm.Pointer(0x00), d.State.PC)
+
+	// Stepping over the call stops at the breakpoint inside it
+	c.call("next", map[string]int{"threadId": threadID}, nil)
+	a.Equal("breakpoint", c.expectStop())
+	a.Equal(vm.Pointer(0x10), d.State.PC)
+
+	c.call("stepOut", map[string]int{"threadId": threadID}, nil)
+	a.Equal("step", c.expectStop())
+	a.Equal(vm.Pointer(0x04), d.State.PC)
+	a.Equal(int16(2), d.State.Regs[0])
+
+	c.call("disconnect", nil, nil)
+	a.NoError(<-c.errs)
+}
+
+func TestMemory(t *testing.T) {
+	a := assert.New(t)
+	c, d := newClient(t)
+
+	var mem struct {
+		Address         string `json:"address"`
+		Data            string `json:"data"`
+		UnreadableBytes int    `json:"unreadableBytes"`
+	}
+	c.call("readMemory", map[string]interface{}{
+		"memoryReference": "0x0010", "offset": 4, "count": 4,
+	}, &mem)
+	a.Equal("0x0014", mem.Address)
+	a.Equal("FQAAAA==", mem.Data)
+
+	c.call("readMemory", map[string]interface{}{
+		"memoryReference": "0xFFFE", "count": 4,
+	}, &mem)
+	a.Equal(2, mem.UnreadableBytes)
+
+	var written struct {
+		BytesWritten int `json:"bytesWritten"`
+	}
+	c.call("writeMemory", map[string]interface{}{
+		"memoryReference": "0x2000", "data": "vu8=",
+	}, &written)
+	a.Equal(2, written.BytesWritten)
+	a.Equal([]byte{0xBE, 0xEF}, d.State.RAM.View(0x2000, 2))
+
+	a.False(c.call("readMemory", map[string]interface{}{
+		"memoryReference": "nope",
+	}, nil).Success)
+	a.False(c.call("frobnicate", nil, nil).Success)
+}
+
+func TestPause(t *testing.T) {
+	a := assert.New(t)
+	c, _ := newClient(t)
+
+	c.call("launch", nil, nil)
+	c.call("configurationDone", nil, nil)
+
+	c.call("stackTrace", nil, nil)
+	m := c.call("stackTrace", nil, nil)
+	a.False(m.Success, "requests should fail while running")
+
+	c.call("pause", map[string]int{"threadId": threadID}, nil)
+	a.Equal("pause", c.expectStop())
+	a.NotEmpty(c.stackTrace())
+
+	// Pausing while stopped does nothing
+	c.call("pause", map[string]int{"threadId": threadID}, nil)
+	c.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": "/src/main.s"},
+		"breakpoints": []map[string]int{{"line": 5}},
+	}, nil)
+	c.call("continue", nil, nil)
+	a.Equal("breakpoint", c.expectStop())
+}
+
+// brokenConn fails to write once broken is set
+type brokenConn struct {
+	net.Conn
+	broken int32
+}
+
+func (c *brokenConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.broken) != 0 {
+		return 0, errors.New("broken")
+	}
+	return c.Conn.Write(b)
+}
+
+func TestWriteErrorWhileRunning(t *testing.T) {
+	a := assert.New(t)
+	d, syms := newTestDebugger(t)
+	server, conn := net.Pipe()
+	defer conn.Close()
+	bc := &brokenConn{Conn: server}
+	errs := make(chan error, 1)
+	go func() { errs <- Serve(bc, d, syms) }()
+
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.call("launch", nil, nil)
+	c.call("configurationDone", nil, nil)
+
+	atomic.StoreInt32(&bc.broken, 1)
+	c.send("threads", nil)
+	select {
+	case err := <-errs:
+		a.Error(err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve should stop the running target and return")
+	}
+}
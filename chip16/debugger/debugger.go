@@ -0,0 +1,197 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Reason tells why the machine stopped.
+type Reason int
+
+const (
+	// Stepped means a single instruction was executed.
+	Stepped Reason = iota
+
+	// Breakpoint means PC reached a breakpoint.
+	Breakpoint
+
+	// Watchpoint means a watched memory range was written.
+	Watchpoint
+
+	// Interrupted means the execution was interrupted by the host. Callers
+	// of RunUntil report it when their done function stopped the run.
+	Interrupted
+
+	// Failed means the last instruction yielded an error.
+	Failed
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Stepped:
+		return "step"
+	case Breakpoint:
+		return "breakpoint"
+	case Watchpoint:
+		return "watchpoint"
+	case Interrupted:
+		return "interrupted"
+	case Failed:
+		return "failed"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+// Stop describes why and where the machine stopped.
+type Stop struct {
+	// Reason tells why the machine stopped.
+	Reason Reason
+
+	// PC is the address of the next instruction to execute.
+	PC vm.Pointer
+
+	// Watch is the address of the triggered watchpoint, if any.
+	Watch vm.Pointer
+
+	// Err is the error that stopped the machine, if any.
+	Err error
+}
+
+// Watch is a memory range watched for writes.
+type Watch struct {
+	Addr vm.Pointer
+	Len  uint16
+
+	prev []byte
+}
+
+// Debugger controls the execution of a VM.
+//
+// A Debugger isn't safe for concurrent use. To stop a run from another
+// goroutine, use RunUntil with a done function reading a flag set there.
+type Debugger struct {
+	// State is the debugged VM.
+	State *vm.State
+
+	// Exec executes the next instruction. It defaults to cpu.Step, but may
+	// be replaced, e.g. to emulate peripherals between instructions.
+	Exec func(v *vm.State) error
+
+	breakpoints map[vm.Pointer]bool
+	watches     []*Watch
+}
+
+// New creates a Debugger for v.
+func New(v *vm.State) *Debugger {
+	return &Debugger{
+		State:       v,
+		Exec:        cpu.Step,
+		breakpoints: make(map[vm.Pointer]bool),
+	}
+}
+
+// SetBreakpoint sets a breakpoint at addr.
+func (d *Debugger) SetBreakpoint(addr vm.Pointer) {
+	d.breakpoints[addr] = true
+}
+
+// ClearBreakpoint removes the breakpoint at addr.
+func (d *Debugger) ClearBreakpoint(addr vm.Pointer) {
+	delete(d.breakpoints, addr)
+}
+
+// ClearBreakpoints removes all breakpoints.
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = make(map[vm.Pointer]bool)
+}
+
+// Breakpoints returns the addresses of all breakpoints, sorted.
+func (d *Debugger) Breakpoints() []vm.Pointer {
+	bps := make([]vm.Pointer, 0, len(d.breakpoints))
+	for addr := range d.breakpoints {
+		bps = append(bps, addr)
+	}
+	sort.Slice(bps, func(i, j int) bool { return bps[i] < bps[j] })
+	return bps
+}
+
+// SetWatchpoint stops the execution whenever the n bytes at addr change.
+func (d *Debugger) SetWatchpoint(addr vm.Pointer, n uint16) error {
+	if n == 0 || int(addr)+int(n) > vm.MemSize {
+		return fmt.Errorf("watchpoint out of bounds")
+	}
+	d.ClearWatchpoint(addr, n)
+	d.watches = append(d.watches, &Watch{Addr: addr, Len: n})
+	return nil
+}
+
+// ClearWatchpoint removes the watchpoint on the n bytes at addr.
+func (d *Debugger) ClearWatchpoint(addr vm.Pointer, n uint16) {
+	for i, w := range d.watches {
+		if w.Addr == addr && w.Len == n {
+			d.watches = append(d.watches[:i], d.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Step executes a single instruction.
+//
+// If the instruction fails, PC is moved back to it.
+func (d *Debugger) Step() Stop {
+	v := d.State
+	pc := v.PC
+	for _, w := range d.watches {
+		w.prev = append(w.prev[:0], v.RAM.View(w.Addr, int(w.Len))...)
+	}
+
+	if err := d.Exec(v); err != nil {
+		v.PC = pc
+		return Stop{Reason: Failed, PC: pc, Err: err}
+	}
+
+	for _, w := range d.watches {
+		if !bytes.Equal(w.prev, v.RAM.View(w.Addr, int(w.Len))) {
+			return Stop{Reason: Watchpoint, PC: v.PC, Watch: w.Addr}
+		}
+	}
+	return Stop{Reason: Stepped, PC: v.PC}
+}
+
+// Continue runs the VM until it reaches a breakpoint, triggers a watchpoint,
+// or fails.
+//
+// The instruction at PC is always executed, so that continuing from a
+// breakpoint doesn't stop right away.
+func (d *Debugger) Continue() Stop {
+	return d.RunUntil(nil)
+}
+
+// RunUntil works like Continue, but also stops (with the Stepped reason) as
+// soon as done returns true after an instruction.
+func (d *Debugger) RunUntil(done func(v *vm.State) bool) Stop {
+	for n := 1; ; n++ {
+		if n%cpu.CyclesPerFrame == 0 {
+			// Without preemption (e.g. on js/wasm), whatever makes done
+			// return true could never run otherwise
+			runtime.Gosched()
+		}
+		s := d.Step()
+		if s.Reason != Stepped {
+			return s
+		}
+		if d.breakpoints[s.PC] {
+			s.Reason = Breakpoint
+			return s
+		}
+		if done != nil && done(d.State) {
+			return s
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package debugger
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestState loads the following program:
+//
+//	0x00: ADDI R0, 1
+//	0x04: STM  R0, 0x1000
+//	0x08: JMP  0x0000
+func newTestState() *vm.State {
+	v := vm.NewState()
+	for i, o := range []vm.Opcode{
+		vm.Opcode(0x40000000).WithHHLL(1),
+		vm.Opcode(0x30000000).WithHHLL(0x1000),
+		vm.Opcode(0x10000000).WithHHLL(0x0000),
+	} {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(o))
+		v.RAM.Write(vm.Pointer(4*i), b[:])
+	}
+	return v
+}
+
+func TestStep(t *testing.T) {
+	a := assert.New(t)
+	d := New(newTestState())
+
+	s := d.Step()
+	a.Equal(Stop{Reason: Stepped, PC: 0x04}, s)
+	a.Equal(int16(1), d.State.Regs[0])
+
+	d.State.RAM.Set(0x08, 0xFF)
+	d.Step()
+	s = d.Step()
+	a.Equal(Failed, s.Reason)
+	a.Equal(vm.Pointer(0x08), s.PC)
+	a.Equal(vm.Pointer(0x08), d.State.PC, "PC should stay on the failing instruction")
+	a.Error(s.Err)
+}
+
+func TestBreakpoints(t *testing.T) {
+	a := assert.New(t)
+	d := New(newTestState())
+
+	d.SetBreakpoint(0x08)
+	d.SetBreakpoint(0x04)
+	a.Equal([]vm.Pointer{0x04, 0x08}, d.Breakpoints())
+
+	a.Equal(Stop{Reason: Breakpoint, PC: 0x04}, d.Continue())
+	a.Equal(Stop{Reason: Breakpoint, PC: 0x08}, d.Continue())
+
+	d.ClearBreakpoint(0x08)
+	a.Equal(Stop{Reason: Breakpoint, PC: 0x04}, d.Continue())
+	a.Equal(int16(2), d.State.Regs[0])
+
+	d.ClearBreakpoints()
+	a.Empty(d.Breakpoints())
+}
+
+func TestWatchpoints(t *testing.T) {
+	a := assert.New(t)
+	d := New(newTestState())
+
+	a.Error(d.SetWatchpoint(0xFFFF, 2))
+	a.Error(d.SetWatchpoint(0x1000, 0))
+
+	if a.NoError(d.SetWatchpoint(0x1000, 1)) {
+		s := d.Continue()
+		a.Equal(Stop{Reason: Watchpoint, PC: 0x08, Watch: 0x1000}, s)
+		a.Equal(int16(1), d.State.Regs[0])
+
+		// The high byte only changes when R0 reaches 0x100
+		d.ClearWatchpoint(0x1000, 1)
+		a.NoError(d.SetWatchpoint(0x1001, 1))
+		s = d.Continue()
+		a.Equal(Stop{Reason: Watchpoint, PC: 0x08, Watch: 0x1001}, s)
+		a.Equal(int16(0x100), d.State.Regs[0])
+	}
+}
+
+func TestRunUntil(t *testing.T) {
+	a := assert.New(t)
+	d := New(newTestState())
+
+	s := d.RunUntil(func(v *vm.State) bool { return v.Regs[0] == 3 })
+	a.Equal(Stop{Reason: Stepped, PC: 0x04}, s)
+
+	d.SetBreakpoint(0x08)
+	s = d.RunUntil(func(v *vm.State) bool { return v.Regs[0] == 5 })
+	a.Equal(Stop{Reason: Breakpoint, PC: 0x08}, s)
+	a.Equal(int16(3), d.State.Regs[0])
+}
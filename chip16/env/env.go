@@ -0,0 +1,252 @@
+// Package env wraps chip16 games into environments for bots and
+// reinforcement learning agents, in the fashion of OpenAI Gym.
+//
+// An agent resets the environment, then steps it with actions (controller
+// bitmasks) and gets observations of the screen and rewards in return, until
+// the episode is done:
+//
+//		e, err := env.New(env.Config{
+//			ROM:    rom,
+//			Reward: env.Change(env.Uint16(0x2000), 1), // Score
+//			Done:   env.Equals(env.Uint8(0x2002), 0),  // No lives left
+//		})
+//		...
+//		obs := e.Reset()
+//		for done := false; !done; {
+//			var reward float64
+//			obs, reward, done = e.Step(policy(obs))
+//			...
+//		}
+//
+// Environments aren't safe for concurrent use, but clones are independent:
+// run one per goroutine.
+package env
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// ObservationKind is the format of observations.
+type ObservationKind int
+
+const (
+	// Indexed observations hold a palette index per pixel.
+	Indexed ObservationKind = iota
+	// RGB observations hold red, green and blue bytes per pixel.
+	RGB
+)
+
+// Observation is a view of the screen.
+type Observation struct {
+	// W and H are the dimensions of the observation.
+	W, H int
+
+	// Channels is the number of bytes per pixel.
+	Channels int
+
+	// Pixels holds the pixels, row by row.
+	Pixels []byte
+}
+
+// Config describes an environment.
+type Config struct {
+	// ROM is the game's image.
+	ROM []byte
+
+	// Kind is the format of observations.
+	Kind ObservationKind
+
+	// Downscale is the downscaling factor of observations: indexed
+	// observations keep the top-left pixel of each Downscale×Downscale
+	// block, RGB observations average them. 0 means no downscaling.
+	Downscale int
+
+	// FrameSkip is the number of frames an action is repeated for, per
+	// step. 0 means 1.
+	FrameSkip int
+
+	// Reward scores steps. Steps are worth 0 if nil.
+	Reward Reward
+
+	// Done tells when an episode is over. If nil, episodes only end on
+	// MaxSteps or errors.
+	Done Done
+
+	// MaxSteps is the maximum number of steps of an episode (0 for no
+	// limit).
+	MaxSteps int
+
+	// Options configure the machine.
+	Options []chip16.Option
+}
+
+// Env is a game environment.
+type Env struct {
+	cfg    Config
+	m      *chip16.Machine
+	before []byte // RAM before the current step
+	after  []byte // RAM after the current step
+	steps  int
+	done   bool
+	err    error
+	pix    []uint8 // composed screen
+}
+
+// New creates an environment. It must be reset before being stepped.
+func New(cfg Config) (*Env, error) {
+	if cfg.Downscale == 0 {
+		cfg.Downscale = 1
+	}
+	if cfg.FrameSkip == 0 {
+		cfg.FrameSkip = 1
+	}
+	if cfg.Downscale < 0 || cfg.FrameSkip < 0 || cfg.MaxSteps < 0 {
+		return nil, fmt.Errorf("invalid environment config")
+	}
+	if cfg.Kind != Indexed && cfg.Kind != RGB {
+		return nil, fmt.Errorf("unknown observation kind %d", cfg.Kind)
+	}
+	m, err := chip16.New(cfg.Options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.LoadROM(bytes.NewReader(cfg.ROM)); err != nil {
+		return nil, err
+	}
+	return &Env{
+		cfg:    cfg,
+		m:      m,
+		before: make([]byte, vm.MemSize),
+		after:  make([]byte, vm.MemSize),
+		pix:    make([]uint8, graphics.ScreenW*graphics.ScreenH),
+	}, nil
+}
+
+// Reset starts a new episode, and returns the first observation. The game's
+// first frame is run with no buttons held, so that the observation shows
+// something and rewards don't account for the game's setup. If the frame
+// fails, the episode is over right away.
+func (e *Env) Reset() Observation {
+	e.m.Reset()
+	e.m.SetInput(0, 0)
+	e.steps = 0
+	e.err = e.m.RunFrame()
+	e.done = e.err != nil
+	return e.Observe()
+}
+
+// Step plays an action (the buttons of the first controller) for a step,
+// and returns the resulting observation, the step's reward, and whether the
+// episode is over.
+//
+// Episodes are also over when the machine fails: see Err.
+func (e *Env) Step(action uint16) (Observation, float64, bool) {
+	if e.done {
+		return e.Observe(), 0, true
+	}
+
+	e.m.State().RAM.Read(0, e.before)
+	e.m.SetInput(0, action)
+	for i := 0; i < e.cfg.FrameSkip && e.err == nil; i++ {
+		e.err = e.m.RunFrame()
+	}
+	e.steps++
+
+	ram := e.after
+	e.m.State().RAM.Read(0, ram)
+	reward := 0.0
+	if e.cfg.Reward != nil {
+		reward = e.cfg.Reward(e.before, ram)
+	}
+	e.done = e.err != nil ||
+		e.cfg.MaxSteps > 0 && e.steps >= e.cfg.MaxSteps ||
+		e.cfg.Done != nil && e.cfg.Done(ram)
+	return e.Observe(), reward, e.done
+}
+
+// Done tells whether the episode is over.
+func (e *Env) Done() bool {
+	return e.done
+}
+
+// Err returns the error that ended the episode, if any.
+func (e *Env) Err() error {
+	return e.err
+}
+
+// Steps returns the number of steps of the current episode.
+func (e *Env) Steps() int {
+	return e.steps
+}
+
+// Machine returns the machine running the game.
+func (e *Env) Machine() *chip16.Machine {
+	return e.m
+}
+
+// Clone returns an independent copy of the environment, in the same state.
+func (e *Env) Clone() *Env {
+	c := *e
+	c.m = e.m.Clone()
+	c.before = make([]byte, len(e.before))
+	c.after = make([]byte, len(e.after))
+	c.pix = make([]uint8, len(e.pix))
+	return &c
+}
+
+// Observe returns an observation of the current screen.
+func (e *Env) Observe() Observation {
+	g := e.m.State().Graphics
+	n := e.cfg.Downscale
+	obs := Observation{W: graphics.ScreenW / n, H: graphics.ScreenH / n, Channels: 1}
+	if e.cfg.Kind == RGB {
+		obs.Channels = 3
+	}
+	obs.Pixels = make([]byte, obs.W*obs.H*obs.Channels)
+
+	if e.cfg.Kind == Indexed && n == 1 {
+		g.Compose(obs.Pixels)
+		return obs
+	}
+	g.Compose(e.pix)
+
+	if e.cfg.Kind == Indexed {
+		i := 0
+		for y := 0; y < obs.H; y++ {
+			row := e.pix[y*n*graphics.ScreenW:]
+			for x := 0; x < obs.W; x++ {
+				obs.Pixels[i] = row[x*n]
+				i++
+			}
+		}
+		return obs
+	}
+
+	// Sum the colors of each block, then average them
+	sums := make([]int, obs.W*3)
+	for y := 0; y < obs.H; y++ {
+		for i := range sums {
+			sums[i] = 0
+		}
+		for by := y * n; by < (y+1)*n; by++ {
+			row := e.pix[by*graphics.ScreenW : by*graphics.ScreenW+obs.W*n]
+			for bx, c := range row {
+				rgb := g.Palette[c&0x0F]
+				sum := sums[bx/n*3:]
+				sum[0] += int(rgb.R)
+				sum[1] += int(rgb.G)
+				sum[2] += int(rgb.B)
+			}
+		}
+		out := obs.Pixels[y*obs.W*3:]
+		for i, sum := range sums {
+			out[i] = byte(sum / (n * n))
+		}
+	}
+	return obs
+}
@@ -0,0 +1,216 @@
+package env
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/stretchr/testify/assert"
+)
+
+// testGame scores a point per frame with A held, and loses a life per frame
+// with B held, starting with 3 lives.
+var testGame = []byte{
+	0x20, 0x02, 0x03, 0x00, // 0x00: LDI R2, 3
+	0x30, 0x02, 0x02, 0x20, // 0x04: STM R2, 0x2002
+	0x22, 0x00, 0xF0, 0xFF, // 0x08: LDM R0, 0xFFF0
+	0x24, 0x01, 0x00, 0x00, // 0x0C: MOV R1, R0
+	0x60, 0x01, 0x40, 0x00, // 0x10: ANDI R1, 0x40
+	0xB1, 0x01, 0x06, 0x00, // 0x14: SHR R1, 6
+	0x22, 0x03, 0x00, 0x20, // 0x18: LDM R3, 0x2000
+	0x41, 0x13, 0x00, 0x00, // 0x1C: ADD R3, R1
+	0x30, 0x03, 0x00, 0x20, // 0x20: STM R3, 0x2000
+	0x60, 0x00, 0x80, 0x00, // 0x24: ANDI R0, 0x80
+	0xB1, 0x00, 0x07, 0x00, // 0x28: SHR R0, 7
+	0x22, 0x02, 0x02, 0x20, // 0x2C: LDM R2, 0x2002
+	0x51, 0x02, 0x00, 0x00, // 0x30: SUB R2, R0
+	0x30, 0x02, 0x02, 0x20, // 0x34: STM R2, 0x2002
+	0x03, 0x00, 0x05, 0x00, // 0x38: BGC 5
+	0x02, 0x00, 0x00, 0x00, // 0x3C: VBLNK
+	0x10, 0x00, 0x08, 0x00, // 0x40: JMP 0x0008
+}
+
+var (
+	score = Uint16(0x2000)
+	lives = Uint8(0x2002)
+)
+
+func newTestEnv(t *testing.T, cfg Config) *Env {
+	cfg.ROM = testGame
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEnv(t *testing.T) {
+	a := assert.New(t)
+	e := newTestEnv(t, Config{
+		Reward: Sum(Change(score, 1), Change(lives, 10)),
+		Done:   Equals(lives, 0),
+	})
+
+	obs := e.Reset()
+	a.Equal(320, obs.W)
+	a.Equal(240, obs.H)
+	a.Equal(1, obs.Channels)
+	a.Len(obs.Pixels, 320*240)
+	a.Equal(byte(5), obs.Pixels[0], "the first frame should have run")
+
+	_, reward, done := e.Step(0)
+	a.Equal(0.0, reward, "the game's setup shouldn't be rewarded")
+	a.False(done)
+
+	_, reward, done = e.Step(chip16.ButtonA)
+	a.Equal(1.0, reward)
+	a.False(done)
+
+	_, reward, done = e.Step(chip16.ButtonA | chip16.ButtonB)
+	a.Equal(-9.0, reward)
+	a.False(done)
+
+	_, reward, done = e.Step(0)
+	a.Equal(0.0, reward)
+	a.False(done)
+
+	for i := 0; i < 2; i++ {
+		_, _, done = e.Step(chip16.ButtonB)
+	}
+	a.True(done)
+	a.Equal(6, e.Steps())
+	a.NoError(e.Err())
+
+	_, reward, done = e.Step(chip16.ButtonA)
+	a.True(done, "steps after the end do nothing")
+	a.Equal(0.0, reward)
+	a.Equal(6, e.Steps())
+
+	e.Reset()
+	a.False(e.Done())
+	a.Equal(0, e.Steps())
+}
+
+func TestEnvConfig(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := New(Config{ROM: testGame, Downscale: -1})
+	a.Error(err)
+	_, err = New(Config{ROM: testGame, Kind: 42})
+	a.Error(err)
+	_, err = New(Config{ROM: []byte("CH16")})
+	a.Error(err)
+
+	// Frame skipping and step limit
+	e := newTestEnv(t, Config{FrameSkip: 4, MaxSteps: 2, Reward: Change(score, 1)})
+	e.Reset()
+	_, reward, done := e.Step(chip16.ButtonA)
+	a.Equal(4.0, reward)
+	a.False(done)
+	_, _, done = e.Step(chip16.ButtonA)
+	a.True(done)
+
+	// Failures end episodes
+	e = newTestEnv(t, Config{})
+	e.Reset()
+	e.Machine().State().RAM.Set(0x08, 0xFF)
+	_, _, done = e.Step(0)
+	a.True(done)
+	a.Error(e.Err())
+	e, err = New(Config{ROM: []byte{0xFF, 0x00, 0x00, 0x00}})
+	if a.NoError(err) {
+		e.Reset()
+		a.True(e.Done(), "failures on reset should end episodes")
+		a.Error(e.Err())
+	}
+}
+
+func TestObserve(t *testing.T) {
+	a := assert.New(t)
+
+	e := newTestEnv(t, Config{Kind: RGB, Downscale: 4})
+	e.Reset()
+	e.Step(0)
+	g := e.Machine().State().Graphics
+	for i := 0; i < 4; i++ {
+		// Half of the first 4×4 block is white
+		g.SetPixel(i, 0, 0xF)
+		g.SetPixel(i, 1, 0xF)
+	}
+	obs := e.Observe()
+	a.Equal(80, obs.W)
+	a.Equal(60, obs.H)
+	a.Equal(3, obs.Channels)
+	a.Len(obs.Pixels, 80*60*3)
+	brown := g.Palette[5]
+	a.Equal([]byte{
+		byte((0xFF*8 + int(brown.R)*8) / 16),
+		byte((0xFF*8 + int(brown.G)*8) / 16),
+		byte((0xFF*8 + int(brown.B)*8) / 16),
+	}, obs.Pixels[:3])
+	a.Equal([]byte{brown.R, brown.G, brown.B}, obs.Pixels[3:6])
+
+	e = newTestEnv(t, Config{Downscale: 2})
+	e.Reset()
+	e.Step(0)
+	e.Machine().State().Graphics.SetPixel(2, 0, 0xF)
+	e.Machine().State().Graphics.SetPixel(3, 0, 0xF)
+	obs = e.Observe()
+	a.Equal(160, obs.W)
+	a.Equal([]byte{5, 0xF, 5}, obs.Pixels[:3], "indexed observations keep the top-left pixels")
+}
+
+func TestClone(t *testing.T) {
+	a := assert.New(t)
+	e := newTestEnv(t, Config{Reward: Change(score, 1), Done: Equals(lives, 0)})
+	e.Reset()
+	e.Step(chip16.ButtonA)
+
+	// Explore futures in parallel
+	var wg sync.WaitGroup
+	clones := make([]*Env, 8)
+	total := make([]float64, len(clones))
+	for i := range clones {
+		clones[i] = e.Clone()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < i; n++ {
+				_, r, _ := clones[i].Step(chip16.ButtonA)
+				total[i] += r
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, c := range clones {
+		a.Equal(float64(i), total[i])
+		a.Equal(1+i, score(c.Machine().State().RAM.Bytes()))
+		a.Equal(1+i, c.Steps())
+	}
+	a.Equal(1, score(e.Machine().State().RAM.Bytes()), "the original shouldn't move")
+}
+
+func TestValues(t *testing.T) {
+	a := assert.New(t)
+	ram := []byte{0xFE, 0xFF}
+
+	a.Equal(0xFE, Uint8(0)(ram))
+	a.Equal(-2, Int8(0)(ram))
+	a.Equal(0xFFFE, Uint16(0)(ram))
+	a.Equal(-2, Int16(0)(ram))
+	a.Equal(2.5, Constant(2.5)(ram, ram))
+	a.True(Any(Equals(Uint8(1), 0), Equals(Uint8(0), 0xFE))(ram))
+	a.False(Any()(ram))
+}
+
+func BenchmarkStep(b *testing.B) {
+	e, err := New(Config{ROM: testGame, Reward: Change(score, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	e.Reset()
+	for n := 0; n < b.N; n++ {
+		e.Step(chip16.ButtonA)
+	}
+}
@@ -0,0 +1,85 @@
+package env
+
+import "github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+
+// Value reads a game variable (score, lives...) from RAM.
+type Value func(ram []byte) int
+
+// Uint8 reads an unsigned byte at addr.
+func Uint8(addr vm.Pointer) Value {
+	return func(ram []byte) int {
+		return int(ram[addr])
+	}
+}
+
+// Int8 reads a signed byte at addr.
+func Int8(addr vm.Pointer) Value {
+	return func(ram []byte) int {
+		return int(int8(ram[addr]))
+	}
+}
+
+// Uint16 reads an unsigned little-endian 16-bit word at addr.
+func Uint16(addr vm.Pointer) Value {
+	return func(ram []byte) int {
+		return int(ram[addr]) | int(ram[addr+1])<<8
+	}
+}
+
+// Int16 reads a signed little-endian 16-bit word at addr.
+func Int16(addr vm.Pointer) Value {
+	return func(ram []byte) int {
+		return int(int16(uint16(ram[addr]) | uint16(ram[addr+1])<<8))
+	}
+}
+
+// Reward scores a step, from the RAM before and after it.
+type Reward func(before, after []byte) float64
+
+// Change rewards the changes of a value: scale per unit of increase (e.g.
+// 1 for a score, or -1 for a number of hits taken).
+func Change(v Value, scale float64) Reward {
+	return func(before, after []byte) float64 {
+		return scale * float64(v(after)-v(before))
+	}
+}
+
+// Constant gives r on every step, e.g. a small reward for surviving.
+func Constant(r float64) Reward {
+	return func(before, after []byte) float64 {
+		return r
+	}
+}
+
+// Sum adds up rewards.
+func Sum(rewards ...Reward) Reward {
+	return func(before, after []byte) float64 {
+		total := 0.0
+		for _, r := range rewards {
+			total += r(before, after)
+		}
+		return total
+	}
+}
+
+// Done tells whether an episode is over, from the RAM after a step.
+type Done func(ram []byte) bool
+
+// Equals is done when v equals n, e.g. when no lives are left.
+func Equals(v Value, n int) Done {
+	return func(ram []byte) bool {
+		return v(ram) == n
+	}
+}
+
+// Any is done when any of its conditions is.
+func Any(conds ...Done) Done {
+	return func(ram []byte) bool {
+		for _, c := range conds {
+			if c(ram) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,473 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Registers, in the order they're exchanged with GDB.
+// Every register is 16 bits wide and transferred as little-endian.
+const (
+	regPC    = 16
+	regSP    = 17
+	regFlags = 18
+	numRegs  = 19
+)
+
+// Unix signals used to report stops
+const (
+	sigINT  = 0x02
+	sigILL  = 0x04
+	sigTRAP = 0x05
+)
+
+// targetXML describes the register set to GDB
+var targetXML = func() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.chip16.core">
+`)
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&b, `<reg name="r%d" bitsize="16" type="int16" regnum="%d"/>`+"\n", i, i)
+	}
+	b.WriteString(`<reg name="pc" bitsize="16" type="code_ptr" regnum="16"/>
+<reg name="sp" bitsize="16" type="data_ptr" regnum="17"/>
+<reg name="flags" bitsize="16" type="uint16" regnum="18"/>
+</feature>
+</target>
+`)
+	return b.String()
+}()
+
+// conn is a GDB remote serial protocol session
+type conn struct {
+	d *debugger.Debugger
+	r *bufio.Reader
+
+	mu    sync.Mutex // protects w and noAck
+	w     io.Writer
+	noAck bool
+
+	// interrupted is set by interrupt requests, and cleared by continue
+	// requests as they're read, so that it stops the run they start.
+	interrupted int32
+}
+
+// Serve runs a GDB remote serial protocol session over rw, until the client
+// detaches, kills the session, or the connection gets closed.
+//
+// rw can be a network connection or the standard input/output of a process
+// spawned by GDB (target remote | ...). Packets are read from rw in the
+// background, and a pending read can't be cancelled: the caller must close
+// rw once Serve returns, for the reader to stop.
+func Serve(rw io.ReadWriter, d *debugger.Debugger) error {
+	c := &conn{d: d, r: bufio.NewReader(rw), w: rw}
+
+	packets := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.readPackets(packets, done)
+		close(packets)
+	}()
+
+	for p := range packets {
+		reply, over := c.handle(p)
+		if err := c.send(reply); err != nil {
+			return err
+		}
+		if over {
+			return nil
+		}
+	}
+	if err := <-errs; err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// ListenAndServe listens on the TCP network address addr and serves GDB
+// sessions, one at a time. Sessions that fail are logged, and don't stop the
+// server.
+func ListenAndServe(addr string, d *debugger.Debugger) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = Serve(nc, d)
+		nc.Close()
+		if err != nil {
+			log.Printf("gdbstub: %s: %s", nc.RemoteAddr(), err)
+		}
+	}
+}
+
+// readPackets decodes incoming packets, and handles interrupt requests
+// immediately, so that they can stop a running Continue.
+func (c *conn) readPackets(packets chan<- string, done <-chan struct{}) error {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case 0x03:
+			atomic.StoreInt32(&c.interrupted, 1)
+			continue
+		case '$':
+		default:
+			// Acks, or garbage
+			continue
+		}
+
+		data, err := c.r.ReadString('#')
+		if err != nil {
+			return err
+		}
+		data = data[:len(data)-1]
+		var sum [2]byte
+		if _, err := io.ReadFull(c.r, sum[:]); err != nil {
+			return err
+		}
+
+		want, err := strconv.ParseUint(string(sum[:]), 16, 8)
+		if err != nil || uint8(want) != checksum(data) {
+			if err := c.ack('-'); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.ack('+'); err != nil {
+			return err
+		}
+		if strings.HasPrefix(data, "c") {
+			atomic.StoreInt32(&c.interrupted, 0)
+		}
+		select {
+		case packets <- data:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// cont continues the execution until a breakpoint or an interrupt request
+func (c *conn) cont() debugger.Stop {
+	stop := c.d.RunUntil(func(*vm.State) bool {
+		return atomic.LoadInt32(&c.interrupted) != 0
+	})
+	if stop.Reason == debugger.Stepped {
+		stop.Reason = debugger.Interrupted
+	}
+	return stop
+}
+
+func (c *conn) ack(b byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noAck {
+		return nil
+	}
+	_, err := c.w.Write([]byte{b})
+	return err
+}
+
+func (c *conn) send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data = escape(data)
+	_, err := fmt.Fprintf(c.w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// escape escapes the characters that have a special meaning in packets
+func escape(data string) string {
+	if !strings.ContainsAny(data, "#$}*") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '#', '$', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(data[i] ^ 0x20)
+		default:
+			b.WriteByte(data[i])
+		}
+	}
+	return b.String()
+}
+
+const (
+	replyOK    = "OK"
+	replyError = "E01"
+)
+
+// handle processes a packet, and tells whether the session is over
+func (c *conn) handle(p string) (string, bool) {
+	if p == "" {
+		return "", false
+	}
+	v := c.d.State
+	args := p[1:]
+
+	switch p[0] {
+	case '?':
+		return fmt.Sprintf("S%02x", sigTRAP), false
+
+	case 'g':
+		var b []byte
+		for i := 0; i < numRegs; i++ {
+			b = appendReg(b, c.reg(i))
+		}
+		return hex.EncodeToString(b), false
+
+	case 'G':
+		b, err := hex.DecodeString(args)
+		if err != nil || len(b) != 2*numRegs {
+			return replyError, false
+		}
+		for i := 0; i < numRegs; i++ {
+			c.setReg(i, binary.LittleEndian.Uint16(b[2*i:]))
+		}
+		return replyOK, false
+
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= numRegs {
+			return replyError, false
+		}
+		return hex.EncodeToString(appendReg(nil, c.reg(int(n)))), false
+
+	case 'P':
+		fields := strings.SplitN(args, "=", 2)
+		if len(fields) != 2 {
+			return replyError, false
+		}
+		n, err := strconv.ParseUint(fields[0], 16, 8)
+		b, err2 := hex.DecodeString(fields[1])
+		if err != nil || err2 != nil || n >= numRegs || len(b) != 2 {
+			return replyError, false
+		}
+		c.setReg(int(n), binary.LittleEndian.Uint16(b))
+		return replyOK, false
+
+	case 'm':
+		addr, n, ok := parseRange(args, vm.MemSize)
+		if !ok {
+			return replyError, false
+		}
+		return hex.EncodeToString(v.RAM.View(vm.Pointer(addr), n)), false
+
+	case 'M':
+		fields := strings.SplitN(args, ":", 2)
+		if len(fields) != 2 {
+			return replyError, false
+		}
+		addr, n, ok := parseRange(fields[0], vm.MemSize)
+		b, err := hex.DecodeString(fields[1])
+		if !ok || err != nil || len(b) != n {
+			return replyError, false
+		}
+		v.RAM.Write(vm.Pointer(addr), b)
+		return replyOK, false
+
+	case 'c', 's':
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return replyError, false
+			}
+			v.PC = vm.Pointer(addr)
+		}
+		if p[0] == 's' {
+			return stopReply(c.d.Step()), false
+		}
+		return stopReply(c.cont()), false
+
+	case 'Z', 'z':
+		return c.handleBreakpoint(p[0] == 'Z', args), false
+
+	case 'H', 'T':
+		// We only have one thread
+		return replyOK, false
+
+	case 'k':
+		return "", true
+
+	case 'D':
+		c.d.ClearBreakpoints()
+		return replyOK, true
+
+	case 'q':
+		return c.handleQuery(args), false
+
+	case 'Q':
+		if args == "StartNoAckMode" {
+			// The reply to this packet is still acknowledged by the client
+			defer func() {
+				c.mu.Lock()
+				c.noAck = true
+				c.mu.Unlock()
+			}()
+			return replyOK, false
+		}
+	}
+
+	// Unsupported packet
+	return "", false
+}
+
+func (c *conn) handleQuery(q string) string {
+	switch {
+	case strings.HasPrefix(q, "Supported"):
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"
+	case q == "Attached":
+		return "1"
+	case q == "C":
+		return "QC1"
+	case q == "fThreadInfo":
+		return "m1"
+	case q == "sThreadInfo":
+		return "l"
+	case strings.HasPrefix(q, "Xfer:features:read:target.xml:"):
+		// The requested length may go past the end of the document
+		off, n, ok := parseRange(
+			strings.TrimPrefix(q, "Xfer:features:read:target.xml:"),
+			math.MaxInt32,
+		)
+		if !ok || off > len(targetXML) {
+			return replyError
+		}
+		if off+n >= len(targetXML) {
+			return "l" + targetXML[off:]
+		}
+		return "m" + targetXML[off:off+n]
+	}
+	return ""
+}
+
+// handleBreakpoint handles Z (insert) and z (remove) packets: type,addr,kind
+func (c *conn) handleBreakpoint(insert bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 {
+		return replyError
+	}
+	addr, err := strconv.ParseUint(fields[1], 16, 16)
+	kind, err2 := strconv.ParseUint(fields[2], 16, 16)
+	if err != nil || err2 != nil {
+		return replyError
+	}
+
+	switch fields[0] {
+	case "0", "1":
+		// Software and hardware breakpoints are the same to us
+		if insert {
+			c.d.SetBreakpoint(vm.Pointer(addr))
+		} else {
+			c.d.ClearBreakpoint(vm.Pointer(addr))
+		}
+		return replyOK
+
+	case "2":
+		// Write watchpoint: kind is the length of the watched range
+		if !insert {
+			c.d.ClearWatchpoint(vm.Pointer(addr), uint16(kind))
+		} else if err := c.d.SetWatchpoint(vm.Pointer(addr), uint16(kind)); err != nil {
+			return replyError
+		}
+		return replyOK
+	}
+
+	// Read and access watchpoints are not supported
+	return ""
+}
+
+func (c *conn) reg(n int) uint16 {
+	v := c.d.State
+	switch n {
+	case regPC:
+		return uint16(v.PC)
+	case regSP:
+		return uint16(v.SP)
+	case regFlags:
+		return uint16(v.Flags)
+	default:
+		return uint16(v.Regs[n])
+	}
+}
+
+func (c *conn) setReg(n int, val uint16) {
+	v := c.d.State
+	switch n {
+	case regPC:
+		v.PC = vm.Pointer(val)
+	case regSP:
+		v.SP = vm.Pointer(val)
+	case regFlags:
+		v.Flags = vm.CPUFlags(val)
+	default:
+		v.Regs[n] = int16(val)
+	}
+}
+
+func appendReg(b []byte, val uint16) []byte {
+	return append(b, byte(val), byte(val>>8))
+}
+
+// parseRange parses an "addr,length" pair, checking it against size
+func parseRange(s string, size int) (int, int, bool) {
+	fields := strings.SplitN(s, ",", 2)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	addr, err := strconv.ParseUint(fields[0], 16, 32)
+	n, err2 := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil || err2 != nil || addr+n > uint64(size) {
+		return 0, 0, false
+	}
+	return int(addr), int(n), true
+}
+
+func stopReply(s debugger.Stop) string {
+	switch s.Reason {
+	case debugger.Watchpoint:
+		return fmt.Sprintf("T%02xwatch:%x;", sigTRAP, uint16(s.Watch))
+	case debugger.Interrupted:
+		return fmt.Sprintf("S%02x", sigINT)
+	case debugger.Failed:
+		return fmt.Sprintf("S%02x", sigILL)
+	default:
+		return fmt.Sprintf("S%02x", sigTRAP)
+	}
+}
@@ -0,0 +1,204 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// client is a scripted GDB client
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	errs chan error
+}
+
+// newClient starts a session on the following program:
+//
+//	0x00: ADDI R0, 1
+//	0x04: STM  R0, 0x1000
+//	0x08: JMP  0x0000
+func newClient(t *testing.T) (*client, *debugger.Debugger) {
+	v := vm.NewState()
+	for i, o := range []vm.Opcode{
+		vm.Opcode(0x40000000).WithHHLL(1),
+		vm.Opcode(0x30000000).WithHHLL(0x1000),
+		vm.Opcode(0x10000000).WithHHLL(0x0000),
+	} {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(o))
+		v.RAM.Write(vm.Pointer(4*i), b[:])
+	}
+	d := debugger.New(v)
+
+	server, conn := net.Pipe()
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn), errs: make(chan error, 1)}
+	go func() {
+		c.errs <- Serve(server, d)
+		server.Close()
+	}()
+	return c, d
+}
+
+func (c *client) write(s string) {
+	if _, err := io.WriteString(c.conn, s); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// call sends a packet and returns the reply
+func (c *client) call(data string) string {
+	c.write(fmt.Sprintf("$%s#%02x", data, checksum(data)))
+	c.expectAck()
+	return c.reply()
+}
+
+func (c *client) expectAck() {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if b != '+' {
+		c.t.Fatalf("expected ack, got %q", b)
+	}
+}
+
+func (c *client) reply() string {
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var sum [2]byte
+	if _, err := io.ReadFull(c.r, sum[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	if fmt.Sprintf("%02x", checksum(data)) != string(sum[:]) {
+		c.t.Fatalf("bad checksum for %q", data)
+	}
+	// The session may already be over
+	io.WriteString(c.conn, "+")
+	return data
+}
+
+func TestSession(t *testing.T) {
+	a := assert.New(t)
+	c, d := newClient(t)
+
+	a.Contains(c.call("qSupported:swbreak+"), "qXfer:features:read+")
+	a.Equal("S05", c.call("?"))
+	a.Equal("1", c.call("qAttached"))
+	a.Equal("", c.call("vMustReplyEmpty"))
+
+	// Registers
+	d.State.Regs[1] = 0x1234
+	d.State.Flags.SetCarry(true)
+	regs := c.call("g")
+	if a.Len(regs, 4*numRegs) {
+		a.Equal("3412", regs[4:8])
+		a.Equal("0000", regs[4*regPC:4*regPC+4])
+		a.Equal("f0fd", regs[4*regSP:4*regSP+4])
+		a.Equal("0200", regs[4*regFlags:])
+	}
+	a.Equal("3412", c.call("p1"))
+	a.Equal("OK", c.call("P2=cdab"))
+	a.Equal(int16(-0x5433), d.State.Regs[2])
+	a.Equal("E01", c.call("p13"))
+	a.Equal("OK", c.call("G"+strings.Repeat("0100", numRegs)))
+	a.Equal(vm.Pointer(1), d.State.PC)
+	a.Equal("OK", c.call("P10=0000"))
+	a.Equal("OK", c.call("P11=f0fd"))
+	a.Equal("OK", c.call("P12=0000"))
+
+	// Memory
+	a.Equal("400001003000", c.call("m0,6"))
+	a.Equal("OK", c.call("M2000,2:beef"))
+	a.Equal([]byte{0xBE, 0xEF}, d.State.RAM.View(0x2000, 2))
+	a.Equal("E01", c.call("mffff,2"))
+
+	// Execution
+	a.Equal("S05", c.call("s"))
+	a.Equal(vm.Pointer(0x04), d.State.PC)
+	a.Equal("OK", c.call("Z0,8,4"))
+	a.Equal("S05", c.call("c"))
+	a.Equal(vm.Pointer(0x08), d.State.PC)
+	a.Equal("OK", c.call("z0,8,4"))
+	a.Equal("OK", c.call("Z2,1000,2"))
+	a.Equal("T05watch:1000;", c.call("c"))
+	a.Equal(vm.Pointer(0x08), d.State.PC)
+	a.Equal(int16(3), d.State.Regs[0])
+	a.Equal("OK", c.call("z2,1000,2"))
+	a.Equal("", c.call("Z3,1000,2"))
+
+	a.Equal("OK", c.call("D"))
+	a.NoError(<-c.errs)
+}
+
+func TestInterrupt(t *testing.T) {
+	a := assert.New(t)
+	c, _ := newClient(t)
+
+	c.write(fmt.Sprintf("$c#%02x", checksum("c")))
+	c.expectAck()
+	time.Sleep(10 * time.Millisecond)
+	c.write("\x03")
+	a.Equal("S02", c.reply())
+
+	// Interrupts don't outlive the run
+	c.write("\x03")
+	a.Equal("OK", c.call("Z0,8,4"))
+	a.Equal("S05", c.call("c"))
+	a.Equal("OK", c.call("z0,8,4"))
+
+	c.write("$k#00") // Wrong checksum
+	b, _ := c.r.ReadByte()
+	a.Equal(byte('-'), b)
+	c.call("k")
+	a.NoError(<-c.errs)
+}
+
+func TestNoAckMode(t *testing.T) {
+	a := assert.New(t)
+	c, _ := newClient(t)
+
+	a.Equal("OK", c.call("QStartNoAckMode"))
+	c.write(fmt.Sprintf("$?#%02x", checksum("?")))
+	a.Equal("S05", c.reply())
+}
+
+func TestTargetXML(t *testing.T) {
+	a := assert.New(t)
+	c, _ := newClient(t)
+
+	var xml string
+	for {
+		r := c.call(fmt.Sprintf("qXfer:features:read:target.xml:%x,%x", len(xml), 0x100))
+		if a.NotEmpty(r) {
+			xml += r[1:]
+		}
+		if r == "" || r[0] == 'l' {
+			break
+		}
+	}
+	a.Equal(targetXML, xml)
+	a.Contains(xml, `<reg name="flags"`)
+}
+
+func TestEscape(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("abc", escape("abc"))
+	a.Equal("}\x03}\x04}]}\x0a", escape("#$}*"))
+}
@@ -0,0 +1,80 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+)
+
+// Collision is a sprite pixel drawn over a non-transparent foreground pixel.
+type Collision struct {
+	// X and Y are the screen coordinates of the pixel.
+	X, Y int
+
+	// Old is the palette index of the overwritten pixel.
+	Old uint8
+
+	// New is the palette index of the sprite pixel.
+	New uint8
+}
+
+// Draw is a sprite draw, along with the collisions it caused.
+type Draw struct {
+	// X and Y are the screen coordinates of the sprite.
+	X, Y int
+
+	// W and H are the dimensions of the sprite, in pixels.
+	W, H int
+
+	// HFlip and VFlip are the flips the sprite was drawn with.
+	HFlip, VFlip bool
+
+	// Collisions are the pixels that collided, in drawing order.
+	Collisions []Collision
+}
+
+// CollisionLog records the last draws of a State, and which of their pixels
+// collided. It doesn't alter collision detection as seen by the CPU.
+type CollisionLog struct {
+	// N is the number of draws kept.
+	N int
+
+	// Draws are the recorded draws, oldest first.
+	Draws []Draw
+}
+
+// NewCollisionLog creates a CollisionLog keeping the last n draws.
+func NewCollisionLog(n int) *CollisionLog {
+	return &CollisionLog{N: n, Draws: make([]Draw, 0, n)}
+}
+
+// record adds a draw to the log, discarding the oldest if the log is full.
+func (l *CollisionLog) record(d Draw) {
+	if l.N <= 0 {
+		return
+	}
+	if len(l.Draws) >= l.N {
+		n := copy(l.Draws, l.Draws[len(l.Draws)-l.N+1:])
+		l.Draws = l.Draws[:n]
+	}
+	l.Draws = append(l.Draws, d)
+}
+
+// Reset forgets all recorded draws.
+func (l *CollisionLog) Reset() {
+	l.Draws = l.Draws[:0]
+}
+
+// Mask returns a screen-sized mask of the recorded collisions: collided
+// pixels are opaque, others are transparent.
+//
+// It can be used with image/draw.DrawMask to highlight collisions over a
+// screen image.
+func (l *CollisionLog) Mask() *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, ScreenW, ScreenH))
+	for _, d := range l.Draws {
+		for _, c := range d.Collisions {
+			mask.SetAlpha(c.X, c.Y, color.Alpha{0xFF})
+		}
+	}
+	return mask
+}
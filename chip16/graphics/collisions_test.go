@@ -0,0 +1,44 @@
+package graphics
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollisionLog(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.SpriteW, s.SpriteH = 1, 1
+	s.Collisions = NewCollisionLog(2)
+
+	s.DrawSprite(10, 20, []byte{0x12})
+	hit, _ := s.DrawSprite(11, 20, []byte{0x34})
+	a.True(hit, "collision semantics should be unchanged")
+
+	if a.Len(s.Collisions.Draws, 2) {
+		a.Empty(s.Collisions.Draws[0].Collisions)
+		a.Equal(Draw{
+			X: 11, Y: 20, W: 2, H: 1,
+			Collisions: []Collision{{X: 11, Y: 20, Old: 0x2, New: 0x3}},
+		}, s.Collisions.Draws[1])
+	}
+
+	mask := s.Collisions.Mask()
+	a.Equal(color.Alpha{0xFF}, mask.AlphaAt(11, 20))
+	a.Equal(color.Alpha{0x00}, mask.AlphaAt(10, 20))
+	a.Equal(color.Alpha{0x00}, mask.AlphaAt(12, 20))
+
+	// Only the last N draws are kept
+	s.HFlip = true
+	s.DrawSprite(0, 0, []byte{0x10})
+	if a.Len(s.Collisions.Draws, 2) {
+		a.Equal(11, s.Collisions.Draws[0].X)
+		a.True(s.Collisions.Draws[1].HFlip)
+	}
+
+	s.Collisions.Reset()
+	a.Empty(s.Collisions.Draws)
+	a.Equal(color.Alpha{0x00}, s.Collisions.Mask().AlphaAt(11, 20))
+}
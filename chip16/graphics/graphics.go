@@ -3,6 +3,7 @@ package graphics
 import (
 	"fmt"
 	"image/color"
+	"sync/atomic"
 )
 
 const (
@@ -50,9 +51,6 @@ type State struct {
 	// BG is the current background color (palette index).
 	BG uint8
 
-	// Screen is the current foreground image.
-	FG []uint8
-
 	// SpriteW is the width of the current sprite (in bytes).
 	// The current sprite is 2*SpriteW pixels wide.
 	SpriteW uint8
@@ -65,26 +63,156 @@ type State struct {
 
 	// VFlip tells whether the sprite(s) must be flipped vertically.
 	VFlip bool
+
+	// Collisions records the draws and their colliding pixels, if not nil.
+	Collisions *CollisionLog
+
+	// fg is the foreground image, as palette indices. Its rows are shared
+	// copy-on-write with clones, and only accessed through methods.
+	fg [ScreenH]*row
+
+	// A state only draws in place on the rows it copied since it was last
+	// cloned: fgOwned[y] is the value of *fgEpoch when row y was copied.
+	// Clones bump the epoch atomically, so that cloning doesn't race with
+	// other clones.
+	fgOwned [ScreenH]uint64
+	fgEpoch *uint64
 }
 
+type row [ScreenW]uint8
+
+// emptyRow backs the rows of a clear foreground. It is always shared, hence
+// never written.
+var emptyRow = new(row)
+
 // NewState constructs and initialize a new graphics State
 func NewState() *State {
 	p := DefaultPalette()
 	s := &State{
 		Palette: p,
-		FG:      make([]uint8, ScreenW*ScreenH),
 	}
+	s.clearFG()
 	return s
 }
 
-var emptyFG = make([]uint8, ScreenW*ScreenH)
-
 // Clear clears the screen and resets the background color.
 func (s *State) Clear() {
 	s.BG = 0
+	s.clearFG()
+}
+
+func (s *State) clearFG() {
+	if s.fgEpoch == nil {
+		s.fgEpoch = new(uint64)
+		*s.fgEpoch = 1
+	}
+	for y := range s.fg {
+		s.fg[y], s.fgOwned[y] = emptyRow, 0
+	}
+}
+
+// Clone returns an independent copy of the state. The rows of the foreground
+// are shared copy-on-write: each is only copied by the first of both states
+// to draw on it. Collisions aren't recorded by the clone.
+//
+// Clone may be called from several goroutines at once, as long as the state
+// isn't modified meanwhile.
+func (s *State) Clone() *State {
+	atomic.AddUint64(s.fgEpoch, 1)
+	c := *s
+	c.Palette = make([]color.RGBA, len(s.Palette))
+	copy(c.Palette, s.Palette)
+	c.Collisions = nil
+	c.fgOwned = [ScreenH]uint64{}
+	c.fgEpoch = new(uint64)
+	*c.fgEpoch = 1
+	return &c
+}
+
+// rowShared tells whether row y of the foreground may be shared with a clone
+func (s *State) rowShared(y int) bool {
+	return s.fgOwned[y] != atomic.LoadUint64(s.fgEpoch)
+}
+
+// writableRow returns row y of the foreground, after copying it if it is
+// shared
+func (s *State) writableRow(y int) *row {
+	if s.rowShared(y) {
+		r := *s.fg[y]
+		s.fg[y], s.fgOwned[y] = &r, atomic.LoadUint64(s.fgEpoch)
+	}
+	return s.fg[y]
+}
+
+// Pixel returns the palette index of the foreground pixel at (x, y), 0
+// being transparent.
+func (s *State) Pixel(x, y int) uint8 {
+	return s.fg[y][x]
+}
+
+// SetPixel sets the foreground pixel at (x, y).
+func (s *State) SetPixel(x, y int, c uint8) {
+	if s.fg[y][x] != c {
+		s.writableRow(y)[x] = c
+	}
+}
+
+// Row returns the pixels of row y of the foreground. It must not be
+// modified.
+func (s *State) Row(y int) []uint8 {
+	return s.fg[y][:]
+}
+
+// ReadFG copies the foreground into dst, which must hold ScreenW*ScreenH
+// pixels, row by row.
+func (s *State) ReadFG(dst []uint8) {
+	for y, r := range s.fg {
+		copy(dst[y*ScreenW:], r[:])
+	}
+}
+
+// WriteFG copies src, which must hold ScreenW*ScreenH pixels, row by row,
+// into the foreground.
+func (s *State) WriteFG(src []uint8) {
+	for y := range s.fg {
+		line := src[y*ScreenW : (y+1)*ScreenW]
+		if string(s.fg[y][:]) != string(line) {
+			copy(s.writableRow(y)[:], line)
+		}
+	}
+}
+
+// Reset restores the power-on state: a clear screen, the default palette and
+// no sprite settings. Recorded collisions are forgotten.
+func (s *State) Reset() {
+	s.Clear()
+	copy(s.Palette, defaultPalette)
+	s.SpriteW, s.SpriteH = 0, 0
+	s.HFlip, s.VFlip = false, false
+	if s.Collisions != nil {
+		s.Collisions.Reset()
+	}
+}
+
+// Compose writes the palette indices of the visible screen into dst, which
+// must hold ScreenW*ScreenH pixels: the foreground, over the background
+// color.
+func (s *State) Compose(dst []uint8) {
+	s.compose(dst, s.BG&0x0F)
+}
 
-	// This is ~6x faster than recreating the slice
-	copy(s.FG, emptyFG)
+// compose writes the foreground into dst, replacing transparent pixels with
+// bg
+func (s *State) compose(dst []uint8, bg uint8) {
+	for y, r := range s.fg {
+		line := dst[y*ScreenW : (y+1)*ScreenW]
+		for x, c := range r {
+			if c == 0 {
+				c = bg
+			}
+			line[x] = c
+		}
+	}
 }
 
 // LoadPalette loads the palette from RAM.
@@ -110,69 +238,96 @@ func (s *State) LoadPalette(mem []byte) error {
 	return nil
 }
 
+// DrawSprite draws the current sprite at (x, y), reading its pixels from
+// mem. It returns true if any of the drawn pixels overlaps a non-transparent
+// pixel of the foreground.
+//
+// Sprites are stored row by row, two pixels per byte (high nibble first).
+// Pixels of color 0 are transparent. Flips are applied to the whole sprite,
+// and pixels falling outside of the screen are clipped.
 func (s *State) DrawSprite(x, y int, mem []byte) (bool, error) {
-	w, h := int(s.SpriteW), int(s.SpriteH)
-	img := s.FG
+	stride, h := int(s.SpriteW), int(s.SpriteH)
+	w := 2 * stride
 
 	// Not enough bytes to hold the sprite we expected
-	if len(mem) < (w*h + 1) {
+	if len(mem) < stride*h {
 		return false, fmt.Errorf("sprite out of bounds")
 	}
 
-	// Nothing to draw on screen
-	if w == 0 || h == 0 || x >= ScreenW || y >= ScreenH || x+w*2 < 0 || y+x < 0 {
+	// Visible part of the sprite, in screen coordinates
+	x0, y0 := max(x, 0), max(y, 0)
+	x1, y1 := min(x+w, ScreenW), min(y+h, ScreenH)
+	if x0 >= x1 || y0 >= y1 {
+		// Off screen: the foreground doesn't need to be unshared
+		s.recordDraw(x, y, w, h, nil)
 		return false, nil
 	}
 
-	// Used to detect overlapping pixels
-	hit := 0
-
-	// Handle flips
-	startX, endX, incX := 0, w, 1
-	startY, endY, incY := 0, h, 1
-	if s.HFlip {
-		startX, endX, incX = w-1, -1, -1
-	}
-	if s.VFlip {
-		startY, endY, incY = h-1, -1, -1
-	}
-
-	// px, py: coordinates of the sprite pixels in ram
-	// i, j: coordinates of the sprite pixels in the FG image
-	j := y
-	for py := startY; py != endY; py += incY {
-		// Row is offscreen
-		if j < 0 || j > ScreenH-1 {
-			continue
+	var collisions []Collision
+	hit := false
+	for j := y0; j < y1; j++ {
+		// py: row of the sprite drawn at line j
+		py := j - y
+		if s.VFlip {
+			py = h - 1 - py
 		}
-		i := x
-		for px := startX; px != endX; px += incX {
-			// Column is offscreen
-			if i < 0 || i > ScreenW-2 {
-				continue
-			}
+		data := mem[py*stride : (py+1)*stride]
+		// Transparent rows don't unshare the foreground
+		line, writable := s.fg[j], false
 
-			p := mem[w*py+px]
-			hp := p >> 4
-			lp := p & 0x0F
+		for i := x0; i < x1; i++ {
+			// px: column of the sprite drawn at column i
+			px := i - x
 			if s.HFlip {
-				hp, lp = lp, hp
+				px = w - 1 - px
 			}
-
-			ij := ScreenW*j + i
-			if hp != 0 {
-				hit += int(img[ij])
-				img[ij] = hp
+			c := data[px>>1]
+			if px&1 == 0 {
+				c >>= 4
+			} else {
+				c &= 0x0F
+			}
+			if c == 0 {
+				continue
+			}
+			if !writable {
+				line, writable = s.writableRow(j), true
 			}
-			ij++
-			if lp != 0 {
-				hit += int(img[ij])
-				img[ij] = lp
+			if line[i] != 0 {
+				hit = true
+				if s.Collisions != nil {
+					collisions = append(collisions, Collision{i, j, line[i], c})
+				}
 			}
-			i += 2
+			line[i] = c
 		}
-		j++
 	}
 
-	return (hit > 0), nil
+	s.recordDraw(x, y, w, h, collisions)
+	return hit, nil
+}
+
+// recordDraw logs a draw, if collisions are logged
+func (s *State) recordDraw(x, y, w, h int, collisions []Collision) {
+	if s.Collisions != nil {
+		s.Collisions.record(Draw{
+			X: x, Y: y, W: w, H: h,
+			HFlip: s.HFlip, VFlip: s.VFlip,
+			Collisions: collisions,
+		})
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
@@ -0,0 +1,341 @@
+package graphics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// referenceDraw is a straightforward implementation of DrawSprite: the
+// sprite is decoded and flipped into its own image, which is then copied
+// onto the screen pixel by pixel.
+func referenceDraw(s *State, x, y int, mem []byte) bool {
+	w, h := 2*int(s.SpriteW), int(s.SpriteH)
+
+	sprite := make([][]uint8, h)
+	for py := range sprite {
+		sprite[py] = make([]uint8, w)
+		for px := range sprite[py] {
+			b := mem[py*int(s.SpriteW)+px/2]
+			if px%2 == 0 {
+				sprite[py][px] = b >> 4
+			} else {
+				sprite[py][px] = b & 0x0F
+			}
+		}
+	}
+
+	hit := false
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			sx, sy := px, py
+			if s.HFlip {
+				sx = w - 1 - px
+			}
+			if s.VFlip {
+				sy = h - 1 - py
+			}
+			c := sprite[sy][sx]
+			i, j := x+px, y+py
+			if c == 0 || i < 0 || i >= ScreenW || j < 0 || j >= ScreenH {
+				continue
+			}
+			if s.Pixel(i, j) != 0 {
+				hit = true
+			}
+			s.SetPixel(i, j, c)
+		}
+	}
+	return hit
+}
+
+// testSprite is a 6x3 sprite with distinct, mostly non-transparent pixels:
+//
+//	1 2 3 4 5 6
+//	7 8 9 A B C
+//	D E F 0 1 2
+var testSprite = []byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0, 0x12}
+
+// window returns the w*h pixels of the screen at (x, y)
+func window(s *State, x, y, w, h int) []uint8 {
+	var pixels []uint8
+	for j := y; j < y+h; j++ {
+		pixels = append(pixels, s.Row(j)[x:x+w]...)
+	}
+	return pixels
+}
+
+// foreground returns the pixels of the foreground
+func foreground(s *State) []uint8 {
+	fg := make([]uint8, ScreenW*ScreenH)
+	s.ReadFG(fg)
+	return fg
+}
+
+func TestDrawSprite(t *testing.T) {
+	a := assert.New(t)
+
+	for _, test := range []struct {
+		x, y         int
+		hflip, vflip bool
+		wx, wy       int // window to check
+		exp          []uint8
+	}{
+		{0, 0, false, false, 0, 0, []uint8{
+			0x1, 0x2, 0x3, 0x4, 0x5, 0x6,
+			0x7, 0x8, 0x9, 0xA, 0xB, 0xC,
+			0xD, 0xE, 0xF, 0x0, 0x1, 0x2,
+		}},
+		{0, 0, true, false, 0, 0, []uint8{
+			0x6, 0x5, 0x4, 0x3, 0x2, 0x1,
+			0xC, 0xB, 0xA, 0x9, 0x8, 0x7,
+			0x2, 0x1, 0x0, 0xF, 0xE, 0xD,
+		}},
+		{0, 0, false, true, 0, 0, []uint8{
+			0xD, 0xE, 0xF, 0x0, 0x1, 0x2,
+			0x7, 0x8, 0x9, 0xA, 0xB, 0xC,
+			0x1, 0x2, 0x3, 0x4, 0x5, 0x6,
+		}},
+		{0, 0, true, true, 0, 0, []uint8{
+			0x2, 0x1, 0x0, 0xF, 0xE, 0xD,
+			0xC, 0xB, 0xA, 0x9, 0x8, 0x7,
+			0x6, 0x5, 0x4, 0x3, 0x2, 0x1,
+		}},
+		// Clipped on the left and top, by an odd number of pixels
+		{-3, -1, false, false, 0, 0, []uint8{
+			0xA, 0xB, 0xC, 0x0, 0x0, 0x0,
+			0x0, 0x1, 0x2, 0x0, 0x0, 0x0,
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		}},
+		{-3, -1, true, false, 0, 0, []uint8{
+			0x9, 0x8, 0x7, 0x0, 0x0, 0x0,
+			0xF, 0xE, 0xD, 0x0, 0x0, 0x0,
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		}},
+		// Clipped on the right and bottom, by an odd number of pixels
+		{ScreenW - 3, ScreenH - 2, false, false, ScreenW - 6, ScreenH - 3, []uint8{
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			0x0, 0x0, 0x0, 0x1, 0x2, 0x3,
+			0x0, 0x0, 0x0, 0x7, 0x8, 0x9,
+		}},
+		{ScreenW - 3, ScreenH - 2, true, true, ScreenW - 6, ScreenH - 3, []uint8{
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			0x0, 0x0, 0x0, 0x2, 0x1, 0x0,
+			0x0, 0x0, 0x0, 0xC, 0xB, 0xA,
+		}},
+	} {
+		s := NewState()
+		s.SpriteW, s.SpriteH = 3, 3
+		s.HFlip, s.VFlip = test.hflip, test.vflip
+
+		hit, err := s.DrawSprite(test.x, test.y, testSprite)
+		name := fmt.Sprintf("(%d, %d) hflip=%v vflip=%v", test.x, test.y, test.hflip, test.vflip)
+		if a.NoError(err, name) {
+			a.False(hit, name)
+			a.Equal(test.exp, window(s, test.wx, test.wy, 6, 3), name)
+		}
+	}
+}
+
+// TestDrawSpriteReference compares DrawSprite with referenceDraw for
+// positions around all edges of the screen, with all flips.
+func TestDrawSpriteReference(t *testing.T) {
+	a := assert.New(t)
+
+	var xs, ys []int
+	for d := -8; d <= 8; d++ {
+		xs = append(xs, d, ScreenW/2+d, ScreenW+d)
+		ys = append(ys, d, ScreenH/2+d, ScreenH+d)
+	}
+	xs = append(xs, -32768, 32767)
+	ys = append(ys, -32768, 32767)
+
+	for _, flips := range []struct{ h, v bool }{
+		{false, false}, {true, false}, {false, true}, {true, true},
+	} {
+		got, exp := NewState(), NewState()
+		for _, s := range []*State{got, exp} {
+			s.SpriteW, s.SpriteH = 3, 3
+			s.HFlip, s.VFlip = flips.h, flips.v
+		}
+		for _, x := range xs {
+			for _, y := range ys {
+				hit, err := got.DrawSprite(x, y, testSprite)
+				if !a.NoError(err) {
+					return
+				}
+				if !a.Equal(referenceDraw(exp, x, y, testSprite), hit,
+					"collision at (%d, %d) flips=%v", x, y, flips) {
+					return
+				}
+				if !a.Equal(foreground(exp), foreground(got), "pixels at (%d, %d) flips=%v", x, y, flips) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestDrawSpriteCollision(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.SpriteW, s.SpriteH = 1, 1
+
+	hit, _ := s.DrawSprite(0, 0, []byte{0x10})
+	a.False(hit)
+
+	// Transparent pixels don't collide
+	hit, _ = s.DrawSprite(0, 0, []byte{0x01})
+	a.False(hit)
+
+	hit, _ = s.DrawSprite(-1, 0, []byte{0x01})
+	a.True(hit)
+	a.Equal([]uint8{0x1, 0x1}, s.Row(0)[:2])
+}
+
+func TestDrawSpriteErrors(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.SpriteW, s.SpriteH = 3, 3
+
+	_, err := s.DrawSprite(0, 0, testSprite[:8])
+	a.Error(err, "short sprite data should yield an error")
+
+	// Empty sprites draw nothing
+	s.SpriteW = 0
+	hit, err := s.DrawSprite(0, 0, nil)
+	a.NoError(err)
+	a.False(hit)
+}
+
+func TestCompose(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.BG = 0x3
+	s.SetPixel(1, 0, 0xF)
+
+	frame := make([]uint8, ScreenW*ScreenH)
+	s.Compose(frame)
+	a.Equal([]uint8{0x3, 0xF, 0x3}, frame[:3])
+}
+
+func BenchmarkDrawSprite(b *testing.B) {
+	s := NewState()
+	s.SpriteW, s.SpriteH = 8, 16
+	mem := make([]byte, 8*16)
+	for i := range mem {
+		mem[i] = 0xAA
+	}
+	for n := 0; n < b.N; n++ {
+		if _, err := s.DrawSprite(n%ScreenW-8, n%ScreenH-8, mem); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.Collisions = NewCollisionLog(4)
+
+	s.BG = 3
+	s.SetPixel(42, 0, 5)
+	s.Palette[1].R = 0x42
+	s.SpriteW, s.SpriteH = 2, 2
+	s.HFlip, s.VFlip = true, true
+	s.DrawSprite(42, 0, []byte{0x11, 0x11, 0x11, 0x11})
+	a.Len(s.Collisions.Draws, 1)
+
+	s.Reset()
+	a.Equal(uint8(0), s.BG)
+	a.Equal(make([]uint8, ScreenW*ScreenH), foreground(s))
+	a.Equal(DefaultPalette(), s.Palette)
+	a.Equal(uint8(0), s.SpriteW)
+	a.Equal(uint8(0), s.SpriteH)
+	a.False(s.HFlip)
+	a.False(s.VFlip)
+	a.Empty(s.Collisions.Draws)
+}
+
+func TestClone(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.Collisions = NewCollisionLog(4)
+	s.SpriteW, s.SpriteH = 1, 1
+	s.DrawSprite(0, 0, []byte{0x11})
+
+	c := s.Clone()
+	a.Nil(c.Collisions)
+	a.Equal(foreground(s), foreground(c))
+
+	// Draws are isolated
+	c.DrawSprite(2, 0, []byte{0x22})
+	a.Equal([]uint8{1, 1, 0, 0}, s.Row(0)[:4])
+	a.Equal([]uint8{1, 1, 2, 2}, c.Row(0)[:4])
+	s.DrawSprite(0, 0, []byte{0x33})
+	a.Equal([]uint8{3, 3, 0, 0}, s.Row(0)[:4])
+	a.Equal([]uint8{1, 1, 2, 2}, c.Row(0)[:4])
+
+	// Only the rows drawn on are copied
+	c = s.Clone()
+	c.DrawSprite(0, 1, []byte{0x44})
+	a.True(c.rowShared(0))
+	a.False(c.rowShared(1))
+	a.Equal(uint8(0), s.Pixel(0, 1))
+	a.Equal(uint8(4), c.Pixel(0, 1))
+	c.SetPixel(0, 2, 0)
+	a.True(c.rowShared(2), "writing unchanged pixels shouldn't copy rows")
+	c.SetPixel(0, 2, 5)
+	a.Equal(uint8(0), s.Pixel(0, 2))
+
+	// Off-screen draws don't unshare the foreground
+	c = s.Clone()
+	c.DrawSprite(-2, 0, []byte{0x44})
+	c.DrawSprite(0, ScreenH, []byte{0x44})
+	for y := range c.fg {
+		a.True(c.rowShared(y))
+	}
+
+	// Neither do transparent rows
+	c = s.Clone()
+	c.SpriteW, c.SpriteH = 1, 3
+	c.DrawSprite(0, 4, []byte{0x00, 0x60, 0x00})
+	a.True(c.rowShared(4))
+	a.False(c.rowShared(5))
+	a.True(c.rowShared(6))
+	a.Equal(uint8(6), c.Pixel(0, 5))
+
+	// So are clears
+	c = s.Clone()
+	c.Clear()
+	a.Equal(uint8(3), s.Pixel(0, 0))
+	a.Equal(uint8(0), c.Pixel(0, 0))
+	s.Clear()
+	a.Equal(uint8(0), s.Pixel(0, 0))
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.SetPixel(0, 0, 1)
+
+	var wg sync.WaitGroup
+	clones := make([]*State, 8)
+	for i := range clones {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clones[i] = s.Clone()
+			clones[i].SetPixel(0, 0, uint8(i+2))
+		}(i)
+	}
+	wg.Wait()
+
+	s.SetPixel(0, 0, 15)
+	for i, c := range clones {
+		a.Equal(uint8(i+2), c.Pixel(0, 0))
+	}
+	a.Equal(uint8(15), s.Pixel(0, 0))
+}
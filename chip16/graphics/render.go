@@ -0,0 +1,378 @@
+package graphics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+)
+
+// Filter is a scaling filter used by a Renderer.
+type Filter int
+
+const (
+	// Nearest scales pixels up as plain squares.
+	Nearest Filter = iota
+
+	// Scale2x is the Scale2x (EPX) edge-preserving filter. Larger scales are
+	// obtained by applying it repeatedly, so they must be powers of two.
+	Scale2x
+
+	// HQ smooths diagonal edges by blending the colors along them, in the
+	// spirit of the hqx filters.
+	HQ
+
+	// Scanlines scales pixels up like Nearest, and darkens the last line of
+	// each row of pixels, like the scanlines of a CRT screen.
+	Scanlines
+)
+
+func (f Filter) String() string {
+	switch f {
+	case Nearest:
+		return "nearest"
+	case Scale2x:
+		return "scale2x"
+	case HQ:
+		return "hq"
+	case Scanlines:
+		return "scanlines"
+	}
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// Layer is a set of screen layers.
+type Layer uint8
+
+const (
+	// LayerBG is the background color
+	LayerBG Layer = 1 << iota
+
+	// LayerFG is the foreground image, where sprites are drawn
+	LayerFG
+
+	// LayerAll is the full screen image
+	LayerAll = LayerBG | LayerFG
+)
+
+// transparent is the color index of pixels that belong to no rendered layer
+const transparent = 16
+
+// Renderer renders the screen into RGBA images, on the CPU.
+type Renderer struct {
+	// Scale is the integer scaling factor of rendered images.
+	Scale int
+
+	// Filter is the scaling filter.
+	Filter Filter
+
+	// Layers are the screen layers to render. Pixels belonging to none of
+	// them are transparent.
+	Layers Layer
+
+	colors  [transparent + 1]uint32 // palette, as little-endian RGBA
+	frame   []uint8                 // indices into colors
+	buf     []uint32                // Scale2x passes
+	tmp     []uint32
+	similar [transparent + 1][transparent + 1]bool
+	mix     [transparent + 1][transparent + 1]uint32
+}
+
+// NewRenderer creates a Renderer rendering all layers.
+func NewRenderer(scale int, f Filter) *Renderer {
+	return &Renderer{
+		Scale:  scale,
+		Filter: f,
+		Layers: LayerAll,
+		frame:  make([]uint8, ScreenW*ScreenH),
+	}
+}
+
+// Bounds returns the bounds of rendered images.
+func (r *Renderer) Bounds() image.Rectangle {
+	return image.Rect(0, 0, ScreenW*r.Scale, ScreenH*r.Scale)
+}
+
+// NewImage allocates an image to render to.
+func (r *Renderer) NewImage() *image.RGBA {
+	return image.NewRGBA(r.Bounds())
+}
+
+// Render renders the screen of s into dst, at dst.Rect.Min.
+func (r *Renderer) Render(dst *image.RGBA, s *State) error {
+	size := r.Bounds().Size()
+	if r.Scale < 1 {
+		return fmt.Errorf("invalid scale %d", r.Scale)
+	}
+	if dst.Rect.Dx() < size.X || dst.Rect.Dy() < size.Y {
+		return fmt.Errorf("image too small: %v < %v", dst.Rect.Size(), size)
+	}
+	if r.Filter == Scale2x && r.Scale&(r.Scale-1) != 0 {
+		return fmt.Errorf("%s: scale %d isn't a power of two", r.Filter, r.Scale)
+	}
+
+	r.compose(s)
+	switch r.Filter {
+	case Nearest, Scanlines:
+		r.renderNearest(dst)
+	case Scale2x:
+		r.renderScale2x(dst)
+	case HQ:
+		r.renderHQ(dst)
+	default:
+		return fmt.Errorf("unknown filter %s", r.Filter)
+	}
+	return nil
+}
+
+// compose flattens the rendered layers of s into r.frame, and loads its
+// palette.
+func (r *Renderer) compose(s *State) {
+	for i, c := range s.Palette {
+		r.colors[i] = uint32(c.R) | uint32(c.G)<<8 | uint32(c.B)<<16 | 0xFF<<24
+	}
+	r.colors[transparent] = 0
+
+	bg := uint8(transparent)
+	if r.Layers&LayerBG != 0 {
+		bg = s.BG & 0x0F
+	}
+	switch r.Layers & LayerAll {
+	case LayerAll:
+		s.Compose(r.frame)
+		return
+	case LayerBG, 0:
+		for i := range r.frame {
+			r.frame[i] = bg
+		}
+		return
+	}
+	s.compose(r.frame, bg)
+}
+
+// row returns the pixels of line y of dst, starting at dst.Rect.Min.
+func (r *Renderer) row(dst *image.RGBA, y int) []byte {
+	i := dst.PixOffset(dst.Rect.Min.X, dst.Rect.Min.Y+y)
+	return dst.Pix[i : i+4*ScreenW*r.Scale]
+}
+
+func (r *Renderer) renderNearest(dst *image.RGBA) {
+	s := r.Scale
+	for y := 0; y < ScreenH; y++ {
+		line := r.row(dst, y*s)
+		o := 0
+		for _, c := range r.frame[y*ScreenW : (y+1)*ScreenW] {
+			rgba := r.colors[c]
+			for k := 0; k < s; k++ {
+				binary.LittleEndian.PutUint32(line[o:], rgba)
+				o += 4
+			}
+		}
+		for k := 1; k < s; k++ {
+			copy(r.row(dst, y*s+k), line)
+		}
+		if r.Filter == Scanlines && s > 1 {
+			darken(r.row(dst, y*s+s-1))
+		}
+	}
+}
+
+// darken halves the intensity of a line of RGBA pixels
+func darken(line []byte) {
+	for i := 0; i < len(line); i += 4 {
+		line[i] >>= 1
+		line[i+1] >>= 1
+		line[i+2] >>= 1
+	}
+}
+
+func (r *Renderer) renderScale2x(dst *image.RGBA) {
+	n := ScreenW * ScreenH * r.Scale * r.Scale
+	if len(r.buf) < n {
+		r.buf = make([]uint32, n)
+		r.tmp = make([]uint32, n)
+	}
+
+	src := r.buf[:ScreenW*ScreenH]
+	for i, c := range r.frame {
+		src[i] = r.colors[c]
+	}
+	w, h := ScreenW, ScreenH
+	for s := 1; s < r.Scale; s *= 2 {
+		out := r.tmp[:4*w*h]
+		scale2x(out, src, w, h)
+		w, h = 2*w, 2*h
+		src, r.buf, r.tmp = out, r.tmp, r.buf
+	}
+
+	for y := 0; y < h; y++ {
+		line := r.row(dst, y)
+		for x, c := range src[y*w : (y+1)*w] {
+			binary.LittleEndian.PutUint32(line[4*x:], c)
+		}
+	}
+}
+
+// scale2x applies the Scale2x algorithm to the w*h image src, writing the
+// 2w*2h result to dst.
+func scale2x(dst, src []uint32, w, h int) {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Neighbours of e, edges being repeated
+			e := src[y*w+x]
+			b, d, f, h2 := e, e, e, e
+			if y > 0 {
+				b = src[(y-1)*w+x]
+			}
+			if x > 0 {
+				d = src[y*w+x-1]
+			}
+			if x < w-1 {
+				f = src[y*w+x+1]
+			}
+			if y < h-1 {
+				h2 = src[(y+1)*w+x]
+			}
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != h2 && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == h2 {
+					e2 = d
+				}
+				if h2 == f {
+					e3 = f
+				}
+			}
+			i := 2*y*2*w + 2*x
+			dst[i], dst[i+1] = e0, e1
+			dst[i+2*w], dst[i+2*w+1] = e2, e3
+		}
+	}
+}
+
+// YUV thresholds under which colors are considered similar, as in hqx
+const (
+	thresholdY = 0x30
+	thresholdU = 0x07
+	thresholdV = 0x06
+)
+
+// loadHQ computes the similarity and blending tables of the current palette
+func (r *Renderer) loadHQ() {
+	var yuv [transparent + 1][3]int
+	for i, c := range r.colors {
+		cr, cg, cb := int(c&0xFF), int(c>>8&0xFF), int(c>>16&0xFF)
+		yuv[i] = [3]int{
+			(299*cr + 587*cg + 114*cb) / 1000,
+			(-169*cr-331*cg+500*cb)/1000 + 128,
+			(500*cr-419*cg-81*cb)/1000 + 128,
+		}
+	}
+	for i := range r.colors {
+		for j := range r.colors {
+			r.similar[i][j] = i == j || i != transparent && j != transparent &&
+				abs(yuv[i][0]-yuv[j][0]) <= thresholdY &&
+				abs(yuv[i][1]-yuv[j][1]) <= thresholdU &&
+				abs(yuv[i][2]-yuv[j][2]) <= thresholdV
+
+			var m uint32
+			for k := uint(0); k < 32; k += 8 {
+				m |= ((r.colors[i]>>k&0xFF + r.colors[j]>>k&0xFF) / 2) << k
+			}
+			r.mix[i][j] = m
+		}
+	}
+}
+
+func (r *Renderer) renderHQ(dst *image.RGBA) {
+	r.loadHQ()
+	s := r.Scale
+	fr := r.frame
+
+	for y := 0; y < ScreenH; y++ {
+		for x := 0; x < ScreenW; x++ {
+			e := fr[y*ScreenW+x]
+			b, d, f, h := e, e, e, e
+			if y > 0 {
+				b = fr[(y-1)*ScreenW+x]
+			}
+			if x > 0 {
+				d = fr[y*ScreenW+x-1]
+			}
+			if x < ScreenW-1 {
+				f = fr[y*ScreenW+x+1]
+			}
+			if y < ScreenH-1 {
+				h = fr[(y+1)*ScreenW+x]
+			}
+
+			// Corners crossed by an edge, and the color beyond it:
+			// top-left, top-right, bottom-left, bottom-right
+			var corners [4]uint8
+			edges := false
+			if s > 1 && !r.similar[b][h] && !r.similar[d][f] {
+				for i, n := range [4][2]uint8{{d, b}, {b, f}, {d, h}, {h, f}} {
+					corners[i] = transparent + 1
+					if r.similar[n[0]][n[1]] && !r.similar[e][n[0]] {
+						corners[i] = n[0]
+						edges = true
+					}
+				}
+			}
+
+			fill := r.colors[e]
+			for v := 0; v < s; v++ {
+				line := r.row(dst, y*s+v)[4*x*s:]
+				for u := 0; u < s; u++ {
+					c := fill
+					if edges {
+						c = r.hqPixel(e, corners, u, v)
+					}
+					binary.LittleEndian.PutUint32(line[4*u:], c)
+				}
+			}
+		}
+	}
+}
+
+// hqPixel returns the color of pixel (u, v) in the scaled-up block of color
+// e, given the colors beyond the edges crossing its corners.
+//
+// Edges run diagonally through the middle of the block's sides: pixels
+// beyond an edge take the color on the other side, and pixels on the edge
+// are blended.
+func (r *Renderer) hqPixel(e uint8, corners [4]uint8, u, v int) uint32 {
+	s := r.Scale
+	i := 0
+	if u >= s/2 {
+		i, u = i+1, s-1-u
+	}
+	if v >= s/2 {
+		i, v = i+2, s-1-v
+	}
+	n := corners[i]
+	if n > transparent {
+		return r.colors[e]
+	}
+
+	// Signed distance of the pixel's center to the edge, times 2
+	switch dist := 2*(u+v+1) - s; {
+	case dist < -1:
+		return r.colors[n]
+	case dist <= 1:
+		return r.mix[e][n]
+	}
+	return r.colors[e]
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,178 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderNearest(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.BG = 0x3
+	s.SetPixel(1, 0, 0xF)
+
+	r := NewRenderer(2, Nearest)
+	img := r.NewImage()
+	if a.NoError(r.Render(img, s)) {
+		a.Equal(image.Rect(0, 0, 2*ScreenW, 2*ScreenH), img.Bounds())
+		red := color.RGBA{0xBF, 0x39, 0x32, 0xFF}
+		white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+		a.Equal(red, img.RGBAAt(0, 0))
+		a.Equal(red, img.RGBAAt(1, 1))
+		a.Equal(white, img.RGBAAt(2, 0))
+		a.Equal(white, img.RGBAAt(3, 1))
+		a.Equal(red, img.RGBAAt(4, 0))
+	}
+
+	// Rendering into a sub-image
+	big := image.NewRGBA(image.Rect(0, 0, 2*ScreenW+10, 2*ScreenH+10))
+	sub := big.SubImage(image.Rect(10, 10, 2*ScreenW+10, 2*ScreenH+10)).(*image.RGBA)
+	if a.NoError(r.Render(sub, s)) {
+		a.Equal(color.RGBA{}, big.RGBAAt(9, 9))
+		a.Equal(img.RGBAAt(2, 0), big.RGBAAt(12, 10))
+	}
+}
+
+func TestRenderLayers(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.BG = 0x3
+	s.SetPixel(1, 0, 0xF)
+
+	r := NewRenderer(1, Nearest)
+	img := r.NewImage()
+
+	r.Layers = LayerFG
+	if a.NoError(r.Render(img, s)) {
+		a.Equal(color.RGBA{}, img.RGBAAt(0, 0))
+		a.Equal(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, img.RGBAAt(1, 0))
+	}
+
+	r.Layers = LayerBG
+	if a.NoError(r.Render(img, s)) {
+		a.Equal(color.RGBA{0xBF, 0x39, 0x32, 0xFF}, img.RGBAAt(1, 0))
+	}
+}
+
+func TestRenderScanlines(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+	s.BG = 0xF
+
+	r := NewRenderer(3, Scanlines)
+	img := r.NewImage()
+	if a.NoError(r.Render(img, s)) {
+		a.Equal(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, img.RGBAAt(0, 0))
+		a.Equal(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, img.RGBAAt(0, 1))
+		a.Equal(color.RGBA{0x7F, 0x7F, 0x7F, 0xFF}, img.RGBAAt(0, 2))
+		a.Equal(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, img.RGBAAt(0, 3))
+	}
+}
+
+// diagonal draws a staircase of white pixels on black:
+//
+//	W .
+//	. W
+func diagonal() *State {
+	s := NewState()
+	s.BG = 0x1
+	s.SetPixel(0, 0, 0xF)
+	s.SetPixel(1, 1, 0xF)
+	return s
+}
+
+func TestRenderScale2x(t *testing.T) {
+	a := assert.New(t)
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	black := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+
+	r := NewRenderer(2, Scale2x)
+	img := r.NewImage()
+	if a.NoError(r.Render(img, diagonal())) {
+		// The black pixel at (1, 0) gets its bottom-left corner filled
+		a.Equal(black, img.RGBAAt(2, 0))
+		a.Equal(white, img.RGBAAt(2, 1))
+		a.Equal(black, img.RGBAAt(3, 1))
+	}
+
+	r = NewRenderer(4, Scale2x)
+	img = r.NewImage()
+	if a.NoError(r.Render(img, diagonal())) {
+		a.Equal(image.Rect(0, 0, 4*ScreenW, 4*ScreenH), img.Bounds())
+		a.Equal(white, img.RGBAAt(4, 3))
+		a.Equal(black, img.RGBAAt(7, 0))
+	}
+
+	r.Scale = 3
+	a.Error(r.Render(image.NewRGBA(r.Bounds()), diagonal()), "scale2x only supports powers of two")
+}
+
+func TestRenderHQ(t *testing.T) {
+	a := assert.New(t)
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	black := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	gray := color.RGBA{0x7F, 0x7F, 0x7F, 0xFF}
+
+	r := NewRenderer(4, HQ)
+	img := r.NewImage()
+	if a.NoError(r.Render(img, diagonal())) {
+		// Bottom-left corner of the black pixel at (1, 0)
+		a.Equal(white, img.RGBAAt(4, 3))
+		a.Equal(gray, img.RGBAAt(4, 2))
+		a.Equal(gray, img.RGBAAt(5, 3))
+		a.Equal(black, img.RGBAAt(5, 2))
+		a.Equal(black, img.RGBAAt(7, 0))
+	}
+
+	// Without edges, HQ renders like Nearest
+	s := NewState()
+	s.BG = 0x3
+	nearest := NewRenderer(4, Nearest)
+	exp := nearest.NewImage()
+	a.NoError(nearest.Render(exp, s))
+	a.NoError(r.Render(img, s))
+	a.Equal(exp.Pix, img.Pix)
+}
+
+func TestRenderErrors(t *testing.T) {
+	a := assert.New(t)
+	s := NewState()
+
+	r := NewRenderer(2, Nearest)
+	a.Error(r.Render(image.NewRGBA(image.Rect(0, 0, ScreenW, ScreenH)), s))
+
+	r = NewRenderer(0, Nearest)
+	a.Error(r.Render(image.NewRGBA(image.Rect(0, 0, ScreenW, ScreenH)), s))
+
+	r = NewRenderer(1, Filter(42))
+	a.Error(r.Render(r.NewImage(), s))
+}
+
+// BenchmarkRender renders random screens at 4x. Each render must take less
+// than 16ms to sustain 60 fps.
+func BenchmarkRender(b *testing.B) {
+	s := NewState()
+	for y := 0; y < ScreenH; y++ {
+		for x := 0; x < ScreenW; x++ {
+			if rand.Intn(4) == 0 {
+				s.SetPixel(x, y, uint8(rand.Intn(16)))
+			}
+		}
+	}
+	for _, f := range []Filter{Nearest, Scale2x, HQ, Scanlines} {
+		b.Run(fmt.Sprintf("%s-4x", f), func(b *testing.B) {
+			r := NewRenderer(4, f)
+			img := r.NewImage()
+			for n := 0; n < b.N; n++ {
+				if err := r.Render(img, s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
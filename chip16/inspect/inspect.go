@@ -0,0 +1,146 @@
+// Package inspect renders the state of the GPU, to debug rendering issues:
+// the palette, the screen layers, and memory viewed as sprites.
+package inspect
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/sprite"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// SwatchesPerRow is the number of palette swatches on each row
+const SwatchesPerRow = 8
+
+// Summary describes the GPU settings in a line: background color, sprite
+// dimensions and flips.
+func Summary(g *graphics.State) string {
+	bg := g.BG & 0x0F
+	c := g.Palette[bg]
+	return fmt.Sprintf("bg %X (#%02X%02X%02X)  sprite %dx%d (spr 0x%02X%02X)  hflip %v  vflip %v",
+		bg, c.R, c.G, c.B, 2*int(g.SpriteW), g.SpriteH, g.SpriteH, g.SpriteW, g.HFlip, g.VFlip)
+}
+
+// PaletteText lists the palette, one color per line, marking the background
+// color.
+func PaletteText(g *graphics.State) string {
+	var b strings.Builder
+	for i, c := range g.Palette {
+		fmt.Fprintf(&b, "%X #%02X%02X%02X", i, c.R, c.G, c.B)
+		if uint8(i) == g.BG&0x0F {
+			b.WriteString(" bg")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Palette renders the palette as size×size swatches, in rows of
+// SwatchesPerRow. The background color's swatch is framed, in black or
+// white, whichever contrasts best.
+func Palette(g *graphics.State, size int) *image.RGBA {
+	n := len(g.Palette)
+	rows := (n + SwatchesPerRow - 1) / SwatchesPerRow
+	img := image.NewRGBA(image.Rect(0, 0, SwatchesPerRow*size, rows*size))
+	for i, c := range g.Palette {
+		c.A = 0xFF
+		r := image.Rect(0, 0, size, size).Add(image.Pt(i%SwatchesPerRow*size, i/SwatchesPerRow*size))
+		draw.Draw(img, r, image.NewUniform(c), image.ZP, draw.Src)
+		if uint8(i) == g.BG&0x0F {
+			frame(img, r, contrast(c))
+		}
+	}
+	return img
+}
+
+// frame draws a 1-pixel border inside r
+func frame(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for x := r.Min.X; x < r.Max.X; x++ {
+		img.SetRGBA(x, r.Min.Y, c)
+		img.SetRGBA(x, r.Max.Y-1, c)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		img.SetRGBA(r.Min.X, y, c)
+		img.SetRGBA(r.Max.X-1, y, c)
+	}
+}
+
+// contrast returns black or white, whichever contrasts best with c
+func contrast(c color.RGBA) color.RGBA {
+	if 299*int(c.R)+587*int(c.G)+114*int(c.B) > 128*1000 {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+	return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+}
+
+// Layers renders the given screen layers, at the given scale. Pixels that
+// belong to no rendered layer are transparent.
+func Layers(g *graphics.State, l graphics.Layer, scale int) (*image.RGBA, error) {
+	r := graphics.NewRenderer(scale, graphics.Nearest)
+	r.Layers = l
+	img := r.NewImage()
+	if err := r.Render(img, g); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Sprite renders the sprite at addr in ram, with the current sprite
+// dimensions and flips, at the given scale. Transparent pixels stay
+// transparent.
+func Sprite(g *graphics.State, ram []byte, addr vm.Pointer, scale int) (*image.RGBA, error) {
+	return Sheet(g, ram, addr, 1, 1, scale)
+}
+
+// Sheet renders n consecutive sprites from addr, like Sprite, in rows of
+// cols sprites separated by a transparent pixel.
+func Sheet(g *graphics.State, ram []byte, addr vm.Pointer, n, cols, scale int) (*image.RGBA, error) {
+	stride, h := int(g.SpriteW), int(g.SpriteH)
+	w := 2 * stride
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("empty sprite dimensions")
+	}
+	if n < 1 || cols < 1 || scale < 1 {
+		return nil, fmt.Errorf("invalid sheet layout")
+	}
+	if int(addr)+n*stride*h > len(ram) {
+		return nil, fmt.Errorf("sprites out of bounds")
+	}
+	if cols > n {
+		cols = n
+	}
+	rows := (n + cols - 1) / cols
+
+	img := image.NewRGBA(image.Rect(0, 0, (cols*(w+1)-1)*scale, (rows*(h+1)-1)*scale))
+	for i := 0; i < n; i++ {
+		start := int(addr) + i*stride*h
+		s := &sprite.Sprite{W: w, H: h, Data: ram[start : start+stride*h]}
+		x0, y0 := i%cols*(w+1)*scale, i/cols*(h+1)*scale
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				// The pixel drawn at (x, y), as DRW would draw it
+				sx, sy := x, y
+				if g.HFlip {
+					sx = w - 1 - x
+				}
+				if g.VFlip {
+					sy = h - 1 - y
+				}
+				c := s.At(sx, sy)
+				if c == 0 {
+					continue
+				}
+				rgba := g.Palette[c]
+				rgba.A = 0xFF
+				r := image.Rect(x0+x*scale, y0+y*scale, x0+(x+1)*scale, y0+(y+1)*scale)
+				draw.Draw(img, r, image.NewUniform(rgba), image.ZP, draw.Src)
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,124 @@
+package inspect
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	transparent = color.RGBA{}
+	black       = color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	white       = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	red         = color.RGBA{0xBF, 0x39, 0x32, 0xFF}
+)
+
+func TestSummary(t *testing.T) {
+	a := assert.New(t)
+	g := graphics.NewState()
+	g.BG = 3
+	g.SpriteW, g.SpriteH = 4, 8
+	g.VFlip = true
+
+	a.Equal("bg 3 (#BF3932)  sprite 8x8 (spr 0x0804)  hflip false  vflip true", Summary(g))
+	lines := strings.Split(PaletteText(g), "\n")
+	if a.Len(lines, 17) {
+		a.Equal("0 #000000", lines[0])
+		a.Equal("3 #BF3932 bg", lines[3])
+		a.Equal("F #FFFFFF", lines[15])
+	}
+}
+
+func TestPalette(t *testing.T) {
+	a := assert.New(t)
+	g := graphics.NewState()
+	g.BG = 0xF
+
+	img := Palette(g, 4)
+	a.Equal(image.Rect(0, 0, 32, 8), img.Bounds())
+	a.Equal(black, img.At(1, 1), "swatches should be opaque")
+	a.Equal(red, img.At(12, 0))
+	a.Equal(red, img.At(15, 3))
+
+	// White background, framed in black
+	a.Equal(black, img.At(28, 4))
+	a.Equal(black, img.At(31, 7))
+	a.Equal(white, img.At(29, 5))
+
+	g.BG = 1
+	a.Equal(white, Palette(g, 4).At(4, 0), "black should be framed in white")
+}
+
+func TestLayers(t *testing.T) {
+	a := assert.New(t)
+	g := graphics.NewState()
+	g.BG = 3
+	g.SetPixel(1, 0, 0xF)
+
+	img, err := Layers(g, graphics.LayerFG, 2)
+	if a.NoError(err) {
+		a.Equal(image.Rect(0, 0, 640, 480), img.Bounds())
+		a.Equal(transparent, img.At(0, 0))
+		a.Equal(white, img.At(2, 0))
+	}
+	img, err = Layers(g, graphics.LayerBG, 1)
+	if a.NoError(err) {
+		a.Equal(red, img.At(1, 0))
+	}
+	_, err = Layers(g, graphics.LayerAll, 0)
+	a.Error(err)
+}
+
+func TestSheet(t *testing.T) {
+	a := assert.New(t)
+	g := graphics.NewState()
+	g.SpriteW, g.SpriteH = 1, 2
+	ram := []byte{
+		0x00, 0x00, // Padding
+		0xF0, 0x13, // Sprite 0
+		0x33, 0x00, // Sprite 1
+		0x11, 0x11, // Sprite 2
+	}
+
+	img, err := Sprite(g, ram, 2, 2)
+	if a.NoError(err) {
+		a.Equal(image.Rect(0, 0, 4, 4), img.Bounds())
+		a.Equal(white, img.At(1, 1))
+		a.Equal(transparent, img.At(2, 0))
+		a.Equal(black, img.At(0, 2))
+		a.Equal(red, img.At(3, 3))
+	}
+
+	g.HFlip, g.VFlip = true, true
+	img, err = Sheet(g, ram, 2, 3, 2, 1)
+	if a.NoError(err) {
+		// Two rows of two sprites, with 1-pixel gaps
+		a.Equal(image.Rect(0, 0, 5, 5), img.Bounds())
+		a.Equal([]color.Color{red, black, transparent, transparent, transparent},
+			row(img, 0), "sprites should be flipped")
+		a.Equal([]color.Color{transparent, white, transparent, red, red}, row(img, 1))
+		a.Equal(transparent, img.At(0, 2))
+		a.Equal(black, img.At(0, 3))
+		a.Equal(transparent, img.At(3, 3))
+	}
+
+	_, err = Sheet(g, ram, 2, 4, 2, 1)
+	a.Error(err, "sprites out of bounds")
+	_, err = Sheet(g, ram, 2, 0, 2, 1)
+	a.Error(err)
+	g.SpriteW = 0
+	_, err = Sprite(g, ram, 0, 1)
+	a.Error(err, "empty sprites")
+}
+
+func row(img image.Image, y int) []color.Color {
+	var c []color.Color
+	for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+		c = append(c, img.At(x, y))
+	}
+	return c
+}
@@ -0,0 +1,261 @@
+// Package chip16 embeds a chip16 machine in Go programs.
+//
+// A Machine runs a ROM frame by frame: programs set its input, run a frame,
+// and fetch the resulting image and sound.
+//
+//		m, err := chip16.New(chip16.WithScale(2))
+//		if err != nil {
+//			...
+//		}
+//		if err := m.LoadROM(f); err != nil {
+//			...
+//		}
+//		for {
+//			m.SetInput(0, chip16.ButtonRight)
+//			if err := m.RunFrame(); err != nil {
+//				...
+//			}
+//			img, _ := m.Framebuffer()
+//			sound := m.AudioSamples()
+//			...
+//		}
+package chip16
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cheat"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/rom"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+const (
+	// ScreenW is the width of the screen
+	ScreenW = graphics.ScreenW
+	// ScreenH is the height of the screen
+	ScreenH = graphics.ScreenH
+	// FrameRate is the number of frames per second
+	FrameRate = cpu.FrameRate
+	// SampleRate is the number of sound samples per second
+	SampleRate = audio.SampleRate
+)
+
+// Controller buttons, as bits of SetInput's bitmask
+const (
+	ButtonUp     = vm.ButtonUp
+	ButtonDown   = vm.ButtonDown
+	ButtonLeft   = vm.ButtonLeft
+	ButtonRight  = vm.ButtonRight
+	ButtonSelect = vm.ButtonSelect
+	ButtonStart  = vm.ButtonStart
+	ButtonA      = vm.ButtonA
+	ButtonB      = vm.ButtonB
+)
+
+// Option configures a Machine.
+type Option func(*Machine)
+
+// WithScale sets the scaling factor of the framebuffer (1 by default).
+func WithScale(n int) Option {
+	return func(m *Machine) {
+		m.renderer.Scale = n
+	}
+}
+
+// WithFilter sets the scaling filter of the framebuffer (Nearest by
+// default).
+func WithFilter(f graphics.Filter) Option {
+	return func(m *Machine) {
+		m.renderer.Filter = f
+	}
+}
+
+// WithStrictCalls makes RET instructions that don't match the innermost call
+// fail.
+func WithStrictCalls() Option {
+	return func(m *Machine) {
+		m.strictCalls = true
+	}
+}
+
+// WithTimings sets the instruction timings (one cycle per instruction by
+// default).
+func WithTimings(t *cpu.Timings) Option {
+	return func(m *Machine) {
+		m.timing = t.Cycles
+	}
+}
+
+// WithHook sets a function called after each executed instruction (see
+// vm.State.Hook), e.g. to profile a ROM with profile.Profiler.Hook. Clones
+// don't inherit it.
+func WithHook(h func(*vm.State, vm.Executed)) Option {
+	return func(m *Machine) {
+		m.hook = h
+	}
+}
+
+// Machine is a chip16 console.
+type Machine struct {
+	v           *vm.State
+	rom         *rom.ROM
+	input       [2]uint16
+	strictCalls bool
+	timing      func(*vm.State, vm.Opcode) uint64
+	hook        func(*vm.State, vm.Executed)
+	cheats      *cheat.List
+
+	renderer *graphics.Renderer
+	image    *image.RGBA
+	samples  []int16
+}
+
+// New creates a Machine, with no ROM loaded.
+func New(opts ...Option) (*Machine, error) {
+	m := &Machine{
+		v:        vm.NewState(),
+		renderer: graphics.NewRenderer(1, graphics.Nearest),
+		samples:  make([]int16, audio.SamplesPerFrame),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// Validate the rendering options on a dummy frame
+	m.image = m.renderer.NewImage()
+	if err := m.renderer.Render(m.image, m.v.Graphics); err != nil {
+		return nil, err
+	}
+	m.v.StrictCalls = m.strictCalls
+	m.v.Timing = m.timing
+	m.v.Hook = m.hook
+	return m, nil
+}
+
+// LoadROM reads a ROM image, in the .c16 format or headerless, and resets
+// the machine to run it.
+func (m *Machine) LoadROM(r io.Reader) error {
+	rm, err := rom.Read(r)
+	if err != nil {
+		return err
+	}
+	m.rom = rm
+	m.Reset()
+	return nil
+}
+
+// LoadFile creates a Machine running the ROM file at path.
+func LoadFile(path string, opts ...Option) (*Machine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.LoadROM(f); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return m, nil
+}
+
+// Reset powers the machine off and on: the loaded ROM starts over, from a
+// clear memory.
+func (m *Machine) Reset() {
+	m.v.Reset()
+	if m.rom != nil {
+		// The ROM was checked when loaded
+		m.rom.Load(m.v)
+	}
+	m.silence()
+}
+
+// SoftReset restarts the loaded ROM like Reset, but keeps the memory as is,
+// for games that rely on data surviving resets.
+func (m *Machine) SoftReset() {
+	m.v.SoftReset()
+	if m.rom != nil {
+		m.v.PC = m.rom.Start
+	}
+	m.silence()
+}
+
+// silence clears the sound of the last frame
+func (m *Machine) silence() {
+	for i := range m.samples {
+		m.samples[i] = 0
+	}
+}
+
+// SetInput sets the buttons pressed on controller n (0 or 1), for the next
+// frames.
+func (m *Machine) SetInput(n int, buttons uint16) {
+	if n < 0 || n >= len(m.input) {
+		panic(fmt.Sprintf("chip16: no controller %d", n))
+	}
+	m.input[n] = buttons
+}
+
+// ROM returns the loaded ROM, or nil.
+func (m *Machine) ROM() *rom.ROM {
+	return m.rom
+}
+
+// SetCheats sets the cheats applied at the start of every frame, or removes
+// them if l is nil. Clones share them.
+func (m *Machine) SetCheats(l *cheat.List) {
+	m.cheats = l
+}
+
+// Cheats returns the cheats set by SetCheats.
+func (m *Machine) Cheats() *cheat.List {
+	return m.cheats
+}
+
+// RunFrame runs the machine for a frame, and generates its sound.
+func (m *Machine) RunFrame() error {
+	for i, buttons := range m.input {
+		m.v.SetController(i, buttons)
+	}
+	if m.cheats != nil {
+		m.cheats.Apply(m.v)
+	}
+	if err := cpu.RunFrame(m.v); err != nil {
+		return err
+	}
+	m.v.Audio.Generate(m.samples)
+	return nil
+}
+
+// Cycles returns the number of CPU cycles elapsed since the last reset.
+func (m *Machine) Cycles() uint64 {
+	return m.v.Cycles
+}
+
+// Framebuffer renders the screen. The image is reused by later calls.
+func (m *Machine) Framebuffer() (*image.RGBA, error) {
+	if err := m.renderer.Render(m.image, m.v.Graphics); err != nil {
+		return nil, err
+	}
+	return m.image, nil
+}
+
+// AudioSamples returns the sound of the last frame: 16-bit mono samples, at
+// SampleRate samples per second. The slice is reused by later frames.
+func (m *Machine) AudioSamples() []int16 {
+	return m.samples
+}
+
+// State returns the machine's internal state, for tools that need more than
+// Machine exposes (debuggers, recorders...). It is replaced on LoadState.
+func (m *Machine) State() *vm.State {
+	return m.v
+}
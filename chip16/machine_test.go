@@ -0,0 +1,233 @@
+package chip16
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cheat"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// testROM plays a tone, then counts frames in R1 and reads the first
+// controller into R0 on each frame, on a red background.
+var testROM = []byte{
+	0x0A, 0x00, 0xE8, 0x03, // 0x00: SND1 1000
+	0x22, 0x00, 0xF0, 0xFF, // 0x04: LDM R0, 0xFFF0
+	0x40, 0x01, 0x01, 0x00, // 0x08: ADDI R1, 1
+	0x03, 0x00, 0x03, 0x00, // 0x0C: BGC 3
+	0x02, 0x00, 0x00, 0x00, // 0x10: VBLNK
+	0x10, 0x00, 0x04, 0x00, // 0x14: JMP 0x0004
+}
+
+func newTestMachine(t *testing.T, opts ...Option) *Machine {
+	m, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadROM(bytes.NewReader(testROM)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := New(WithScale(0))
+	a.Error(err, "invalid scale")
+	_, err = New(WithScale(3), WithFilter(graphics.Scale2x))
+	a.Error(err, "invalid scale for Scale2x")
+
+	m, err := New(WithScale(2), WithStrictCalls())
+	if a.NoError(err) {
+		img, err := m.Framebuffer()
+		if a.NoError(err) {
+			a.Equal(image.Rect(0, 0, 640, 480), img.Bounds())
+		}
+		a.True(m.State().StrictCalls)
+		a.Nil(m.ROM())
+	}
+
+	a.Error(m.LoadROM(bytes.NewReader([]byte("CH16"))), "invalid ROM")
+}
+
+func TestLoadFile(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := ioutil.TempFile("", "chip16-*.c16")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(testROM)
+	a.NoError(f.Close())
+	if !a.NoError(err) {
+		return
+	}
+
+	m, err := LoadFile(f.Name(), WithStrictCalls())
+	if a.NoError(err) {
+		a.Equal(testROM, m.ROM().Data)
+		a.True(m.State().StrictCalls)
+	}
+
+	_, err = LoadFile(f.Name(), WithScale(0))
+	a.Error(err, "invalid option")
+	_, err = LoadFile(f.Name() + ".missing")
+	a.Error(err)
+}
+
+func TestRunFrame(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+
+	if !a.NoError(m.RunFrame()) {
+		return
+	}
+	a.Equal(testROM, m.ROM().Data)
+	a.Equal(int16(1), m.State().Regs[1])
+	a.Len(m.AudioSamples(), SampleRate/FrameRate)
+	a.NotEqual(make([]int16, len(m.AudioSamples())), m.AudioSamples(), "should play a tone")
+
+	img, err := m.Framebuffer()
+	if a.NoError(err) {
+		a.Equal(color.RGBA{0xBF, 0x39, 0x32, 0xFF}, img.At(0, 0))
+	}
+
+	a.Equal(uint64(cpu.CyclesPerFrame), m.Cycles())
+
+	m.SetInput(0, ButtonA|ButtonLeft)
+	m.SetInput(1, ButtonStart)
+	if a.NoError(m.RunFrame()) {
+		a.Equal(int16(ButtonA|ButtonLeft), m.State().Regs[0])
+		a.Equal(uint16(ButtonStart), m.State().Controller(1))
+		a.Equal(int16(2), m.State().Regs[1])
+	}
+	a.Panics(func() { m.SetInput(2, 0) })
+
+}
+
+func TestWithHook(t *testing.T) {
+	a := assert.New(t)
+	var n uint64
+	m := newTestMachine(t, WithHook(func(v *vm.State, e vm.Executed) { n += e.Cycles }))
+
+	if a.NoError(m.RunFrame()) {
+		a.Equal(uint64(5), n, "should hook every instruction up to VBLNK")
+	}
+	if a.NoError(m.Clone().RunFrame()) {
+		a.Equal(uint64(5), n, "clones shouldn't inherit the hook")
+	}
+}
+
+func TestReset(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+	v := m.State()
+
+	a.NoError(m.RunFrame())
+	v.RAM.Set(0x1000, 0x42)
+	v.Graphics.Palette[3].R = 0
+	m.Reset()
+	a.True(v == m.State(), "the state should be reset in place")
+	a.Equal(vm.Pointer(0), v.PC)
+	a.Equal(int16(0), v.Regs[1])
+	a.Equal(byte(0), v.RAM.At(0x1000))
+	a.Equal(testROM, v.RAM.View(0, len(testROM)), "the ROM should be reloaded")
+	a.Equal(graphics.DefaultPalette(), v.Graphics.Palette)
+	a.False(v.Audio.Playing())
+	a.Equal(make([]int16, len(m.AudioSamples())), m.AudioSamples())
+	if a.NoError(m.RunFrame()) {
+		a.Equal(int16(1), v.Regs[1], "the ROM should start over")
+	}
+
+	v.RAM.Set(0x1000, 0x42)
+	v.RAM.Set(0x08, 0xFF) // Self-modifying code is kept too
+	m.SoftReset()
+	a.Equal(vm.Pointer(0), v.PC)
+	a.Equal(int16(0), v.Regs[1])
+	a.Equal(byte(0x42), v.RAM.At(0x1000))
+	a.Equal(byte(0xFF), v.RAM.At(0x08))
+	a.False(v.Audio.Playing())
+}
+
+func TestSaveState(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+
+	for i := 0; i < 5; i++ {
+		a.NoError(m.RunFrame())
+	}
+	m.SetInput(0, ButtonB)
+	var state bytes.Buffer
+	if !a.NoError(m.SaveState(&state)) {
+		return
+	}
+	saved := state.Bytes()
+
+	run := func() ([]int16, [16]int16) {
+		var sound []int16
+		for i := 0; i < 5; i++ {
+			a.NoError(m.RunFrame())
+			sound = append(sound, m.AudioSamples()...)
+		}
+		return sound, m.State().Regs
+	}
+	sound, regs := run()
+	a.Equal(int16(10), regs[1])
+	cycles := m.Cycles()
+	a.Equal(int16(ButtonB), regs[0])
+
+	m.SetInput(0, 0)
+	if a.NoError(m.LoadState(bytes.NewReader(saved))) {
+		a.Equal(int16(5), m.State().Regs[1])
+		restoredSound, restoredRegs := run()
+		a.Equal(regs, restoredRegs, "input should be restored")
+		a.Equal(cycles, m.Cycles())
+		a.Equal(sound, restoredSound)
+	}
+
+	// Invalid states
+	before := m.State()
+	a.Error(m.LoadState(bytes.NewReader(saved[:100])), "truncated")
+	a.Error(m.LoadState(bytes.NewReader([]byte("C16S\x02"))), "unknown version")
+	a.Error(m.LoadState(bytes.NewReader([]byte("CH16\x01"))), "bad magic")
+	a.True(before == m.State(), "machine shouldn't change on errors")
+
+	other, _ := New()
+	a.Error(other.LoadState(bytes.NewReader(saved)), "other ROM")
+}
+
+func TestCheats(t *testing.T) {
+	a := assert.New(t)
+	m := newTestMachine(t)
+	l, err := cheat.Read(strings.NewReader(
+		"u16 FFF0 0x80 if u16 FFF0 == 0x40 ; A is B\n",
+	))
+	if !a.NoError(err) {
+		return
+	}
+	m.SetCheats(l)
+	a.Equal(l, m.Cheats())
+
+	// Cheats are applied after the input is set
+	m.SetInput(0, ButtonA)
+	a.NoError(m.RunFrame())
+	a.Equal(int16(ButtonB), m.State().Regs[0])
+	m.SetInput(0, ButtonLeft)
+	a.NoError(m.RunFrame())
+	a.Equal(int16(ButtonLeft), m.State().Regs[0])
+
+	m.SetCheats(nil)
+	m.SetInput(0, ButtonA)
+	a.NoError(m.RunFrame())
+	a.Equal(int16(ButtonA), m.State().Regs[0])
+}
@@ -0,0 +1,347 @@
+// Package memview implements a hex viewer and editor of a chip16's memory,
+// for debugger frontends.
+//
+// A View shows 16 bytes per row, coloured by region (code, data, stack, IO),
+// and decodes the word at its cursor. It is meant to be rendered on every
+// frame while the machine runs: bytes that changed since the last render are
+// highlighted.
+package memview
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/analysis"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/rom"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// BytesPerRow is the number of bytes shown on each row
+const BytesPerRow = 16
+
+// Region is a kind of memory area.
+type Region int
+
+const (
+	// RAM is memory that belongs to no other region.
+	RAM Region = iota
+
+	// Code is the part of the ROM reached as instructions.
+	Code
+
+	// Data is the rest of the ROM.
+	Data
+
+	// Stack is the used part of the stack, from vm.StackStart to SP.
+	Stack
+
+	// IO is the IO registers, from vm.IOStart.
+	IO
+)
+
+func (r Region) String() string {
+	switch r {
+	case RAM:
+		return "ram"
+	case Code:
+		return "code"
+	case Data:
+		return "data"
+	case Stack:
+		return "stack"
+	case IO:
+		return "io"
+	}
+	return fmt.Sprintf("Region(%d)", int(r))
+}
+
+// colors are the SGR parameters of each region
+var colors = map[Region]string{
+	RAM:   "",
+	Code:  "36",
+	Data:  "33",
+	Stack: "35",
+	IO:    "31",
+}
+
+// View is a window over the memory of a VM.
+type View struct {
+	// State is the viewed VM.
+	State *vm.State
+
+	// Program tells code from data in the ROM. If nil, the whole ROM is
+	// data.
+	Program *analysis.Program
+
+	// ROMSize is the size of the ROM image loaded at vm.RAMStart.
+	ROMSize int
+
+	// Symbols, if not nil, names the targets of decoded pointers.
+	Symbols *symbols.Table
+
+	// Addr is the address of the first row. It is kept a multiple of
+	// BytesPerRow, and the cursor visible.
+	Addr vm.Pointer
+
+	// Rows is the number of rows shown.
+	Rows int
+
+	// Cursor is the address of the selected byte.
+	Cursor vm.Pointer
+
+	low  bool   // whether the next typed digit is the cursor's low nibble
+	ram  []byte // memory being rendered
+	prev []byte // memory at the last render
+	buf  bytes.Buffer
+}
+
+// New creates a view of v, where r (if not nil) is the loaded ROM. The ROM is
+// analyzed to tell code from data.
+func New(v *vm.State, r *rom.ROM, rows int) *View {
+	w := &View{State: v, Rows: rows}
+	if r != nil {
+		w.Program = analysis.Analyze(r.Data, r.Start)
+		w.ROMSize = len(r.Data)
+	}
+	return w
+}
+
+// RegionAt returns the region addr belongs to.
+func (w *View) RegionAt(addr vm.Pointer) Region {
+	switch {
+	case addr >= vm.IOStart:
+		return IO
+	case addr >= vm.StackStart:
+		if addr < w.State.SP {
+			return Stack
+		}
+	case int(addr) < vm.RAMStart+w.ROMSize:
+		if w.Program != nil && w.Program.IsCode(addr) {
+			return Code
+		}
+		return Data
+	}
+	return RAM
+}
+
+// Word is the decoding of the 16-bit word at an address.
+type Word struct {
+	Addr    vm.Pointer
+	Int16   int16
+	Pointer vm.Pointer
+
+	// Target is the region Pointer points to.
+	Target Region
+
+	// Label is the symbolized Pointer, if the view has symbols.
+	Label string
+}
+
+// WordAt decodes the word at addr. It fails on the last byte of memory.
+func (w *View) WordAt(addr vm.Pointer) (Word, error) {
+	x, err := w.State.Int16At(addr)
+	if err != nil {
+		return Word{}, err
+	}
+	p, err := w.State.PointerAt(addr)
+	if err != nil {
+		return Word{}, err
+	}
+	word := Word{Addr: addr, Int16: x, Pointer: p, Target: w.RegionAt(p)}
+	if w.Symbols != nil {
+		word.Label = w.Symbols.Symbolize(p)
+	}
+	return word, nil
+}
+
+// Poke writes data at addr.
+func (w *View) Poke(addr vm.Pointer, data []byte) error {
+	if int(addr)+len(data) > vm.MemSize {
+		return fmt.Errorf("write out of bounds")
+	}
+	w.State.RAM.Write(addr, data)
+	return nil
+}
+
+// Type writes a hexadecimal digit at the cursor, high nibble first, and
+// moves the cursor to the next byte after the low nibble. It returns false
+// if r isn't an hexadecimal digit.
+func (w *View) Type(r rune) bool {
+	d, err := strconv.ParseUint(string(r), 16, 4)
+	if err != nil {
+		return false
+	}
+	ram := &w.State.RAM
+	if w.low {
+		ram.Set(w.Cursor, ram.At(w.Cursor)&0xF0|byte(d))
+		w.Move(1)
+	} else {
+		ram.Set(w.Cursor, ram.At(w.Cursor)&0x0F|byte(d)<<4)
+		w.low = true
+	}
+	return true
+}
+
+// Move moves the cursor by delta bytes, wrapping around memory, and scrolls
+// to keep it visible.
+func (w *View) Move(delta int) {
+	w.Goto(vm.Pointer(int(w.Cursor) + delta))
+}
+
+// Goto moves the cursor to addr, and scrolls to keep it visible.
+func (w *View) Goto(addr vm.Pointer) {
+	w.Cursor = addr
+	w.low = false
+
+	rows := w.Rows
+	if rows < 1 {
+		rows = 1
+	}
+	row := addr / BytesPerRow * BytesPerRow
+	if row < w.Addr {
+		w.Addr = row
+	} else if last := int(w.Addr) + (rows-1)*BytesPerRow; int(row) > last {
+		w.Addr = row - vm.Pointer((rows-1)*BytesPerRow)
+	}
+}
+
+// Find returns the address of the first occurrence of pattern after from,
+// wrapping around memory.
+func (w *View) Find(pattern []byte, from vm.Pointer) (vm.Pointer, bool) {
+	ram := w.State.RAM.Bytes()
+	if len(pattern) == 0 || len(pattern) > len(ram) {
+		return 0, false
+	}
+	start := int(from) + 1
+	if i := bytes.Index(ram[start:], pattern); i >= 0 {
+		return vm.Pointer(start + i), true
+	}
+	end := start + len(pattern) - 1
+	if end > len(ram) {
+		end = len(ram)
+	}
+	if i := bytes.Index(ram[:end], pattern); i >= 0 {
+		return vm.Pointer(i), true
+	}
+	return 0, false
+}
+
+// FindNext moves the cursor to the next occurrence of pattern, and tells
+// whether there was one.
+func (w *View) FindNext(pattern []byte) bool {
+	addr, ok := w.Find(pattern, w.Cursor)
+	if ok {
+		w.Goto(addr)
+	}
+	return ok
+}
+
+// ParsePattern parses a search pattern: hexadecimal bytes, optionally
+// separated by spaces (e.g. "DE AD BE EF"), or a double-quoted string.
+func ParsePattern(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return []byte(s[1 : len(s)-1]), nil
+	}
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("bad pattern %q", s)
+	}
+	return b, nil
+}
+
+// Render writes the view to an ANSI terminal, from the top-left corner:
+// Rows rows of memory, then a line decoding the word at the cursor.
+func (w *View) Render(out io.Writer) error {
+	if w.ram == nil {
+		w.ram = w.State.RAM.Bytes()
+		w.prev = w.State.RAM.Bytes()
+	} else {
+		w.State.RAM.Read(0, w.ram)
+	}
+
+	w.buf.Reset()
+	w.buf.WriteString("\x1b[H")
+	for row := 0; row < w.Rows; row++ {
+		addr := int(w.Addr) + row*BytesPerRow
+		if addr >= vm.MemSize {
+			w.buf.WriteString("\x1b[K\r\n")
+			continue
+		}
+		w.writeRow(vm.Pointer(addr))
+	}
+	w.writeStatus()
+	copy(w.prev, w.ram)
+
+	_, err := out.Write(w.buf.Bytes())
+	return err
+}
+
+// writeRow writes the row at addr to the buffer
+func (w *View) writeRow(addr vm.Pointer) {
+	ram := w.ram
+	fmt.Fprintf(&w.buf, "%04X ", uint16(addr))
+	for i := 0; i < BytesPerRow; i++ {
+		a := addr + vm.Pointer(i)
+		w.buf.WriteByte(' ')
+		styled := w.setStyle(a)
+		fmt.Fprintf(&w.buf, "%02X", ram[a])
+		if styled {
+			w.buf.WriteString("\x1b[0m")
+		}
+	}
+	w.buf.WriteString("  ")
+	for i := 0; i < BytesPerRow; i++ {
+		a := addr + vm.Pointer(i)
+		c := ram[a]
+		if c < 0x20 || c > 0x7E {
+			c = '.'
+		}
+		styled := w.setStyle(a)
+		w.buf.WriteByte(c)
+		if styled {
+			w.buf.WriteString("\x1b[0m")
+		}
+	}
+	w.buf.WriteString("\x1b[K\r\n")
+}
+
+// setStyle writes the SGR sequence of the byte at addr: its region's color,
+// bold if it changed since the last render, and reversed under the cursor.
+// It tells whether there was any.
+func (w *View) setStyle(addr vm.Pointer) bool {
+	params := []string{}
+	if c := colors[w.RegionAt(addr)]; c != "" {
+		params = append(params, c)
+	}
+	if w.ram[addr] != w.prev[addr] {
+		params = append(params, "1")
+	}
+	if addr == w.Cursor {
+		params = append(params, "7")
+	}
+	if len(params) == 0 {
+		return false
+	}
+	w.buf.WriteString("\x1b[" + strings.Join(params, ";") + "m")
+	return true
+}
+
+// writeStatus writes the decoding of the cursor to the buffer
+func (w *View) writeStatus() {
+	c := w.Cursor
+	fmt.Fprintf(&w.buf, "%04X %-5s u8 %-3d", uint16(c), w.RegionAt(c), w.ram[c])
+	if word, err := w.WordAt(c); err == nil {
+		fmt.Fprintf(&w.buf, "  i16 %-6d  ptr %04X (%s", word.Int16, uint16(word.Pointer), word.Target)
+		if word.Label != "" {
+			fmt.Fprintf(&w.buf, " %s", word.Label)
+		}
+		w.buf.WriteString(")")
+	}
+	fmt.Fprintf(&w.buf, "  SP %04X\x1b[K", uint16(w.State.SP))
+}
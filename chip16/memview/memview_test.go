@@ -0,0 +1,157 @@
+package memview
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/rom"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestView views a VM running a ROM made of a JMP to itself, followed by
+// two bytes of data
+func newTestView(rows int) *View {
+	r := &rom.ROM{Data: []byte{0x10, 0x00, 0x00, 0x00, 0xAA, 0xBB}}
+	v := vm.NewState()
+	r.Load(v)
+	return New(v, r, rows)
+}
+
+func TestRegionAt(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(4)
+	w.State.SP = vm.StackStart + 2
+
+	for addr, exp := range map[vm.Pointer]Region{
+		0x0000:            Code,
+		0x0003:            Code,
+		0x0004:            Data,
+		0x0005:            Data,
+		0x0006:            RAM,
+		vm.StackStart:     Stack,
+		vm.StackStart + 1: Stack,
+		vm.StackStart + 2: RAM,
+		vm.IOStart:        IO,
+		0xFFFF:            IO,
+	} {
+		a.Equal(exp, w.RegionAt(addr), "%#04x", addr)
+	}
+
+	w.Program = nil
+	a.Equal(Data, w.RegionAt(0))
+}
+
+func TestWordAt(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(4)
+	w.State.PutInt16At(-2, 0x100)
+	w.Symbols = symbols.New()
+	w.Symbols.AddLabel("io", vm.IOStart)
+
+	word, err := w.WordAt(0x100)
+	if a.NoError(err) {
+		a.Equal(Word{Addr: 0x100, Int16: -2, Pointer: 0xFFFE, Target: IO, Label: "io+0xE"}, word)
+	}
+	_, err = w.WordAt(0xFFFF)
+	a.Error(err)
+}
+
+func TestEdit(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(4)
+	c := w.State.Clone()
+
+	w.Goto(0x100)
+	for _, r := range "12ab" {
+		a.True(w.Type(r))
+	}
+	a.False(w.Type('g'))
+	w.Type('F')
+	a.Equal([]byte{0x12, 0xAB, 0xF0}, w.State.RAM.View(0x100, 3))
+	a.Equal(vm.Pointer(0x102), w.Cursor)
+
+	// Moving resets the nibble
+	w.Move(-1)
+	w.Type('3')
+	a.Equal(byte(0x3B), w.State.RAM.At(0x101))
+
+	a.NoError(w.Poke(0xFFFE, []byte{1, 2}))
+	a.Error(w.Poke(0xFFFF, []byte{1, 2}))
+	a.Equal(make([]byte, 3), c.RAM.View(0x100, 3), "edits should go through copy-on-write")
+}
+
+func TestScroll(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(4)
+
+	w.Goto(0x40)
+	a.Equal(vm.Pointer(0x10), w.Addr, "the cursor should be on the last row")
+	w.Move(-0x20)
+	a.Equal(vm.Pointer(0x10), w.Addr, "visible rows shouldn't scroll")
+	w.Move(-0x20)
+	a.Equal(vm.Pointer(0x00), w.Addr)
+	w.Move(-1)
+	a.Equal(vm.Pointer(0xFFFF), w.Cursor, "moves should wrap around")
+	a.Equal(vm.Pointer(0xFFC0), w.Addr)
+}
+
+func TestFind(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(4)
+	w.Poke(0x2000, []byte("HELLO"))
+	w.Poke(0xFFFE, []byte{0xAA, 0xBB})
+
+	p, err := ParsePattern(`"HELLO"`)
+	if a.NoError(err) && a.True(w.FindNext(p)) {
+		a.Equal(vm.Pointer(0x2000), w.Cursor)
+		a.Equal(vm.Pointer(0x2000-3*BytesPerRow), w.Addr)
+	}
+
+	p, err = ParsePattern("aa BB")
+	if a.NoError(err) {
+		a.Equal([]byte{0xAA, 0xBB}, p)
+		a.True(w.FindNext(p))
+		a.Equal(vm.Pointer(0xFFFE), w.Cursor)
+		a.True(w.FindNext(p), "searches should wrap around")
+		a.Equal(vm.Pointer(0x0004), w.Cursor)
+		a.True(w.FindNext(p))
+		a.Equal(vm.Pointer(0xFFFE), w.Cursor)
+	}
+
+	_, ok := w.Find([]byte{0xCC}, 0)
+	a.False(ok)
+	for _, s := range []string{"", "A", "GG", `"`} {
+		_, err := ParsePattern(s)
+		a.Error(err, s)
+	}
+}
+
+func TestRender(t *testing.T) {
+	a := assert.New(t)
+	w := newTestView(2)
+
+	var b bytes.Buffer
+	if !a.NoError(w.Render(&b)) {
+		return
+	}
+	lines := strings.Split(b.String(), "\r\n")
+	if a.Len(lines, 3) {
+		a.True(strings.HasPrefix(lines[0], "\x1b[H0000  \x1b[36;7m10\x1b[0m \x1b[36m00"), lines[0])
+		a.Contains(lines[0], "\x1b[33mAA\x1b[0m \x1b[33mBB\x1b[0m 00 ")
+		a.True(strings.HasPrefix(lines[1], "0010  00"))
+		a.True(strings.HasPrefix(lines[2], "0000 code  u8 16 "), lines[2])
+		a.Contains(lines[2], "ptr 0010 (ram)")
+	}
+
+	// Changes are highlighted until the next render
+	w.Poke(0x11, []byte{0x42})
+	b.Reset()
+	w.Render(&b)
+	a.Contains(b.String(), "\x1b[1m42\x1b[0m")
+	b.Reset()
+	w.Render(&b)
+	a.NotContains(b.String(), "\x1b[1m")
+}
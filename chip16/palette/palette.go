@@ -0,0 +1,329 @@
+package palette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+)
+
+// Size is the number of colors of a chip16 palette
+const Size = 16
+
+// Format is a palette file format.
+type Format int
+
+const (
+	// Chip16 is the in-memory layout loaded by the PAL instructions: 16
+	// contiguous 24-bit BGR vectors.
+	Chip16 Format = iota
+
+	// GPL is the GIMP palette format (.gpl).
+	GPL
+
+	// JASC is the Paint Shop Pro palette format (.pal).
+	JASC
+
+	// ACT is the Adobe Color Table format (.act).
+	ACT
+
+	// Hex is a list of RRGGBB hexadecimal colors, one per line (.hex),
+	// optionally prefixed with '#'. Lines starting with ';' are comments.
+	Hex
+)
+
+var formatNames = []string{"chip16", "gpl", "jasc", "act", "hex"}
+
+func (f Format) String() string {
+	if f >= 0 && int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format with the given name (see Format.String).
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if strings.EqualFold(name, n) {
+			return Format(f), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown palette format %q", name)
+}
+
+// FormatOf guesses the format of a palette file from its extension.
+// Files with a .bin extension are expected to use the chip16 layout.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bin":
+		return Chip16, nil
+	case ".gpl":
+		return GPL, nil
+	case ".pal":
+		return JASC, nil
+	case ".act":
+		return ACT, nil
+	case ".hex":
+		return Hex, nil
+	}
+	return 0, fmt.Errorf("%s: unknown palette extension", path)
+}
+
+// Read reads a palette in the given format.
+func Read(r io.Reader, f Format) ([]color.RGBA, error) {
+	switch f {
+	case Chip16:
+		return readChip16(r)
+	case GPL:
+		return readGPL(r)
+	case JASC:
+		return readJASC(r)
+	case ACT:
+		return readACT(r)
+	case Hex:
+		return readHex(r)
+	}
+	return nil, fmt.Errorf("unknown palette format %s", f)
+}
+
+// Write writes a palette in the given format. Alpha is ignored.
+//
+// The chip16 layout can't hold more than 16 colors, and is padded with black
+// if the palette has less.
+func Write(w io.Writer, p []color.RGBA, f Format) error {
+	switch f {
+	case Chip16:
+		b, err := Encode(p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case GPL:
+		return writeGPL(w, p)
+	case JASC:
+		return writeJASC(w, p)
+	case ACT:
+		return writeACT(w, p)
+	case Hex:
+		return writeHex(w, p)
+	}
+	return fmt.Errorf("unknown palette format %s", f)
+}
+
+// Encode converts a palette to the chip16 in-memory layout (see
+// graphics.State.LoadPalette). Missing colors are black.
+func Encode(p []color.RGBA) ([]byte, error) {
+	if len(p) > Size {
+		return nil, fmt.Errorf("too many colors: %d > %d", len(p), Size)
+	}
+	b := make([]byte, graphics.PaletteSize)
+	for i, c := range p {
+		b[3*i], b[3*i+1], b[3*i+2] = c.B, c.G, c.R
+	}
+	return b, nil
+}
+
+// Decode converts chip16 palette data to a palette.
+func Decode(b []byte) ([]color.RGBA, error) {
+	if len(b) < graphics.PaletteSize {
+		return nil, fmt.Errorf("palette too short: %d bytes", len(b))
+	}
+	p := make([]color.RGBA, Size)
+	for i := range p {
+		p[i] = color.RGBA{b[3*i+2], b[3*i+1], b[3*i], 0xFF}
+	}
+	return p, nil
+}
+
+func readChip16(r io.Reader) ([]color.RGBA, error) {
+	b := make([]byte, graphics.PaletteSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("reading palette: %s", err)
+	}
+	return Decode(b)
+}
+
+// lines calls parse with each line of r that is neither blank nor a comment
+// (starting with the comment prefix, if any), stopping at the first error.
+func lines(r io.Reader, comment string, parse func(n int, text string) error) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || comment != "" && strings.HasPrefix(text, comment) {
+			continue
+		}
+		if err := parse(n, text); err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	return s.Err()
+}
+
+// parseRGB parses a color made of three decimal components, ignoring any
+// field after them.
+func parseRGB(fields []string) (color.RGBA, error) {
+	if len(fields) < 3 {
+		return color.RGBA{}, fmt.Errorf("expected 3 color components, got %d", len(fields))
+	}
+	var rgb [3]uint8
+	for i := range rgb {
+		v, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("bad color component %q", fields[i])
+		}
+		rgb[i] = uint8(v)
+	}
+	return color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF}, nil
+}
+
+func readGPL(r io.Reader) ([]color.RGBA, error) {
+	var p []color.RGBA
+	err := lines(r, "#", func(n int, text string) error {
+		switch {
+		case n == 1:
+			if text != "GIMP Palette" {
+				return fmt.Errorf("not a GIMP palette")
+			}
+		case strings.HasPrefix(text, "Name:"), strings.HasPrefix(text, "Columns:"):
+		default:
+			c, err := parseRGB(strings.Fields(text))
+			if err != nil {
+				return err
+			}
+			p = append(p, c)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func writeGPL(w io.Writer, p []color.RGBA) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: chip16\nColumns: %d\n#\n", Size)
+	for i, c := range p {
+		fmt.Fprintf(bw, "%3d %3d %3d\tIndex %d\n", c.R, c.G, c.B, i)
+	}
+	return bw.Flush()
+}
+
+func readJASC(r io.Reader) ([]color.RGBA, error) {
+	var p []color.RGBA
+	count := -1
+	err := lines(r, "", func(n int, text string) error {
+		switch n {
+		case 1:
+			if text != "JASC-PAL" {
+				return fmt.Errorf("not a JASC palette")
+			}
+		case 2:
+			if text != "0100" {
+				return fmt.Errorf("unsupported version %q", text)
+			}
+		case 3:
+			var err error
+			if count, err = strconv.Atoi(text); err != nil || count < 0 {
+				return fmt.Errorf("bad color count %q", text)
+			}
+		default:
+			c, err := parseRGB(strings.Fields(text))
+			if err != nil {
+				return err
+			}
+			p = append(p, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count != len(p) {
+		return nil, fmt.Errorf("expected %d colors, got %d", count, len(p))
+	}
+	return p, nil
+}
+
+func writeJASC(w io.Writer, p []color.RGBA) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "JASC-PAL\r\n0100\r\n%d\r\n", len(p))
+	for _, c := range p {
+		fmt.Fprintf(bw, "%d %d %d\r\n", c.R, c.G, c.B)
+	}
+	return bw.Flush()
+}
+
+// Adobe Color Tables hold 256 RGB colors, optionally followed by the number
+// of colors in use and the index of the transparent one (big-endian uint16s).
+const (
+	actColors = 256
+	actSize   = 3 * actColors
+)
+
+func readACT(r io.Reader) ([]color.RGBA, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	count := actColors
+	switch len(b) {
+	case actSize:
+	case actSize + 4:
+		count = int(binary.BigEndian.Uint16(b[actSize:]))
+		if count > actColors {
+			return nil, fmt.Errorf("bad color count %d", count)
+		}
+	default:
+		return nil, fmt.Errorf("bad color table size: %d bytes", len(b))
+	}
+
+	p := make([]color.RGBA, count)
+	for i := range p {
+		p[i] = color.RGBA{b[3*i], b[3*i+1], b[3*i+2], 0xFF}
+	}
+	return p, nil
+}
+
+func writeACT(w io.Writer, p []color.RGBA) error {
+	if len(p) > actColors {
+		return fmt.Errorf("too many colors: %d > %d", len(p), actColors)
+	}
+	b := make([]byte, actSize+4)
+	for i, c := range p {
+		b[3*i], b[3*i+1], b[3*i+2] = c.R, c.G, c.B
+	}
+	binary.BigEndian.PutUint16(b[actSize:], uint16(len(p)))
+	binary.BigEndian.PutUint16(b[actSize+2:], 0xFFFF) // no transparent color
+	_, err := w.Write(b)
+	return err
+}
+
+func readHex(r io.Reader) ([]color.RGBA, error) {
+	var p []color.RGBA
+	err := lines(r, ";", func(_ int, text string) error {
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "#"), "0x")
+		v, err := strconv.ParseUint(text, 16, 32)
+		if err != nil || len(text) != 6 {
+			return fmt.Errorf("bad color %q", text)
+		}
+		p = append(p, color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF})
+		return nil
+	})
+	return p, err
+}
+
+func writeHex(w io.Writer, p []color.RGBA) error {
+	var b bytes.Buffer
+	for _, c := range p {
+		fmt.Fprintf(&b, "%02x%02x%02x\n", c.R, c.G, c.B)
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
@@ -0,0 +1,118 @@
+package palette
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/stretchr/testify/assert"
+)
+
+// opaque returns the default palette, with all colors opaque
+func opaque() []color.RGBA {
+	p := graphics.DefaultPalette()
+	for i := range p {
+		p[i].A = 0xFF
+	}
+	return p
+}
+
+func TestRoundTrip(t *testing.T) {
+	a := assert.New(t)
+
+	for _, f := range []Format{Chip16, GPL, JASC, ACT, Hex} {
+		var b bytes.Buffer
+		if !a.NoError(Write(&b, graphics.DefaultPalette(), f), f.String()) {
+			continue
+		}
+		p, err := Read(&b, f)
+		if a.NoError(err, f.String()) {
+			a.Equal(opaque(), p, f.String())
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	a := assert.New(t)
+
+	b, err := Encode([]color.RGBA{{0x11, 0x22, 0x33, 0xFF}})
+	if a.NoError(err) {
+		a.Len(b, graphics.PaletteSize)
+		a.Equal([]byte{0x33, 0x22, 0x11, 0x00}, b[:4])
+
+		s := graphics.NewState()
+		a.NoError(s.LoadPalette(b))
+		a.Equal(color.RGBA{0x11, 0x22, 0x33, 0x00}, s.Palette[0])
+	}
+
+	_, err = Encode(make([]color.RGBA, 17))
+	a.Error(err)
+
+	_, err = Decode(make([]byte, graphics.PaletteSize-1))
+	a.Error(err)
+}
+
+func TestRead(t *testing.T) {
+	a := assert.New(t)
+	exp := []color.RGBA{{0xFF, 0x00, 0x00, 0xFF}, {0x00, 0x80, 0x0A, 0xFF}}
+
+	for _, test := range []struct {
+		f    Format
+		data string
+	}{
+		{GPL, "GIMP Palette\nName: test\nColumns: 4\n#\n255   0   0\tRed\n  0 128  10\tUntitled\n"},
+		{JASC, "JASC-PAL\r\n0100\r\n2\r\n255 0 0\r\n0 128 10\r\n"},
+		{Hex, "; exported\nff0000\n#00800A\n\n"},
+	} {
+		p, err := Read(strings.NewReader(test.data), test.f)
+		if a.NoError(err, test.f.String()) {
+			a.Equal(exp, p, test.f.String())
+		}
+	}
+
+	// Adobe Color Tables without a color count hold 256 colors
+	p, err := Read(bytes.NewReader(make([]byte, 768)), ACT)
+	if a.NoError(err) {
+		a.Len(p, 256)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	a := assert.New(t)
+
+	for _, test := range []struct {
+		f    Format
+		data string
+	}{
+		{Chip16, "short"},
+		{GPL, "JASC-PAL\n"},
+		{GPL, "GIMP Palette\n255 0\n"},
+		{GPL, "GIMP Palette\n256 0 0\n"},
+		{JASC, "JASC-PAL\n0200\n0\n"},
+		{JASC, "JASC-PAL\n0100\n2\n255 0 0\n"},
+		{ACT, "short"},
+		{Hex, "ff00\n"},
+		{Hex, "gg0000\n"},
+	} {
+		_, err := Read(strings.NewReader(test.data), test.f)
+		a.Errorf(err, "%s: %q should yield an error", test.f, test.data)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := FormatOf("art/Palette.GPL")
+	a.NoError(err)
+	a.Equal(GPL, f)
+	_, err = FormatOf("palette.png")
+	a.Error(err)
+
+	f, err = ParseFormat("JASC")
+	a.NoError(err)
+	a.Equal(JASC, f)
+	_, err = ParseFormat("png")
+	a.Error(err)
+}
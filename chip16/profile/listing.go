@@ -0,0 +1,64 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// WriteListing writes an annotated disassembly of the executed instructions,
+// read from mem, in address order.
+//
+// Each line holds the execution count, the elapsed cycles and their share of
+// the total, followed by the instruction. Function entries and labels are
+// shown, and gaps between executed instructions are marked with an ellipsis.
+func (p *Profiler) WriteListing(w io.Writer, mem []byte) error {
+	pcs := make([]vm.Pointer, 0, len(p.PCs))
+	for pc := range p.PCs {
+		pcs = append(pcs, pc)
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%10s %10s %6s\n", "count", "cycles", "%")
+	for i, pc := range pcs {
+		if i > 0 && pc != pcs[i-1]+4 {
+			fmt.Fprintf(bw, "%10s\n", "...")
+		}
+		if f, ok := p.Functions[pc]; ok {
+			fmt.Fprintf(
+				bw, "%s: ; %d calls, %d cycles (%d self)\n",
+				p.name(pc), f.Calls, f.Total.Cycles, f.Self.Cycles,
+			)
+		} else if p.Symbols != nil {
+			if name, ok := p.Symbols.LabelAt(pc); ok {
+				fmt.Fprintf(bw, "%s:\n", name)
+			}
+		}
+
+		c := p.PCs[pc]
+		share := 0.0
+		if p.Total.Cycles > 0 {
+			share = 100 * float64(c.Cycles) / float64(p.Total.Cycles)
+		}
+		fmt.Fprintf(bw, "%10d %10d %6.2f  %04X: ", c.Count, c.Cycles, share, uint16(pc))
+		if int(pc)+4 <= len(mem) {
+			o := vm.ReadOpcode(mem[pc:])
+			fmt.Fprintf(bw, "%08X  %s\n", uint32(o), p.disassemble(o))
+		} else {
+			fmt.Fprintln(bw, "??")
+		}
+	}
+	return bw.Flush()
+}
+
+func (p *Profiler) disassemble(o vm.Opcode) string {
+	if p.Symbols != nil {
+		return cpu.DisassembleWith(o, p.Symbols.Symbolize)
+	}
+	return cpu.Disassemble(o)
+}
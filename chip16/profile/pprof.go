@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// The pprof format is a gzipped protocol buffer (see
+// https://github.com/google/pprof/blob/master/proto/profile.proto).
+// We only need to encode a handful of messages, so we do it by hand rather
+// than pulling a protobuf library.
+
+// protobuf field numbers
+const (
+	// Profile
+	profSampleType = 1
+	profSample     = 2
+	profMapping    = 3
+	profLocation   = 4
+	profFunction   = 5
+	profStrings    = 6
+	profPeriodType = 11
+	profPeriod     = 12
+
+	// ValueType
+	vtType = 1
+	vtUnit = 2
+
+	// Sample
+	sampleLocation = 1
+	sampleValue    = 2
+
+	// Mapping
+	mapID           = 1
+	mapStart        = 2
+	mapLimit        = 3
+	mapFilename     = 5
+	mapHasFunctions = 7
+
+	// Location
+	locID      = 1
+	locMapping = 2
+	locAddress = 3
+	locLine    = 4
+
+	// Line
+	lineFunction = 1
+
+	// Function
+	funcID         = 1
+	funcName       = 2
+	funcSystemName = 3
+)
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		p.b = append(p.b, byte(x)|0x80)
+		x >>= 7
+	}
+	p.b = append(p.b, byte(x))
+}
+
+func (p *protoBuffer) key(field, wire int) {
+	p.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (p *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	p.key(field, wireVarint)
+	p.varint(x)
+}
+
+func (p *protoBuffer) bool(field int, x bool) {
+	if x {
+		p.uint64(field, 1)
+	}
+}
+
+func (p *protoBuffer) packed(field int, xs []uint64) {
+	var q protoBuffer
+	for _, x := range xs {
+		q.varint(x)
+	}
+	p.bytes(field, q.b)
+}
+
+func (p *protoBuffer) bytes(field int, b []byte) {
+	p.key(field, wireBytes)
+	p.varint(uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func (p *protoBuffer) message(field int, m *protoBuffer) {
+	p.bytes(field, m.b)
+}
+
+// stringTable interns the strings of a profile
+type stringTable struct {
+	index   map[string]uint64
+	strings []string
+}
+
+func newStringTable() *stringTable {
+	// string_table[0] must always be ""
+	return &stringTable{index: map[string]uint64{"": 0}, strings: []string{""}}
+}
+
+func (t *stringTable) id(s string) uint64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	i := uint64(len(t.strings))
+	t.index[s] = i
+	t.strings = append(t.strings, s)
+	return i
+}
+
+// WritePprof writes the profile in pprof format.
+//
+// Each sample holds the number of executed instructions and cycles for a
+// given call stack. Locations are addressed by PC, and attributed to the
+// function they were executed from.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strs := newStringTable()
+	var prof protoBuffer
+
+	valueType := func(field int, typ, unit string) {
+		var vt protoBuffer
+		vt.uint64(vtType, strs.id(typ))
+		vt.uint64(vtUnit, strs.id(unit))
+		prof.message(field, &vt)
+	}
+	valueType(profSampleType, "instructions", "count")
+	valueType(profSampleType, "cycles", "count")
+
+	var mapping protoBuffer
+	mapping.uint64(mapID, 1)
+	mapping.uint64(mapStart, vm.RAMStart)
+	mapping.uint64(mapLimit, vm.MemSize)
+	mapping.uint64(mapFilename, strs.id("chip16"))
+	mapping.bool(mapHasFunctions, true)
+	prof.message(profMapping, &mapping)
+
+	// Sort samples to get a deterministic output
+	samples := make([]*stackSample, 0, len(p.stacks))
+	for _, s := range p.stacks {
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return stackKey(samples[i].stack) < stackKey(samples[j].stack)
+	})
+
+	locIDs := make(map[location]uint64)
+	funcIDs := make(map[vm.Pointer]uint64)
+
+	function := func(entry vm.Pointer) uint64 {
+		if id, ok := funcIDs[entry]; ok {
+			return id
+		}
+		id := uint64(len(funcIDs) + 1)
+		funcIDs[entry] = id
+
+		var fn protoBuffer
+		fn.uint64(funcID, id)
+		fn.uint64(funcName, strs.id(p.name(entry)))
+		fn.uint64(funcSystemName, strs.id(p.name(entry)))
+		prof.message(profFunction, &fn)
+		return id
+	}
+
+	locate := func(l location) uint64 {
+		if id, ok := locIDs[l]; ok {
+			return id
+		}
+		id := uint64(len(locIDs) + 1)
+		locIDs[l] = id
+
+		var line protoBuffer
+		line.uint64(lineFunction, function(l.entry))
+
+		var loc protoBuffer
+		loc.uint64(locID, id)
+		loc.uint64(locMapping, 1)
+		loc.uint64(locAddress, uint64(l.pc))
+		loc.message(locLine, &line)
+		prof.message(profLocation, &loc)
+		return id
+	}
+
+	for _, s := range samples {
+		ids := make([]uint64, len(s.stack))
+		for i, l := range s.stack {
+			ids[i] = locate(l)
+		}
+
+		var sample protoBuffer
+		sample.packed(sampleLocation, ids)
+		sample.packed(sampleValue, []uint64{s.Count, s.Cycles})
+		prof.message(profSample, &sample)
+	}
+
+	var period protoBuffer
+	period.uint64(vtType, strs.id("cycles"))
+	period.uint64(vtUnit, strs.id("count"))
+	prof.message(profPeriodType, &period)
+	prof.uint64(profPeriod, 1)
+
+	// The string table must come last, once every string is interned
+	for _, s := range strs.strings {
+		prof.bytes(profStrings, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(prof.b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
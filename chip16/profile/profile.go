@@ -0,0 +1,249 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Call-related operations
+const (
+	opCALL   = 0x14 // CALL HHLL
+	opRET    = 0x15 // RET
+	opCx     = 0x17 // Cx HHLL
+	opCALLRx = 0x18 // CALL Rx
+)
+
+// Counter holds execution statistics.
+type Counter struct {
+	// Count is the number of executed instructions.
+	Count uint64
+
+	// Cycles is the number of elapsed cycles.
+	Cycles uint64
+}
+
+func (c *Counter) add(cycles uint64) {
+	c.Count++
+	c.Cycles += cycles
+}
+
+// Function holds the statistics of a called function.
+type Function struct {
+	// Entry is the address of the function.
+	Entry vm.Pointer
+
+	// Calls is the number of times the function has been called.
+	Calls uint64
+
+	// Self counts the instructions executed by the function itself.
+	Self Counter
+
+	// Total counts the instructions executed by the function and its callees.
+	Total Counter
+}
+
+// Profiler counts the instructions and cycles spent at each address and in
+// each called function of a running ROM.
+//
+// A profiler hooks into the CPU's dispatch path: attach it to a VM with
+// Attach (or to a machine with chip16.WithHook(p.Hook)), and every
+// instruction run by cpu.Step, cpu.RunFrame or a machine gets profiled.
+type Profiler struct {
+	// PCs holds the statistics for each executed address.
+	PCs map[vm.Pointer]*Counter
+
+	// Functions holds the statistics for each called function.
+	// The function that was running when profiling started is keyed by the
+	// address of the first profiled instruction.
+	Functions map[vm.Pointer]*Function
+
+	// Total counts all the profiled instructions.
+	Total Counter
+
+	// Symbols are used to name functions and addresses in exported profiles.
+	// Functions are named after their address (sub_XXXX) if nil.
+	Symbols *symbols.Table
+
+	stacks map[string]*stackSample // by stackKey, for exports
+	root   callNode
+	frames []frame // functions being executed, outermost first
+}
+
+// frame is a function call
+type frame struct {
+	entry vm.Pointer // called function
+	site  vm.Pointer // address of the call instruction
+	fn    *Function
+	outer bool      // whether no enclosing frame calls the same function
+	node  *callNode // call path leading to this frame
+}
+
+// location is an executed address along with the function it belongs to
+type location struct {
+	pc, entry vm.Pointer
+}
+
+// callNode is a node of the call tree: a call path from the root function
+type callNode struct {
+	calls   map[location]*callNode      // callees, by call site and entry
+	samples map[vm.Pointer]*stackSample // executed addresses
+}
+
+// stackSample aggregates the instructions executed with the same call stack
+type stackSample struct {
+	stack []location // innermost first
+	Counter
+}
+
+// New creates a new Profiler.
+func New() *Profiler {
+	return &Profiler{
+		PCs:       make(map[vm.Pointer]*Counter),
+		Functions: make(map[vm.Pointer]*Function),
+		stacks:    make(map[string]*stackSample),
+	}
+}
+
+// Attach makes the profiler profile every instruction executed by v, by
+// setting its hook.
+func (p *Profiler) Attach(v *vm.State) {
+	v.Hook = p.Hook
+}
+
+// Hook profiles an executed instruction. It is meant to be used as a VM's
+// hook (see vm.State.Hook).
+func (p *Profiler) Hook(v *vm.State, e vm.Executed) {
+	p.record(e.PC, e.Cycles)
+
+	switch e.Op.Op() {
+	case opCALL, opCx, opCALLRx:
+		if v.SP == e.SP+2 {
+			p.enter(v.PC, e.PC)
+		}
+	case opRET:
+		if v.SP == e.SP-2 {
+			p.leave()
+		}
+	}
+}
+
+// Step executes and profiles the next instruction, on a VM the profiler
+// isn't attached to.
+func (p *Profiler) Step(v *vm.State) error {
+	e := vm.Executed{PC: v.PC, SP: v.SP}
+	if uint16(v.PC) <= vm.StackStart-4 {
+		e.Op = vm.ReadOpcode(v.RAM.View(v.PC, 4))
+	}
+	cycles := v.Cycles
+	if err := cpu.Step(v); err != nil {
+		return err
+	}
+	e.Cycles = v.Cycles - cycles
+	p.Hook(v, e)
+	return nil
+}
+
+// record accounts for an instruction executed at pc
+func (p *Profiler) record(pc vm.Pointer, cycles uint64) {
+	if len(p.frames) == 0 {
+		p.enter(pc, pc)
+	}
+
+	c, ok := p.PCs[pc]
+	if !ok {
+		c = new(Counter)
+		p.PCs[pc] = c
+	}
+	c.add(cycles)
+	p.Total.add(cycles)
+
+	// A recursive function only gets counted once per stack
+	top := &p.frames[len(p.frames)-1]
+	top.fn.Self.add(cycles)
+	for i := range p.frames {
+		if p.frames[i].outer {
+			p.frames[i].fn.Total.add(cycles)
+		}
+	}
+
+	s, ok := top.node.samples[pc]
+	if !ok {
+		s = &stackSample{stack: p.stack(pc)}
+		top.node.samples[pc] = s
+		p.stacks[stackKey(s.stack)] = s
+	}
+	s.add(cycles)
+}
+
+// stack returns the current call stack, innermost first, where pc is the
+// address being executed
+func (p *Profiler) stack(pc vm.Pointer) []location {
+	stack := make([]location, 0, len(p.frames))
+	for i := len(p.frames) - 1; i >= 0; i-- {
+		stack = append(stack, location{pc, p.frames[i].entry})
+		pc = p.frames[i].site
+	}
+	return stack
+}
+
+// enter pushes a call to entry, made from site
+func (p *Profiler) enter(entry, site vm.Pointer) {
+	f, ok := p.Functions[entry]
+	if !ok {
+		f = &Function{Entry: entry}
+		p.Functions[entry] = f
+	}
+	if len(p.frames) > 0 {
+		f.Calls++
+	}
+
+	parent := &p.root
+	outer := true
+	if len(p.frames) > 0 {
+		parent = p.frames[len(p.frames)-1].node
+		for _, fr := range p.frames {
+			if fr.entry == entry {
+				outer = false
+				break
+			}
+		}
+	}
+	if parent.calls == nil {
+		parent.calls = make(map[location]*callNode)
+	}
+	key := location{site, entry}
+	node, ok := parent.calls[key]
+	if !ok {
+		node = &callNode{samples: make(map[vm.Pointer]*stackSample)}
+		parent.calls[key] = node
+	}
+	p.frames = append(p.frames, frame{entry, site, f, outer, node})
+}
+
+// leave pops a function call
+func (p *Profiler) leave() {
+	// When returning from the function that was running when profiling
+	// started, we don't know the caller: keep attributing to the root.
+	if len(p.frames) > 1 {
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+}
+
+// name returns the display name of a function
+func (p *Profiler) name(entry vm.Pointer) string {
+	if p.Symbols != nil {
+		return p.Symbols.FuncName(entry)
+	}
+	return fmt.Sprintf("sub_%04X", uint16(entry))
+}
+
+func stackKey(stack []location) string {
+	b := make([]byte, 0, 4*len(stack))
+	for _, l := range stack {
+		b = append(b, byte(l.pc>>8), byte(l.pc), byte(l.entry>>8), byte(l.entry))
+	}
+	return string(b)
+}
@@ -0,0 +1,195 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestState loads the following program:
+//
+//	0x00: CALL 0x0010
+//	0x04: JMP  0x0004
+//	0x10: NOP
+//	0x14: RET
+func newTestState() *vm.State {
+	v := vm.NewState()
+	for addr, o := range map[int]vm.Opcode{
+		0x00: vm.Opcode(0x14000000).WithHHLL(0x0010),
+		0x04: vm.Opcode(0x10000000).WithHHLL(0x0004),
+		0x10: 0x00000000,
+		0x14: 0x15000000,
+	} {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(o))
+		v.RAM.Write(vm.Pointer(addr), b[:])
+	}
+	return v
+}
+
+func runTestProfile(t *testing.T) (*Profiler, *vm.State) {
+	v := newTestState()
+	p := New()
+	for i := 0; i < 5; i++ {
+		if err := p.Step(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p, v
+}
+
+func TestProfiler(t *testing.T) {
+	a := assert.New(t)
+	p, _ := runTestProfile(t)
+
+	a.Equal(Counter{5, 5}, p.Total)
+	a.Equal(Counter{2, 2}, *p.PCs[0x04])
+	a.Equal(Counter{1, 1}, *p.PCs[0x10])
+
+	if a.Len(p.Functions, 2) {
+		root := p.Functions[0x00]
+		a.Equal(uint64(0), root.Calls)
+		a.Equal(Counter{3, 3}, root.Self)
+		a.Equal(Counter{5, 5}, root.Total)
+
+		sub := p.Functions[0x10]
+		a.Equal(uint64(1), sub.Calls)
+		a.Equal(Counter{2, 2}, sub.Self)
+		a.Equal(Counter{2, 2}, sub.Total)
+	}
+
+	a.Len(p.stacks, 4)
+	a.Contains(p.stacks, stackKey([]location{{0x14, 0x10}, {0x00, 0x00}}))
+}
+
+func TestProfilerTimings(t *testing.T) {
+	a := assert.New(t)
+	v := newTestState()
+	tm := cpu.SpecTimings()
+	tm[0x00] = cpu.Fixed(10) // NOP
+	v.Timing = tm.Cycles
+
+	p := New()
+	for i := 0; i < 5; i++ {
+		a.NoError(p.Step(v))
+	}
+	a.Equal(Counter{5, 14}, p.Total)
+	a.Equal(Counter{1, 10}, *p.PCs[0x10])
+	if sub := p.Functions[0x10]; a.NotNil(sub) {
+		a.Equal(Counter{2, 11}, sub.Self)
+	}
+}
+
+func TestProfilerAttach(t *testing.T) {
+	a := assert.New(t)
+	v := newTestState()
+	p := New()
+	p.Attach(v)
+	a.NoError(cpu.RunFrame(v))
+
+	a.Equal(Counter{cpu.CyclesPerFrame, cpu.CyclesPerFrame}, p.Total)
+	if sub := p.Functions[0x10]; a.NotNil(sub) {
+		a.Equal(uint64(1), sub.Calls)
+	}
+	a.Nil(v.Clone().Hook, "clones shouldn't be profiled")
+}
+
+func TestProfilerError(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+	v.RAM.Set(0, 0xFF)
+
+	p := New()
+	a.Error(p.Step(v))
+	a.Empty(p.PCs, "failed instructions shouldn't be counted")
+}
+
+func TestWritePprof(t *testing.T) {
+	a := assert.New(t)
+	p, _ := runTestProfile(t)
+	p.Symbols = symbols.New()
+	p.Symbols.AddLabel("update", 0x10)
+
+	var buf bytes.Buffer
+	if a.NoError(p.WritePprof(&buf)) {
+		gz, err := gzip.NewReader(&buf)
+		if !a.NoError(err) {
+			return
+		}
+		raw, err := ioutil.ReadAll(gz)
+		if a.NoError(err) {
+			a.True(bytes.Contains(raw, []byte("update")))
+			a.True(bytes.Contains(raw, []byte("cycles")))
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	a := assert.New(t)
+	p, v := runTestProfile(t)
+
+	var buf bytes.Buffer
+	if a.NoError(p.WriteListing(&buf, v.RAM.Bytes())) {
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if a.Len(lines, 8) {
+			a.Contains(lines[1], "sub_0000:")
+			a.Contains(lines[2], "CALL 0x0010")
+			a.Contains(lines[3], "JMP 0x0004")
+			a.Contains(lines[3], "40.00")
+			a.Contains(lines[4], "...")
+			a.Contains(lines[5], "sub_0010: ; 1 calls")
+			a.Contains(lines[6], "NOP")
+		}
+	}
+}
+
+func TestWriteListingSymbols(t *testing.T) {
+	a := assert.New(t)
+	p, v := runTestProfile(t)
+	p.Symbols = symbols.New()
+	p.Symbols.AddLabel("main", 0x00)
+	p.Symbols.AddLabel("loop", 0x04)
+	p.Symbols.AddLabel("update", 0x10)
+
+	var buf bytes.Buffer
+	if a.NoError(p.WriteListing(&buf, v.RAM.Bytes())) {
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if a.Len(lines, 9) {
+			a.Contains(lines[1], "main:")
+			a.Contains(lines[2], "CALL update")
+			a.Contains(lines[3], "loop:")
+			a.Contains(lines[4], "JMP loop")
+			a.Contains(lines[6], "update: ; 1 calls")
+		}
+	}
+}
+
+func BenchmarkProfilerStep(b *testing.B) {
+	v := newTestState()
+	p := New()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if err := p.Step(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProfilerHook(b *testing.B) {
+	v := newTestState()
+	New().Attach(v)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if err := cpu.Step(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
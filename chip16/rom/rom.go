@@ -0,0 +1,110 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+const (
+	// HeaderSize is the size of the optional .c16 header (in bytes)
+	HeaderSize = 16
+
+	// MaxSize is the maximum size of a ROM (everything below the stack)
+	MaxSize = vm.StackStart
+)
+
+var magic = []byte("CH16")
+
+// ROM is a chip16 program image.
+type ROM struct {
+	// Version is the spec version the ROM targets (0x11 for 1.1).
+	// It is zero when the ROM had no header.
+	Version uint8
+
+	// Start is the initial value of PC.
+	Start vm.Pointer
+
+	// Data is the program image, loaded at vm.RAMStart.
+	Data []byte
+}
+
+// Parse decodes a ROM image.
+//
+// Images starting with the "CH16" magic number are expected to carry a
+// 16-byte header:
+//
+//		0x00: Magic number "CH16"
+//		0x04: Reserved
+//		0x05: Spec version (high nibble = major, low nibble = minor)
+//		0x06: ROM size (excluding header, little-endian uint32)
+//		0x0A: Start address (little-endian uint16)
+//		0x0C: CRC32 checksum of the ROM data (little-endian uint32)
+//
+// Headerless images are loaded as is and start at vm.RAMStart.
+func Parse(b []byte) (*ROM, error) {
+	if !bytes.HasPrefix(b, magic) {
+		if len(b) > MaxSize {
+			return nil, fmt.Errorf("ROM too large: %d bytes", len(b))
+		}
+		return &ROM{Start: vm.RAMStart, Data: b}, nil
+	}
+
+	if len(b) < HeaderSize {
+		return nil, fmt.Errorf("truncated header")
+	}
+	size := binary.LittleEndian.Uint32(b[0x06:])
+	data := b[HeaderSize:]
+	if uint32(len(data)) != size {
+		return nil, fmt.Errorf(
+			"ROM size mismatch: header says %d, got %d", size, len(data),
+		)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("ROM too large: %d bytes", len(data))
+	}
+	if sum := binary.LittleEndian.Uint32(b[0x0C:]); sum != crc32.ChecksumIEEE(data) {
+		return nil, fmt.Errorf("bad checksum %#08x", sum)
+	}
+
+	return &ROM{
+		Version: b[0x05],
+		Start:   vm.Pointer(binary.LittleEndian.Uint16(b[0x0A:])),
+		Data:    data,
+	}, nil
+}
+
+// Read reads and decodes a ROM image.
+func Read(r io.Reader) (*ROM, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Header encodes the ROM's .c16 header.
+func (r *ROM) Header() []byte {
+	h := make([]byte, HeaderSize)
+	copy(h, magic)
+	h[0x05] = r.Version
+	binary.LittleEndian.PutUint32(h[0x06:], uint32(len(r.Data)))
+	binary.LittleEndian.PutUint16(h[0x0A:], uint16(r.Start))
+	binary.LittleEndian.PutUint32(h[0x0C:], crc32.ChecksumIEEE(r.Data))
+	return h
+}
+
+// Load copies the ROM into the VM's memory and points PC to its start.
+func (r *ROM) Load(v *vm.State) error {
+	if len(r.Data) > MaxSize {
+		return fmt.Errorf("ROM too large: %d bytes", len(r.Data))
+	}
+	v.RAM.Write(vm.RAMStart, r.Data)
+	v.PC = r.Start
+	return nil
+}
@@ -0,0 +1,57 @@
+package rom
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeaderless(t *testing.T) {
+	a := assert.New(t)
+
+	r, err := Parse([]byte{0x00, 0x00, 0x00, 0x00})
+	if a.NoError(err) {
+		a.Equal(vm.Pointer(vm.RAMStart), r.Start)
+		a.Equal(uint8(0), r.Version)
+		a.Len(r.Data, 4)
+	}
+
+	_, err = Parse(make([]byte, MaxSize+1))
+	a.Error(err, "oversized ROM should yield an error")
+}
+
+func TestParseHeader(t *testing.T) {
+	a := assert.New(t)
+
+	src := &ROM{Version: 0x11, Start: 0x0100, Data: []byte{0x10, 0x00, 0x00, 0x01}}
+	img := append(src.Header(), src.Data...)
+
+	r, err := Read(bytes.NewReader(img))
+	if a.NoError(err) {
+		a.Equal(src, r)
+	}
+
+	bad := append([]byte{}, img...)
+	bad[len(bad)-1] ^= 0xFF
+	_, err = Parse(bad)
+	a.Error(err, "corrupted data should yield a checksum error")
+
+	_, err = Parse(img[:len(img)-1])
+	a.Error(err, "truncated data should yield a size error")
+
+	_, err = Parse(img[:8])
+	a.Error(err, "truncated header should yield an error")
+}
+
+func TestLoad(t *testing.T) {
+	a := assert.New(t)
+	v := vm.NewState()
+
+	r := &ROM{Start: 0x0004, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}}
+	if a.NoError(r.Load(v)) {
+		a.Equal(vm.Pointer(0x0004), v.PC)
+		a.Equal(r.Data, v.RAM.View(0, 4))
+	}
+}
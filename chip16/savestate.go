@@ -0,0 +1,157 @@
+package chip16
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Save states are laid out as:
+//
+//		"C16S" magic number, version byte
+//		CRC32 checksum of the ROM data (little-endian uint32, 0 if none)
+//		header (see below)
+//		RAM, foreground (one palette index per byte)
+//		sound state size (little-endian uint16), sound state
+//		call depth (little-endian uint16), calls
+//
+// All integers are little-endian.
+var stateMagic = []byte("C16S")
+
+const stateVersion = 1
+
+// stateHeader holds the fixed-size parts of a save state
+type stateHeader struct {
+	PC, SP     vm.Pointer
+	Regs       [16]int16
+	Flags      vm.CPUFlags
+	Cycles     uint64
+	WaitVBlank bool
+	Input      [2]uint16
+
+	BG, SpriteW, SpriteH uint8
+	HFlip, VFlip         bool
+	Palette              [16][3]uint8
+}
+
+func (m *Machine) romChecksum() uint32 {
+	if m.rom == nil {
+		return 0
+	}
+	return crc32.ChecksumIEEE(m.rom.Data)
+}
+
+// SaveState writes the state of the machine, to be restored by LoadState.
+//
+// The random number generator used by RND isn't part of the state: restored
+// machines may draw different numbers.
+func (m *Machine) SaveState(w io.Writer) error {
+	v, g := m.v, m.v.Graphics
+	h := stateHeader{
+		PC: v.PC, SP: v.SP, Regs: v.Regs, Flags: v.Flags, Cycles: v.Cycles,
+		WaitVBlank: v.WaitVBlank, Input: m.input,
+		BG: g.BG, SpriteW: g.SpriteW, SpriteH: g.SpriteH,
+		HFlip: g.HFlip, VFlip: g.VFlip,
+	}
+	for i, c := range g.Palette {
+		h.Palette[i] = [3]uint8{c.R, c.G, c.B}
+	}
+	sound, err := v.Audio.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	fg := make([]uint8, graphics.ScreenW*graphics.ScreenH)
+	g.ReadFG(fg)
+
+	var buf bytes.Buffer
+	buf.Write(stateMagic)
+	buf.WriteByte(stateVersion)
+	for _, data := range []interface{}{
+		m.romChecksum(), h, v.RAM.Bytes(), fg,
+		uint16(len(sound)), sound,
+		uint16(len(v.Calls)), v.Calls,
+	} {
+		// Writes to a bytes.Buffer don't fail
+		binary.Write(&buf, binary.LittleEndian, data)
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// LoadState restores a state written by SaveState, for the same ROM. The
+// machine is left untouched on errors.
+func (m *Machine) LoadState(r io.Reader) error {
+	magic := make([]byte, len(stateMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("reading save state: %s", err)
+	}
+	if !bytes.HasPrefix(magic, stateMagic) {
+		return fmt.Errorf("not a save state")
+	}
+	if magic[len(stateMagic)] != stateVersion {
+		return fmt.Errorf("unsupported save state version %d", magic[len(stateMagic)])
+	}
+
+	var (
+		sum   uint32
+		h     stateHeader
+		v     = vm.NewState()
+		ram   = make([]byte, vm.MemSize)
+		fg    = make([]uint8, graphics.ScreenW*graphics.ScreenH)
+		size  uint16
+		depth uint16
+		err   error
+	)
+	// read reads data, unless a previous read failed
+	read := func(data interface{}) {
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, data)
+		}
+	}
+	read(&sum)
+	if err == nil && sum != m.romChecksum() {
+		return fmt.Errorf("save state of another ROM")
+	}
+	read(&h)
+	read(ram)
+	read(fg)
+	read(&size)
+	sound := make([]byte, size)
+	read(sound)
+	read(&depth)
+	if depth > 0 {
+		v.Calls = make([]vm.Frame, depth)
+		read(v.Calls)
+	}
+	if err != nil {
+		return fmt.Errorf("reading save state: %s", err)
+	}
+	if err := v.Audio.UnmarshalBinary(sound); err != nil {
+		return err
+	}
+
+	v.RAM.Write(0, ram)
+	v.Graphics.WriteFG(fg)
+	v.PC, v.SP, v.Regs, v.Flags = h.PC, h.SP, h.Regs, h.Flags
+	v.Cycles, v.WaitVBlank = h.Cycles, h.WaitVBlank
+	v.StrictCalls = m.strictCalls
+	v.Timing = m.timing
+	v.Hook = m.hook
+	g := v.Graphics
+	g.BG, g.SpriteW, g.SpriteH = h.BG, h.SpriteW, h.SpriteH
+	g.HFlip, g.VFlip = h.HFlip, h.VFlip
+	for i, c := range h.Palette {
+		g.Palette[i].R, g.Palette[i].G, g.Palette[i].B = c[0], c[1], c[2]
+	}
+	if err := v.Check(); err != nil {
+		return fmt.Errorf("invalid save state: %s", err)
+	}
+
+	m.v, m.input = v, h.Input
+	return nil
+}
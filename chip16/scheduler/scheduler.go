@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+)
+
+// FrameDuration is the duration of a frame, in real time
+const FrameDuration = time.Second / cpu.FrameRate
+
+// maxLag is how late the scheduler may get before giving up catching up
+const maxLag = 10 * FrameDuration
+
+// Scheduler paces the emulation on a clock: it runs frames at 60 vertical
+// blanks per second, and renders them.
+//
+// When the emulation runs late, up to MaxSkip consecutive renders are skipped
+// to catch up. When it can't catch up, the scheduler slows down the emulation
+// instead of accumulating lag.
+type Scheduler struct {
+	// Frame runs the machine for a frame.
+	Frame func() error
+
+	// Render displays the last frame. It may be nil.
+	Render func() error
+
+	// Clock is the clock frames are paced on.
+	Clock Clock
+
+	// MaxSkip is the maximum number of consecutive renders that may be
+	// skipped when running late. Zero disables frame skipping.
+	MaxSkip int
+
+	mu     sync.Mutex
+	paused bool
+	turbo  bool
+	speed  float64
+
+	// Measures, over about a second
+	measureStart  time.Time
+	frames        int // emulated frames since measureStart
+	renders       int // renders since measureStart
+	measuredSpeed float64
+	measuredFPS   float64
+}
+
+// New creates a Scheduler running frame and render on the system clock,
+// at normal speed.
+func New(frame, render func() error) *Scheduler {
+	return &Scheduler{
+		Frame:  frame,
+		Render: render,
+		Clock:  SystemClock,
+		speed:  1,
+	}
+}
+
+// SetPaused pauses or resumes the emulation.
+func (s *Scheduler) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// Paused tells whether the emulation is paused.
+func (s *Scheduler) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// SetTurbo makes the emulation run as fast as possible. Renders are then
+// limited to 60 per second.
+func (s *Scheduler) SetTurbo(turbo bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turbo = turbo
+}
+
+// Turbo tells whether turbo mode is on.
+func (s *Scheduler) Turbo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.turbo
+}
+
+// SetSpeed sets the emulation speed, relative to real time (e.g. 0.5 for
+// slow motion). It must be positive.
+func (s *Scheduler) SetSpeed(speed float64) {
+	if speed <= 0 {
+		panic("scheduler: speed must be positive")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speed = speed
+}
+
+// Speed returns the measured emulation speed, relative to real time:
+// 1 means 60 emulated frames per second. It is 0 while paused.
+func (s *Scheduler) Speed() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		return 0
+	}
+	return s.measuredSpeed
+}
+
+// FPS returns the measured number of renders per second. It is 0 while
+// paused.
+func (s *Scheduler) FPS() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		return 0
+	}
+	return s.measuredFPS
+}
+
+// settings returns the current pause, turbo and speed settings
+func (s *Scheduler) settings() (bool, bool, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused, s.turbo, s.speed
+}
+
+// resetMeasures starts measuring anew from now
+func (s *Scheduler) resetMeasures(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.measureStart, s.frames, s.renders = now, 0, 0
+}
+
+// measure accounts for a frame, and updates the measures every second
+func (s *Scheduler) measure(now time.Time, rendered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.frames++
+	if rendered {
+		s.renders++
+	}
+	if elapsed := now.Sub(s.measureStart); elapsed >= time.Second {
+		s.measuredSpeed = float64(s.frames) / elapsed.Seconds() / cpu.FrameRate
+		s.measuredFPS = float64(s.renders) / elapsed.Seconds()
+		s.measureStart, s.frames, s.renders = now, 0, 0
+	}
+}
+
+// Run runs frames until stop is closed, or a frame or render fails.
+func (s *Scheduler) Run(stop <-chan struct{}) error {
+	now := s.Clock.Now()
+	s.resetMeasures(now)
+
+	// The n-th frame since base is due at due(base, n, speed): deriving
+	// deadlines from a frame count keeps rounding errors from accumulating.
+	base, n, lastSpeed := now, 0, 0.0
+	lastRender := time.Time{}
+	skipped := 0
+	wasPaused := false
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		paused, turbo, speed := s.settings()
+		if paused {
+			s.Clock.Sleep(FrameDuration)
+			wasPaused = true
+			continue
+		}
+		if wasPaused {
+			// The pause counts neither in the schedule, nor in the measures
+			now = s.Clock.Now()
+			base, n = now, 0
+			s.resetMeasures(now)
+			wasPaused = false
+		}
+		if speed != lastSpeed {
+			if n > 0 {
+				base, n = due(base, n, lastSpeed), 0
+			}
+			lastSpeed = speed
+		}
+
+		if err := s.Frame(); err != nil {
+			return err
+		}
+		n++
+		next := due(base, n, speed)
+		now = s.Clock.Now()
+
+		// Decide whether to render this frame
+		render := true
+		switch {
+		case turbo:
+			render = now.Sub(lastRender) >= FrameDuration
+			base, n, next = now, 0, now
+		case now.After(next) && skipped < s.MaxSkip:
+			render = false
+		}
+		if render && s.Render != nil {
+			if err := s.Render(); err != nil {
+				return err
+			}
+			lastRender = s.Clock.Now()
+		}
+		if render {
+			skipped = 0
+		} else {
+			skipped++
+		}
+
+		now = s.Clock.Now()
+		if lag := now.Sub(next); lag > maxLag {
+			// Too late to catch up
+			base, n = now, 0
+		} else if lag < 0 {
+			s.Clock.Sleep(-lag)
+		}
+		s.measure(s.Clock.Now(), render)
+	}
+}
+
+// due returns the time at which the n-th frame after base is due, at the
+// given speed
+func due(base time.Time, n int, speed float64) time.Time {
+	return base.Add(time.Duration(float64(n) * float64(time.Second) / (cpu.FrameRate * speed)))
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run runs n frames, each lasting frameCost, and renders lasting renderCost.
+// It returns the scheduler, the number of renders and the elapsed time.
+func run(n int, frameCost, renderCost time.Duration, setup func(*Scheduler)) (*Scheduler, int, time.Duration) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	stop := make(chan struct{})
+	frames, renders := 0, 0
+
+	s := New(
+		func() error {
+			clock.Advance(frameCost)
+			if frames++; frames == n {
+				close(stop)
+			}
+			return nil
+		},
+		func() error {
+			clock.Advance(renderCost)
+			renders++
+			return nil
+		},
+	)
+	s.Clock = clock
+	if setup != nil {
+		setup(s)
+	}
+	if err := s.Run(stop); err != nil {
+		panic(err)
+	}
+	return s, renders, clock.Now().Sub(time.Unix(0, 0))
+}
+
+func TestRealTime(t *testing.T) {
+	a := assert.New(t)
+
+	s, renders, elapsed := run(120, time.Millisecond, time.Millisecond, nil)
+	a.InDelta(2*time.Second, elapsed, float64(FrameDuration))
+	a.Equal(120, renders)
+	a.InDelta(1, s.Speed(), 0.01)
+	a.InDelta(60, s.FPS(), 1)
+}
+
+func TestNoDrift(t *testing.T) {
+	a := assert.New(t)
+
+	_, _, elapsed := run(3600, 0, 0, nil)
+	a.Equal(time.Minute, elapsed, "frame durations shouldn't be rounded")
+}
+
+func TestSlowMotion(t *testing.T) {
+	a := assert.New(t)
+
+	s, _, elapsed := run(120, time.Millisecond, 0, func(s *Scheduler) {
+		s.SetSpeed(0.5)
+	})
+	a.InDelta(4*time.Second, elapsed, float64(2*FrameDuration))
+	a.InDelta(0.5, s.Speed(), 0.01)
+}
+
+func TestTurbo(t *testing.T) {
+	a := assert.New(t)
+
+	s, renders, elapsed := run(2000, time.Millisecond, 0, func(s *Scheduler) {
+		s.SetTurbo(true)
+	})
+	a.Equal(2*time.Second, elapsed, "turbo shouldn't wait")
+	a.InDelta(16.7, s.Speed(), 0.5)
+	a.InDelta(120, renders, 2, "renders should be limited to 60 per second")
+}
+
+func TestFrameSkip(t *testing.T) {
+	a := assert.New(t)
+
+	// Renders are too slow to keep up
+	slow, renders, _ := run(240, time.Millisecond, 20*time.Millisecond, nil)
+	a.Equal(240, renders)
+	a.True(slow.Speed() < 0.9, "can't keep up without skipping")
+
+	s, renders, elapsed := run(240, time.Millisecond, 20*time.Millisecond, func(s *Scheduler) {
+		s.MaxSkip = 2
+	})
+	// Only the last frame and render may run late
+	a.InDelta(4*time.Second, elapsed, float64(21*time.Millisecond))
+	a.InDelta(1, s.Speed(), 0.05)
+	a.True(renders < 240, "some renders should be skipped")
+	a.True(renders >= 240/3, "no more than 2 consecutive renders may be skipped")
+}
+
+// pausingClock resumes its scheduler after a number of sleeps
+type pausingClock struct {
+	*FakeClock
+	s      *Scheduler
+	sleeps int
+}
+
+func (c *pausingClock) Sleep(d time.Duration) {
+	c.FakeClock.Sleep(d)
+	if c.s.Paused() {
+		if c.sleeps++; c.sleeps == 60 {
+			c.s.SetPaused(false)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	a := assert.New(t)
+
+	clock := &pausingClock{FakeClock: NewFakeClock(time.Unix(0, 0))}
+	stop := make(chan struct{})
+	frames := 0
+	var pausedAt time.Time
+
+	s := New(func() error {
+		frames++
+		switch frames {
+		case 10:
+			clock.s.SetPaused(true)
+			pausedAt = clock.Now()
+		case 11:
+			paused := clock.Now().Sub(pausedAt)
+			a.InDelta(time.Second, paused, float64(FrameDuration), "should stay paused")
+		case 20:
+			close(stop)
+		}
+		return nil
+	}, nil)
+	s.Clock = clock
+	clock.s = s
+
+	a.NoError(s.Run(stop))
+	a.Equal(20, frames)
+	a.Equal(60, clock.sleeps)
+}
+
+func TestPauseMeasures(t *testing.T) {
+	a := assert.New(t)
+
+	clock := &pausingClock{FakeClock: NewFakeClock(time.Unix(0, 0))}
+	stop := make(chan struct{})
+	frames := 0
+
+	s := New(func() error {
+		frames++
+		switch frames {
+		case 90:
+			a.InDelta(1, clock.s.Speed(), 0.01)
+			clock.s.SetPaused(true)
+			a.Zero(clock.s.Speed(), "no speed while paused")
+			a.Zero(clock.s.FPS())
+		case 150:
+			a.InDelta(1, clock.s.Speed(), 0.01, "the pause shouldn't be measured")
+			close(stop)
+		}
+		return nil
+	}, nil)
+	s.Clock = clock
+	clock.s = s
+
+	a.NoError(s.Run(stop))
+}
@@ -0,0 +1,234 @@
+package sprite
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/palette"
+)
+
+// MaxSize is the maximum height of a sprite, and width in bytes
+const MaxSize = 0xFF
+
+// Sprite is image data in the layout drawn by the DRW instructions: rows of
+// 4-bit palette indices, two pixels per byte (high nibble first). Index 0
+// is transparent.
+type Sprite struct {
+	// W and H are the dimensions of the sprite, in pixels.
+	W, H int
+
+	// Data holds the pixels, row by row.
+	Data []byte
+}
+
+// Stride returns the width of the sprite in bytes. Odd-width sprites are
+// padded with a transparent pixel.
+func (s *Sprite) Stride() int {
+	return (s.W + 1) / 2
+}
+
+// SPR returns the HHLL argument of the SPR instruction setting the sprite's
+// dimensions.
+func (s *Sprite) SPR() uint16 {
+	return uint16(s.H)<<8 | uint16(s.Stride())
+}
+
+// At returns the palette index of pixel (x, y).
+func (s *Sprite) At(x, y int) uint8 {
+	b := s.Data[y*s.Stride()+x/2]
+	if x%2 == 0 {
+		return b >> 4
+	}
+	return b & 0x0F
+}
+
+// FromImage converts an image to a sprite, using the 16 colors of pal.
+//
+// Transparent pixels (with alpha below 50%) are mapped to index 0, others
+// to the closest color among indices 1 to 15.
+func FromImage(img image.Image, pal []color.RGBA) (*Sprite, error) {
+	if len(pal) != palette.Size {
+		return nil, fmt.Errorf("expected %d colors, got %d", palette.Size, len(pal))
+	}
+	r := img.Bounds()
+	s := &Sprite{W: r.Dx(), H: r.Dy()}
+	if s.Stride() > MaxSize || s.H > MaxSize {
+		return nil, fmt.Errorf("image too large: %dx%d", s.W, s.H)
+	}
+
+	s.Data = make([]byte, s.Stride()*s.H)
+	for y := 0; y < s.H; y++ {
+		for x := 0; x < s.W; x++ {
+			c := closest(pal, img.At(r.Min.X+x, r.Min.Y+y))
+			if x%2 == 0 {
+				c <<= 4
+			}
+			s.Data[y*s.Stride()+x/2] |= c
+		}
+	}
+	return s, nil
+}
+
+// closest returns the index of the color of pal closest to c
+func closest(pal []color.RGBA, c color.Color) uint8 {
+	cr, cg, cb, ca := c.RGBA()
+	if ca < 0x8000 {
+		return 0
+	}
+	// Unpremultiply
+	cr, cg, cb = cr*0xFFFF/ca>>8, cg*0xFFFF/ca>>8, cb*0xFFFF/ca>>8
+
+	best, dist := uint8(1), -1
+	for i := 1; i < len(pal); i++ {
+		dr := int(cr) - int(pal[i].R)
+		dg := int(cg) - int(pal[i].G)
+		db := int(cb) - int(pal[i].B)
+		if d := dr*dr + dg*dg + db*db; dist < 0 || d < dist {
+			best, dist = uint8(i), d
+		}
+	}
+	return best
+}
+
+// Palette builds a palette suited to an image. Index 0 is transparent, and
+// the opaque colors of the image are reduced to 15 by median cut.
+func Palette(img image.Image) []color.RGBA {
+	counts := make(map[color.RGBA]int)
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA); c.A >= 0x80 {
+				counts[color.RGBA{c.R, c.G, c.B, 0xFF}]++
+			}
+		}
+	}
+
+	colors := make([]weighted, 0, len(counts))
+	for c, n := range counts {
+		colors = append(colors, weighted{c, n})
+	}
+	// Make the result independent of map ordering
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return a.R < b.R || a.R == b.R && (a.G < b.G || a.G == b.G && a.B < b.B)
+	})
+
+	pal := make([]color.RGBA, palette.Size)
+	for i, box := range medianCut(colors, palette.Size-1) {
+		pal[i+1] = box.mean()
+	}
+	return pal
+}
+
+// weighted is a color, and the number of pixels having it
+type weighted struct {
+	c color.RGBA
+	n int
+}
+
+type box []weighted
+
+// channel returns the value of a color channel (0: red, 1: green, 2: blue)
+func channel(c color.RGBA, ch int) uint8 {
+	return [3]uint8{c.R, c.G, c.B}[ch]
+}
+
+// widest returns the channel with the widest range of values in the box, and
+// that range.
+func (b box) widest() (int, int) {
+	best, width := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 0xFF, 0
+		for _, w := range b {
+			v := int(channel(w.c, ch))
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > width {
+			best, width = ch, hi-lo
+		}
+	}
+	return best, width
+}
+
+func (b box) mean() color.RGBA {
+	var r, g, bl, n int
+	for _, w := range b {
+		r += int(w.c.R) * w.n
+		g += int(w.c.G) * w.n
+		bl += int(w.c.B) * w.n
+		n += w.n
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 0xFF}
+}
+
+// medianCut splits colors into at most n boxes of similar colors
+func medianCut(colors []weighted, n int) []box {
+	if len(colors) == 0 {
+		return nil
+	}
+	boxes := []box{colors}
+	for len(boxes) < n {
+		// Split the box with the widest channel
+		split, ch, width := -1, 0, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if c, w := b.widest(); w > width || split < 0 {
+				split, ch, width = i, c, w
+			}
+		}
+		if split < 0 {
+			break
+		}
+
+		b := boxes[split]
+		sort.SliceStable(b, func(i, j int) bool {
+			return channel(b[i].c, ch) < channel(b[j].c, ch)
+		})
+		// Cut at the median pixel, keeping both halves non-empty
+		total, half, m := 0, 0, 1
+		for _, w := range b {
+			total += w.n
+		}
+		for i, w := range b[:len(b)-1] {
+			half += w.n
+			m = i + 1
+			if 2*half >= total {
+				break
+			}
+		}
+		boxes = append(boxes, b[m:])
+		boxes[split] = b[:m]
+	}
+	return boxes
+}
+
+// WriteAsm writes the sprite as assembler source: a comment giving its
+// dimensions and the matching SPR instruction, followed by a label and one db
+// directive per row.
+func (s *Sprite) WriteAsm(w io.Writer, label string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %dx%d pixels\n; spr 0x%04X\n%s:\n", s.W, s.H, s.SPR(), label)
+	stride := s.Stride()
+	for y := 0; y < s.H; y++ {
+		fmt.Fprint(bw, "\tdb ")
+		for i, b := range s.Data[y*stride : (y+1)*stride] {
+			if i > 0 {
+				fmt.Fprint(bw, ", ")
+			}
+			fmt.Fprintf(bw, "0x%02X", b)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
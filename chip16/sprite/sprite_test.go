@@ -0,0 +1,112 @@
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage returns a 3x2 image:
+//
+//	red   white  (transparent)
+//	black gray   red
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{0xC0, 0x38, 0x30, 0xFF})
+	img.Set(1, 0, color.White)
+	img.Set(0, 1, color.Black)
+	img.Set(1, 1, color.RGBA{0x80, 0x80, 0x80, 0xFF})
+	img.Set(2, 1, color.RGBA{0xBF, 0x39, 0x32, 0xFF})
+	return img
+}
+
+func TestFromImage(t *testing.T) {
+	a := assert.New(t)
+
+	s, err := FromImage(testImage(), graphics.DefaultPalette())
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(2, s.Stride())
+	a.Equal(uint16(0x0202), s.SPR())
+	a.Equal([]byte{0x3F, 0x00, 0x12, 0x30}, s.Data)
+	a.Equal(uint8(0x2), s.At(1, 1))
+
+	// The sprite should draw back as the image
+	g := graphics.NewState()
+	g.SpriteW, g.SpriteH = uint8(s.Stride()), uint8(s.H)
+	g.HFlip = true
+	if _, err := g.DrawSprite(0, 0, s.Data); a.NoError(err) {
+		a.Equal([]uint8{0x0, 0x0, 0xF, 0x3}, g.Row(0)[:4])
+		a.Equal([]uint8{0x0, 0x3, 0x2, 0x1}, g.Row(1)[:4])
+	}
+
+	_, err = FromImage(image.NewNRGBA(image.Rect(0, 0, 512, 1)), graphics.DefaultPalette())
+	a.Error(err, "too wide images should yield an error")
+	_, err = FromImage(testImage(), graphics.DefaultPalette()[:8])
+	a.Error(err, "incomplete palettes should yield an error")
+}
+
+func TestPalette(t *testing.T) {
+	a := assert.New(t)
+
+	pal := Palette(testImage())
+	a.Len(pal, 16)
+	a.Equal(color.RGBA{}, pal[0], "index 0 should be transparent")
+
+	// Few enough colors are kept as is
+	a.Subset(pal[1:], []color.RGBA{
+		{0x00, 0x00, 0x00, 0xFF},
+		{0x80, 0x80, 0x80, 0xFF},
+		{0xBF, 0x39, 0x32, 0xFF},
+		{0xC0, 0x38, 0x30, 0xFF},
+		{0xFF, 0xFF, 0xFF, 0xFF},
+	})
+
+	s, err := FromImage(testImage(), pal)
+	if a.NoError(err) {
+		a.Equal(uint8(0), s.At(2, 0))
+		a.NotEqual(s.At(0, 0), s.At(2, 1), "distinct colors should be kept apart")
+	}
+}
+
+func TestPaletteMedianCut(t *testing.T) {
+	a := assert.New(t)
+
+	// A gradient of 64 grays
+	img := image.NewGray(image.Rect(0, 0, 64, 1))
+	for x := 0; x < 64; x++ {
+		img.SetGray(x, 0, color.Gray{uint8(4 * x)})
+	}
+
+	pal := Palette(img)
+	seen := make(map[color.RGBA]bool)
+	for _, c := range pal[1:] {
+		a.Equal(c.R, c.G)
+		a.Equal(c.R, c.B)
+		a.False(seen[c], "colors should be distinct")
+		seen[c] = true
+	}
+}
+
+func TestWriteAsm(t *testing.T) {
+	a := assert.New(t)
+
+	s, err := FromImage(testImage(), graphics.DefaultPalette())
+	if !a.NoError(err) {
+		return
+	}
+	var b strings.Builder
+	if a.NoError(s.WriteAsm(&b, "player")) {
+		a.Equal(`; 3x2 pixels
+; spr 0x0202
+player:
+	db 0x3F, 0x00
+	db 0x12, 0x30
+`, b.String())
+	}
+}
@@ -0,0 +1,295 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Line is a position in a source file.
+type Line struct {
+	File string
+	Line int
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Label is a named address.
+type Label struct {
+	Name string
+	Addr vm.Pointer
+}
+
+// Table maps labels to addresses, and addresses to source lines.
+type Table struct {
+	// Dir is the directory source files are relative to.
+	Dir string
+
+	lines  map[vm.Pointer]Line
+	labels []Label // sorted by address, then name
+	byName map[string]vm.Pointer
+}
+
+// New creates an empty Table.
+func New() *Table {
+	return &Table{
+		lines:  make(map[vm.Pointer]Line),
+		byName: make(map[string]vm.Pointer),
+	}
+}
+
+// AddLabel records a label. Redefining a label moves it.
+func (t *Table) AddLabel(name string, addr vm.Pointer) {
+	if old, ok := t.byName[name]; ok {
+		i := t.search(old)
+		for t.labels[i].Name != name {
+			i++
+		}
+		t.labels = append(t.labels[:i], t.labels[i+1:]...)
+	}
+	t.byName[name] = addr
+
+	i := t.search(addr)
+	for i < len(t.labels) && t.labels[i].Addr == addr && t.labels[i].Name < name {
+		i++
+	}
+	t.labels = append(t.labels, Label{})
+	copy(t.labels[i+1:], t.labels[i:])
+	t.labels[i] = Label{name, addr}
+}
+
+// search returns the index of the first label at or after addr
+func (t *Table) search(addr vm.Pointer) int {
+	return sort.Search(len(t.labels), func(i int) bool {
+		return t.labels[i].Addr >= addr
+	})
+}
+
+// Labels returns all labels, sorted by address.
+func (t *Table) Labels() []Label {
+	return append([]Label(nil), t.labels...)
+}
+
+// Lookup returns the address of a label.
+func (t *Table) Lookup(name string) (vm.Pointer, bool) {
+	addr, ok := t.byName[name]
+	return addr, ok
+}
+
+// LabelAt returns the name of the label at addr. If there are several, the
+// first one in alphabetical order is returned.
+func (t *Table) LabelAt(addr vm.Pointer) (string, bool) {
+	i := t.search(addr)
+	if i < len(t.labels) && t.labels[i].Addr == addr {
+		return t.labels[i].Name, true
+	}
+	return "", false
+}
+
+// Symbolize renders an address relative to the closest label before it
+// (e.g. player_update+0x10), or as a plain hexadecimal address if there's
+// none.
+func (t *Table) Symbolize(addr vm.Pointer) string {
+	// Index of the first label after addr
+	i := sort.Search(len(t.labels), func(i int) bool {
+		return t.labels[i].Addr > addr
+	})
+	if i == 0 {
+		return fmt.Sprintf("0x%04X", uint16(addr))
+	}
+
+	// Pick the first label at the closest address
+	l := t.labels[i-1]
+	for i > 1 && t.labels[i-2].Addr == l.Addr {
+		i--
+		l = t.labels[i-1]
+	}
+	if l.Addr == addr {
+		return l.Name
+	}
+	return fmt.Sprintf("%s+0x%X", l.Name, uint16(addr-l.Addr))
+}
+
+// FuncName returns the name of the function starting at entry: its label if
+// it has one, or sub_XXXX.
+func (t *Table) FuncName(entry vm.Pointer) string {
+	if name, ok := t.LabelAt(entry); ok {
+		return name
+	}
+	return fmt.Sprintf("sub_%04X", uint16(entry))
+}
+
+// AddLine records that the instruction at addr comes from the given line.
+func (t *Table) AddLine(addr vm.Pointer, l Line) {
+	t.lines[addr] = l
+}
+
+// LineAt returns the source line of the instruction at addr.
+func (t *Table) LineAt(addr vm.Pointer) (Line, bool) {
+	l, ok := t.lines[addr]
+	return l, ok
+}
+
+// Addresses returns the addresses of the instructions generated by the given
+// line, sorted.
+//
+// file may be absolute, or relative to the table's directory. If no file
+// matches exactly, files are matched by base name.
+func (t *Table) Addresses(file string, line int) []vm.Pointer {
+	var exact, base []vm.Pointer
+	for addr, l := range t.lines {
+		if l.Line != line {
+			continue
+		}
+		if t.Path(l.File) == t.Path(file) {
+			exact = append(exact, addr)
+		} else if filepath.Base(l.File) == filepath.Base(file) {
+			base = append(base, addr)
+		}
+	}
+	if exact == nil {
+		exact = base
+	}
+	sort.Slice(exact, func(i, j int) bool { return exact[i] < exact[j] })
+	return exact
+}
+
+// Path returns the cleaned path of a source file, resolved against the
+// table's directory.
+func (t *Table) Path(file string) string {
+	if filepath.IsAbs(file) || t.Dir == "" {
+		return filepath.Clean(file)
+	}
+	return filepath.Join(t.Dir, file)
+}
+
+// Read parses a symbol file.
+//
+// Symbol files are line-oriented text files. Blank lines and lines starting
+// with ';' are ignored, others are made of space-separated fields:
+//
+//		label ADDR NAME
+//		line ADDR FILE:LINE
+//
+// where ADDR is an hexadecimal address (with or without 0x prefix). Label
+// entries name an address, line entries tell which source line generated the
+// instruction at ADDR. FILE spans the rest of the line, so it may hold
+// spaces.
+func Read(r io.Reader) (*Table, error) {
+	t := New()
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == ';' {
+			continue
+		}
+		if err := t.parse(splitFields(text)); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load reads a symbol file from disk. Source files are resolved relative to
+// the symbol file's directory.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	t.Dir = filepath.Dir(path)
+	return t, nil
+}
+
+// splitFields splits an entry into its kind, its address and the rest of
+// the line
+func splitFields(text string) []string {
+	var fields []string
+	for len(fields) < 2 {
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			break
+		}
+		fields = append(fields, text[:i])
+		text = strings.TrimLeft(text[i:], " \t")
+	}
+	return append(fields, text)
+}
+
+func (t *Table) parse(fields []string) error {
+	if len(fields) != 3 {
+		return fmt.Errorf("expected 3 fields, got %d", len(fields))
+	}
+	addr, err := parseAddr(fields[1])
+	if err != nil {
+		return err
+	}
+
+	switch fields[0] {
+	case "label":
+		if strings.ContainsAny(fields[2], " \t") {
+			return fmt.Errorf("bad label %q", fields[2])
+		}
+		t.AddLabel(fields[2], addr)
+
+	case "line":
+		i := strings.LastIndexByte(fields[2], ':')
+		if i < 0 {
+			return fmt.Errorf("bad source position %q", fields[2])
+		}
+		n, err := strconv.Atoi(fields[2][i+1:])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad line number %q", fields[2][i+1:])
+		}
+		t.AddLine(addr, Line{fields[2][:i], n})
+
+	default:
+		return fmt.Errorf("unknown entry %q", fields[0])
+	}
+	return nil
+}
+
+// Write writes the table as a symbol file (see Read), labels first.
+func (t *Table) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, l := range t.labels {
+		fmt.Fprintf(bw, "label 0x%04X %s\n", uint16(l.Addr), l.Name)
+	}
+
+	addrs := make([]vm.Pointer, 0, len(t.lines))
+	for addr := range t.lines {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	for _, addr := range addrs {
+		fmt.Fprintf(bw, "line 0x%04X %s\n", uint16(addr), t.lines[addr])
+	}
+	return bw.Flush()
+}
+
+func parseAddr(s string) (vm.Pointer, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	addr, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %q", s)
+	}
+	return vm.Pointer(addr), nil
+}
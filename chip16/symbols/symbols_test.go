@@ -0,0 +1,132 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSymbols = `
+; test symbols
+label 0x0000 main
+label 0x0100 draw_sprite
+label 0x0100 blit
+label 0xFFF0 io
+line 0x0000 main.s:3
+line 0x0004 main.s:4
+line 0008   main.s:4
+line 0x0100 lib/sprites.s:10
+line 0x0200 my games/lib.s:7
+`
+
+func TestRead(t *testing.T) {
+	a := assert.New(t)
+
+	tab, err := Read(strings.NewReader(testSymbols))
+	if !a.NoError(err) {
+		return
+	}
+
+	l, ok := tab.LineAt(0x0008)
+	a.True(ok)
+	a.Equal(Line{"main.s", 4}, l)
+	a.Equal("main.s:4", l.String())
+
+	_, ok = tab.LineAt(0x0002)
+	a.False(ok)
+
+	a.Equal([]vm.Pointer{0x0004, 0x0008}, tab.Addresses("main.s", 4))
+	a.Equal([]vm.Pointer{0x0100}, tab.Addresses("/home/user/game/lib/sprites.s", 10))
+	a.Empty(tab.Addresses("main.s", 10))
+
+	l, ok = tab.LineAt(0x0200)
+	a.True(ok)
+	a.Equal(Line{"my games/lib.s", 7}, l, "paths may hold spaces")
+
+	tab.Dir = "/home/user/game"
+	a.Equal([]vm.Pointer{0x0100}, tab.Addresses("/home/user/game/lib/sprites.s", 10))
+	a.Equal("/home/user/game/main.s", tab.Path("main.s"))
+}
+
+func TestReadErrors(t *testing.T) {
+	a := assert.New(t)
+
+	for _, bad := range []string{
+		"line 0x0000",
+		"line 0xZZZZ main.s:3",
+		"line 0x10000 main.s:3",
+		"line 0x0000 main.s",
+		"line 0x0000 main.s:0",
+		"frob 0x0000 main.s:3",
+		"label 0x0000 two words",
+	} {
+		_, err := Read(strings.NewReader(bad))
+		a.Errorf(err, "%q should yield an error", bad)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	a := assert.New(t)
+
+	tab, err := Read(strings.NewReader(testSymbols))
+	if !a.NoError(err) {
+		return
+	}
+
+	addr, ok := tab.Lookup("draw_sprite")
+	a.True(ok)
+	a.Equal(vm.Pointer(0x0100), addr)
+	_, ok = tab.Lookup("nope")
+	a.False(ok)
+
+	name, ok := tab.LabelAt(0x0100)
+	a.True(ok)
+	a.Equal("blit", name)
+	_, ok = tab.LabelAt(0x0104)
+	a.False(ok)
+
+	a.Equal("main", tab.Symbolize(0x0000))
+	a.Equal("main+0x10", tab.Symbolize(0x0010))
+	a.Equal("blit+0x4", tab.Symbolize(0x0104))
+	a.Equal("io+0xF", tab.Symbolize(0xFFFF))
+
+	a.Equal("blit", tab.FuncName(0x0100))
+	a.Equal("sub_0104", tab.FuncName(0x0104))
+
+	tab.AddLabel("main", 0x0200)
+	a.Equal("0x0000", tab.Symbolize(0x0000))
+	a.Equal("main+0x1", tab.Symbolize(0x0201))
+	a.Equal([]Label{
+		{"blit", 0x0100}, {"draw_sprite", 0x0100}, {"main", 0x0200}, {"io", 0xFFF0},
+	}, tab.Labels())
+}
+
+func TestWrite(t *testing.T) {
+	a := assert.New(t)
+
+	tab, err := Read(strings.NewReader(testSymbols))
+	if !a.NoError(err) {
+		return
+	}
+
+	var b strings.Builder
+	if a.NoError(tab.Write(&b)) {
+		a.Equal(`label 0x0000 main
+label 0x0100 blit
+label 0x0100 draw_sprite
+label 0xFFF0 io
+line 0x0000 main.s:3
+line 0x0004 main.s:4
+line 0x0008 main.s:4
+line 0x0100 lib/sprites.s:10
+line 0x0200 my games/lib.s:7
+`, b.String())
+
+		tab2, err := Read(strings.NewReader(b.String()))
+		if a.NoError(err) {
+			a.Equal(tab, tab2)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package term
+
+import (
+	"sync"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Key is a key pressed on the terminal: a character, or one of the special
+// keys below.
+type Key rune
+
+// Special keys
+const (
+	KeyUp Key = 0x110000 + iota // Beyond Unicode
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyEscape
+)
+
+// Control characters
+const (
+	KeyCtrlC Key = 0x03
+	KeyTab   Key = '\t'
+	KeyEnter Key = '\r'
+)
+
+// Decode decodes the keys read from a terminal in raw mode. Escape sequences
+// are expected to be read at once, as terminals send them. Unknown escape
+// sequences are dropped.
+func Decode(b []byte) []Key {
+	var keys []Key
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0x1b {
+			// Multi-byte characters aren't mapped to anything: keep
+			// their bytes as is.
+			keys = append(keys, Key(b[i]))
+			continue
+		}
+		if i+1 == len(b) {
+			keys = append(keys, KeyEscape)
+			break
+		}
+		if b[i+1] != '[' && b[i+1] != 'O' {
+			keys = append(keys, KeyEscape)
+			continue
+		}
+		// CSI or SS3: skip parameters up to the final byte
+		j := i + 2
+		for j < len(b) && (b[j] < 0x40 || b[j] > 0x7E) {
+			j++
+		}
+		if j == len(b) {
+			break
+		}
+		switch b[j] {
+		case 'A':
+			keys = append(keys, KeyUp)
+		case 'B':
+			keys = append(keys, KeyDown)
+		case 'C':
+			keys = append(keys, KeyRight)
+		case 'D':
+			keys = append(keys, KeyLeft)
+		}
+		i = j
+	}
+	return keys
+}
+
+// Keymap maps keys to controller buttons.
+type Keymap map[Key]uint16
+
+// DefaultKeymap maps the arrow keys to the directional pad, Enter to Start,
+// Space to Select, and Z and X to A and B.
+var DefaultKeymap = Keymap{
+	KeyUp:    vm.ButtonUp,
+	KeyDown:  vm.ButtonDown,
+	KeyLeft:  vm.ButtonLeft,
+	KeyRight: vm.ButtonRight,
+	KeyEnter: vm.ButtonStart,
+	' ':      vm.ButtonSelect,
+	'z':      vm.ButtonA,
+	'Z':      vm.ButtonA,
+	'x':      vm.ButtonB,
+	'X':      vm.ButtonB,
+}
+
+// DefaultHold is the default number of frames a key stays held after a press
+const DefaultHold = 8
+
+// Input turns key presses into controller states. It is safe for concurrent
+// use.
+//
+// Terminals don't report key releases: a button is held for Hold frames after
+// each press, and the terminal's auto-repeat keeps it held as long as the key
+// is down. Hold should be higher than the auto-repeat interval.
+type Input struct {
+	Keymap Keymap
+	Hold   int
+
+	mu   sync.Mutex
+	held [16]int // frames left for each button
+}
+
+// NewInput creates an Input with the default keymap.
+func NewInput() *Input {
+	return &Input{
+		Keymap: DefaultKeymap,
+		Hold:   DefaultHold,
+	}
+}
+
+// Press presses the buttons mapped to k, and tells whether there were any.
+func (in *Input) Press(k Key) bool {
+	buttons, ok := in.Keymap[k]
+	if !ok {
+		return false
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for i := range in.held {
+		if buttons&(1<<uint(i)) != 0 {
+			in.held[i] = in.Hold
+		}
+	}
+	return true
+}
+
+// Frame returns the buttons held during the next frame.
+func (in *Input) Frame() uint16 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var buttons uint16
+	for i := range in.held {
+		if in.held[i] > 0 {
+			buttons |= 1 << uint(i)
+			in.held[i]--
+		}
+	}
+	return buttons
+}
@@ -0,0 +1,38 @@
+package term
+
+import (
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([]Key{'a', KeyEnter, KeyCtrlC}, Decode([]byte("a\r\x03")))
+	a.Equal([]Key{KeyUp, KeyDown, KeyRight, KeyLeft}, Decode([]byte("\x1b[A\x1b[B\x1bOC\x1b[D")))
+	a.Equal([]Key{KeyEscape}, Decode([]byte("\x1b")))
+	a.Equal([]Key{KeyEscape, 'q'}, Decode([]byte("\x1bq")))
+
+	// Unknown and modified sequences
+	a.Equal([]Key{'a', KeyUp}, Decode([]byte("\x1b[15~a\x1b[1;5A")))
+	a.Empty(Decode([]byte("\x1b[1;")))
+}
+
+func TestInput(t *testing.T) {
+	a := assert.New(t)
+	in := NewInput()
+	in.Hold = 2
+
+	a.True(in.Press(KeyUp))
+	a.True(in.Press('z'))
+	a.False(in.Press('q'))
+	a.Equal(uint16(vm.ButtonUp|vm.ButtonA), in.Frame())
+
+	// Auto-repeat
+	a.True(in.Press(KeyUp))
+	a.Equal(uint16(vm.ButtonUp|vm.ButtonA), in.Frame())
+	a.Equal(uint16(vm.ButtonUp), in.Frame())
+	a.Equal(uint16(0), in.Frame())
+}
@@ -0,0 +1,29 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package term
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// State is a terminal state, to restore after raw mode.
+type State struct{}
+
+var errUnsupported = fmt.Errorf("terminal raw mode isn't supported on %s", runtime.GOOS)
+
+// MakeRaw puts the terminal fd in raw mode, and returns its previous state.
+func MakeRaw(fd int) (*State, error) {
+	return nil, errUnsupported
+}
+
+// Restore restores the terminal fd to a previous state.
+func Restore(fd int, s *State) error {
+	return errUnsupported
+}
+
+// Size returns the number of columns and rows of the terminal fd.
+func Size(fd int) (cols, rows int, err error) {
+	return 0, 0, errUnsupported
+}
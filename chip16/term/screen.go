@@ -0,0 +1,154 @@
+// Package term implements a chip16 frontend for ANSI terminals.
+package term
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+	"strconv"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+)
+
+// Screen draws frames on a truecolor ANSI terminal, using upper half block
+// characters: each character cell shows two pixels, one above the other.
+//
+// Frames can be downscaled to fit smaller terminals: each cell then shows the
+// average colors of two scale×scale blocks of pixels (see NewScreen).
+type Screen struct {
+	// W is the terminal
+	W io.Writer
+
+	scale int      // downscaling factor
+	pix   []uint8  // composed frame
+	cells []uint64 // cells on the terminal, as top<<32 | bottom colors
+	valid bool     // whether cells reflect the terminal
+	buf   bytes.Buffer
+}
+
+// NewScreen creates a Screen drawing on w, with the given downscaling factor.
+func NewScreen(w io.Writer, scale int) *Screen {
+	if scale < 1 {
+		scale = 1
+	}
+	s := &Screen{
+		W:     w,
+		scale: scale,
+		pix:   make([]uint8, graphics.ScreenW*graphics.ScreenH),
+	}
+	cols, rows := s.Size()
+	s.cells = make([]uint64, cols*rows)
+	return s
+}
+
+// Size returns the number of columns and rows a frame takes on the terminal.
+func (s *Screen) Size() (cols, rows int) {
+	return graphics.ScreenW / s.scale, graphics.ScreenH / (2 * s.scale)
+}
+
+// FitScale returns the smallest downscaling factor at which a frame fits in
+// a terminal of the given size.
+func FitScale(cols, rows int) int {
+	scale := 1
+	for graphics.ScreenW/scale > cols || graphics.ScreenH/(2*scale) > rows {
+		scale++
+	}
+	return scale
+}
+
+// Reset clears the terminal and hides the cursor. The next frame is drawn
+// entirely.
+func (s *Screen) Reset() error {
+	s.valid = false
+	_, err := io.WriteString(s.W, "\x1b[0m\x1b[2J\x1b[?25l")
+	return err
+}
+
+// Close resets the colors, shows the cursor and moves it below the frame.
+func (s *Screen) Close() error {
+	_, rows := s.Size()
+	_, err := io.WriteString(s.W, "\x1b[0m\x1b["+strconv.Itoa(rows+1)+";1H\x1b[?25h\r\n")
+	return err
+}
+
+// Draw draws the visible screen of g. Only the rows that changed since the
+// last frame are written.
+func (s *Screen) Draw(g *graphics.State) error {
+	g.Compose(s.pix)
+	cols, rows := s.Size()
+
+	s.buf.Reset()
+	line := make([]uint64, cols)
+	for row := 0; row < rows; row++ {
+		changed := !s.valid
+		for col := range line {
+			top := s.average(g.Palette, col, 2*row)
+			bottom := s.average(g.Palette, col, 2*row+1)
+			line[col] = uint64(top)<<32 | uint64(bottom)
+			if line[col] != s.cells[row*cols+col] {
+				changed = true
+			}
+		}
+		if changed {
+			copy(s.cells[row*cols:], line)
+			s.writeRow(row, line)
+		}
+	}
+	s.valid = true
+
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.W.Write(s.buf.Bytes())
+	return err
+}
+
+// average returns the average color (as 0xRRGGBB) of the block of pixels at
+// the given block coordinates
+func (s *Screen) average(pal []color.RGBA, bx, by int) uint32 {
+	var r, g, b, n int
+	for y := by * s.scale; y < (by+1)*s.scale; y++ {
+		row := s.pix[y*graphics.ScreenW:]
+		for x := bx * s.scale; x < (bx+1)*s.scale; x++ {
+			c := pal[row[x]&0x0F]
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			n++
+		}
+	}
+	return uint32(r/n)<<16 | uint32(g/n)<<8 | uint32(b/n)
+}
+
+// writeRow writes a row of cells to the buffer
+func (s *Screen) writeRow(row int, line []uint64) {
+	s.buf.WriteString("\x1b[")
+	s.buf.WriteString(strconv.Itoa(row + 1))
+	s.buf.WriteString(";1H")
+
+	var fg, bg uint32
+	for i, cell := range line {
+		top, bottom := uint32(cell>>32), uint32(cell)
+		if i == 0 || top != fg {
+			s.writeColor("\x1b[38;2;", top)
+			fg = top
+		}
+		if i == 0 || bottom != bg {
+			s.writeColor("\x1b[48;2;", bottom)
+			bg = bottom
+		}
+		s.buf.WriteString("▀")
+	}
+	s.buf.WriteString("\x1b[0m")
+}
+
+// writeColor writes a truecolor SGR sequence
+func (s *Screen) writeColor(prefix string, c uint32) {
+	s.buf.WriteString(prefix)
+	s.buf.WriteString(strconv.Itoa(int(c >> 16)))
+	s.buf.WriteByte(';')
+	s.buf.WriteString(strconv.Itoa(int(c >> 8 & 0xFF)))
+	s.buf.WriteByte(';')
+	s.buf.WriteString(strconv.Itoa(int(c & 0xFF)))
+	s.buf.WriteByte('m')
+}
@@ -0,0 +1,79 @@
+package term
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScreenSize(t *testing.T) {
+	a := assert.New(t)
+
+	cols, rows := NewScreen(nil, 1).Size()
+	a.Equal(320, cols)
+	a.Equal(120, rows)
+
+	cols, rows = NewScreen(nil, 4).Size()
+	a.Equal(80, cols)
+	a.Equal(30, rows)
+
+	a.Equal(1, FitScale(320, 120))
+	a.Equal(5, FitScale(80, 24))
+	a.Equal(2, FitScale(200, 100))
+}
+
+func TestScreenDraw(t *testing.T) {
+	a := assert.New(t)
+	var buf bytes.Buffer
+	s := NewScreen(&buf, 2)
+	g := graphics.NewState()
+
+	g.BG = 0x3 // Red
+	g.SetPixel(0, 0, 0xF)
+	g.SetPixel(1, 0, 0xF)
+	g.SetPixel(0, 1, 0xF)
+	g.SetPixel(1, 1, 0xF)
+	if !a.NoError(s.Draw(g)) {
+		return
+	}
+	out := buf.String()
+	a.Equal(60, strings.Count(out, ";1H"), "all rows should be drawn")
+	a.Equal(160*60, strings.Count(out, "▀"))
+	a.True(strings.HasPrefix(out, "\x1b[1;1H\x1b[38;2;255;255;255m\x1b[48;2;191;57;50m▀\x1b[38;2;191;57;50m▀▀"), out[:60])
+
+	// Nothing changed
+	buf.Reset()
+	a.NoError(s.Draw(g))
+	a.Empty(buf.String())
+
+	// Only the second row changed, and its colors are averaged
+	buf.Reset()
+	g.SetPixel(2, 4, 0x1)
+	a.NoError(s.Draw(g))
+	out = buf.String()
+	a.Equal(1, strings.Count(out, ";1H"))
+	a.True(strings.HasPrefix(out, "\x1b[2;1H\x1b[38;2;191;57;50m\x1b[48;2;191;57;50m▀\x1b[38;2;143;42;37m▀"), out[:60])
+
+	// Everything is drawn after a reset
+	buf.Reset()
+	a.NoError(s.Reset())
+	a.NoError(s.Draw(g))
+	a.Equal(60, strings.Count(buf.String(), ";1H"))
+}
+
+func BenchmarkScreenDraw(b *testing.B) {
+	g := graphics.NewState()
+	fg := make([]uint8, graphics.ScreenW*graphics.ScreenH)
+	for i := range fg {
+		fg[i] = uint8(i % 16)
+	}
+	g.WriteFG(fg)
+	s := NewScreen(&bytes.Buffer{}, 2)
+	for n := 0; n < b.N; n++ {
+		s.valid = false
+		s.Draw(g)
+	}
+}
@@ -0,0 +1,58 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Tracer logs every instruction executed by a VM, through its hook (see
+// Attach).
+type Tracer struct {
+	// W is where the trace is written.
+	W io.Writer
+
+	// Symbols are used to locate instructions and render their arguments.
+	// Raw addresses are shown if nil.
+	Symbols *symbols.Table
+
+	// Err is the first error met while writing the trace. Nothing is
+	// written after it.
+	Err error
+}
+
+// New creates a Tracer writing to w.
+func New(w io.Writer, syms *symbols.Table) *Tracer {
+	return &Tracer{W: w, Symbols: syms}
+}
+
+// Attach makes the tracer log every instruction executed by v, by setting its
+// hook.
+func (t *Tracer) Attach(v *vm.State) {
+	v.Hook = t.Hook
+}
+
+// Hook logs an executed instruction. It is meant to be used as a VM's hook
+// (see vm.State.Hook).
+//
+// Each line holds the location of the instruction, its address, its raw
+// opcode and its disassembly.
+func (t *Tracer) Hook(v *vm.State, e vm.Executed) {
+	if t.Err != nil {
+		return
+	}
+	if t.Symbols != nil {
+		_, t.Err = fmt.Fprintf(
+			t.W, "%-24s %04X: %08X  %s\n",
+			t.Symbols.Symbolize(e.PC), uint16(e.PC), uint32(e.Op),
+			cpu.DisassembleWith(e.Op, t.Symbols.Symbolize),
+		)
+	} else {
+		_, t.Err = fmt.Fprintf(
+			t.W, "%04X: %08X  %s\n", uint16(e.PC), uint32(e.Op), cpu.Disassemble(e.Op),
+		)
+	}
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cpu"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/symbols"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestState loads the following program:
+//
+//	0x00: CALL 0x0010
+//	0x10: RET
+func newTestState() *vm.State {
+	v := vm.NewState()
+	v.RAM.Write(0x00, []byte{0x14, 0x00, 0x10, 0x00})
+	v.RAM.Write(0x10, []byte{0x15, 0x00, 0x00, 0x00})
+	return v
+}
+
+func TestTracer(t *testing.T) {
+	a := assert.New(t)
+	v := newTestState()
+
+	var b strings.Builder
+	tr := New(&b, nil)
+	tr.Attach(v)
+	a.NoError(cpu.Step(v))
+	a.NoError(cpu.Step(v))
+	a.NoError(tr.Err)
+	a.Equal("0000: 14001000  CALL 0x0010\n0010: 15000000  RET\n", b.String())
+}
+
+func TestTracerSymbols(t *testing.T) {
+	a := assert.New(t)
+	v := newTestState()
+
+	syms := symbols.New()
+	syms.AddLabel("main", 0x00)
+	syms.AddLabel("update", 0x0C)
+
+	var b strings.Builder
+	tr := New(&b, syms)
+	tr.Attach(v)
+	a.NoError(cpu.Step(v))
+	a.NoError(cpu.Step(v))
+	lines := strings.Split(b.String(), "\n")
+	a.Equal("main                     0000: 14001000  CALL update+0x4", lines[0])
+	a.Equal("update+0x4               0010: 15000000  RET", lines[1])
+}
+
+type brokenWriter struct{ n int }
+
+func (w *brokenWriter) Write(b []byte) (int, error) {
+	w.n++
+	return 0, errors.New("broken")
+}
+
+func TestTracerError(t *testing.T) {
+	a := assert.New(t)
+	v := newTestState()
+
+	w := &brokenWriter{}
+	tr := New(w, nil)
+	tr.Attach(v)
+	a.NoError(cpu.Step(v))
+	a.NoError(cpu.Step(v))
+	a.Error(tr.Err)
+	a.Equal(1, w.n, "nothing should be written after an error")
+}
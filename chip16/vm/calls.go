@@ -0,0 +1,96 @@
+package vm
+
+import "fmt"
+
+// Frame is an entry of the shadow call stack
+type Frame struct {
+	// Caller is the address of the call instruction
+	Caller Pointer
+
+	// Target is the address of the called function
+	Target Pointer
+
+	// SP is the stack pointer at entry, where the return address is stored
+	SP Pointer
+}
+
+// CallMismatchError is returned when a RET doesn't match the innermost call,
+// typically because the function pushed data it didn't pop.
+type CallMismatchError struct {
+	// Frame is the innermost call, or nil if there was none
+	Frame *Frame
+
+	// SP is the address the return address was popped from
+	SP Pointer
+
+	// Return is the address RET returned to
+	Return Pointer
+}
+
+func (e *CallMismatchError) Error() string {
+	if e.Frame == nil {
+		return fmt.Sprintf(
+			"mismatched RET: returning to %#04x from SP = %#04x outside of any call",
+			e.Return, e.SP,
+		)
+	}
+	return fmt.Sprintf(
+		"mismatched RET: returning to %#04x from SP = %#04x, but %#04x called %#04x with SP = %#04x",
+		e.Return, e.SP, e.Frame.Caller, e.Frame.Target, e.Frame.SP,
+	)
+}
+
+// EnterCall pushes a call onto the shadow call stack.
+//
+// Calls made at or below the stack address of an outstanding call are
+// dropped first, since their return addresses were overwritten.
+func (v *State) EnterCall(f Frame) {
+	v.dropCalls(f.SP)
+	v.Calls = append(v.Calls, f)
+}
+
+// LeaveCall pops the innermost call off the shadow call stack, when a RET
+// reads its return address ret at stack address sp.
+//
+// If the RET doesn't match the innermost call, a *CallMismatchError is
+// returned. With StrictCalls, the shadow call stack is left untouched, as the
+// RET fails; otherwise, calls are dropped until it is consistent with the
+// stack again.
+func (v *State) LeaveCall(sp, ret Pointer) error {
+	n := len(v.Calls)
+	if n > 0 {
+		f := v.Calls[n-1]
+		if f.SP == sp && f.Caller+4 == ret {
+			v.Calls = v.Calls[:n-1]
+			return nil
+		}
+	}
+
+	err := &CallMismatchError{SP: sp, Return: ret}
+	if n > 0 {
+		f := v.Calls[n-1]
+		err.Frame = &f
+	}
+	if !v.StrictCalls {
+		v.dropCalls(sp)
+	}
+	return err
+}
+
+// dropCalls pops the calls whose return address is stored at or above sp
+func (v *State) dropCalls(sp Pointer) {
+	n := len(v.Calls)
+	for n > 0 && v.Calls[n-1].SP >= sp {
+		n--
+	}
+	v.Calls = v.Calls[:n]
+}
+
+// Backtrace returns the outstanding calls, innermost first.
+func (v *State) Backtrace() []Frame {
+	frames := make([]Frame, len(v.Calls))
+	for i, f := range v.Calls {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalls(t *testing.T) {
+	a := assert.New(t)
+	v := NewState()
+
+	v.EnterCall(Frame{Caller: 0x0000, Target: 0x0100, SP: StackStart})
+	v.EnterCall(Frame{Caller: 0x0104, Target: 0x0200, SP: StackStart + 2})
+	a.Equal([]Frame{
+		{Caller: 0x0104, Target: 0x0200, SP: StackStart + 2},
+		{Caller: 0x0000, Target: 0x0100, SP: StackStart},
+	}, v.Backtrace())
+
+	a.NoError(v.LeaveCall(StackStart+2, 0x0108))
+	a.Len(v.Calls, 1)
+
+	// Calls made at the same stack address replace the previous ones
+	v.EnterCall(Frame{Caller: 0x0000, Target: 0x0300, SP: StackStart})
+	a.Equal([]Frame{{Caller: 0x0000, Target: 0x0300, SP: StackStart}}, v.Backtrace())
+}
+
+func TestCallMismatch(t *testing.T) {
+	a := assert.New(t)
+	v := NewState()
+
+	v.EnterCall(Frame{Caller: 0x0000, Target: 0x0100, SP: StackStart})
+	v.EnterCall(Frame{Caller: 0x0104, Target: 0x0200, SP: StackStart + 2})
+
+	// Data was pushed: the return address is read above the innermost call
+	err := v.LeaveCall(StackStart+4, 0x1234)
+	if a.IsType(&CallMismatchError{}, err) {
+		e := err.(*CallMismatchError)
+		a.Equal(Frame{Caller: 0x0104, Target: 0x0200, SP: StackStart + 2}, *e.Frame)
+		a.Equal(Pointer(StackStart+4), e.SP)
+		a.Equal(Pointer(0x1234), e.Return)
+	}
+	a.Len(v.Calls, 2, "calls below the mismatched RET should be kept")
+
+	// The return address was overwritten
+	v.StrictCalls = true
+	a.Error(v.LeaveCall(StackStart+2, 0x1234))
+	a.Len(v.Calls, 2, "failed strict RETs shouldn't drop calls")
+	v.StrictCalls = false
+	a.Error(v.LeaveCall(StackStart+2, 0x1234))
+	a.Len(v.Calls, 1)
+
+	a.NoError(v.LeaveCall(StackStart, 0x0004))
+	a.Empty(v.Calls)
+
+	err = v.LeaveCall(StackStart, 0x0004)
+	if a.IsType(&CallMismatchError{}, err) {
+		a.Nil(err.(*CallMismatchError).Frame)
+	}
+}
@@ -0,0 +1,31 @@
+package vm
+
+// Controller buttons, as bits of a controller register
+const (
+	ButtonUp     = 1 << 0
+	ButtonDown   = 1 << 1
+	ButtonLeft   = 1 << 2
+	ButtonRight  = 1 << 3
+	ButtonSelect = 1 << 4
+	ButtonStart  = 1 << 5
+	ButtonA      = 1 << 6
+	ButtonB      = 1 << 7
+)
+
+const (
+	// Controller1 is the address of the first controller's register
+	Controller1 = IOStart
+
+	// Controller2 is the address of the second controller's register
+	Controller2 = IOStart + 2
+)
+
+// SetController sets the pressed buttons of controller n (0 or 1).
+func (v *State) SetController(n int, buttons uint16) {
+	v.RAM.PutUint16(Pointer(Controller1+2*n), buttons)
+}
+
+// Controller returns the pressed buttons of controller n (0 or 1).
+func (v *State) Controller(n int) uint16 {
+	return v.RAM.Uint16(Pointer(Controller1 + 2*n))
+}
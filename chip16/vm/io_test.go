@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController(t *testing.T) {
+	a := assert.New(t)
+	v := NewState()
+
+	v.SetController(0, ButtonUp|ButtonA)
+	v.SetController(1, ButtonStart)
+	a.Equal(uint16(ButtonUp|ButtonA), v.Controller(0))
+	a.Equal(uint16(ButtonStart), v.Controller(1))
+
+	p, err := v.PointerAt(Controller2)
+	if a.NoError(err) {
+		a.Equal(Pointer(ButtonStart), p)
+	}
+	a.Equal(byte(ButtonUp|ButtonA), v.RAM.At(0xFFF0))
+}
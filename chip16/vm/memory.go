@@ -0,0 +1,151 @@
+package vm
+
+import "sync/atomic"
+
+const (
+	// PageSize is the size of a memory page, the unit of copy-on-write
+	PageSize = 256
+
+	numPages = MemSize / PageSize
+)
+
+type page [PageSize]byte
+
+// zeroPage backs the pages of cleared memory. It is always shared, hence
+// never written.
+var zeroPage = new(page)
+
+// Memory is the console's address space.
+//
+// Memory is split into pages, which are shared copy-on-write between clones
+// (see Clone): only the pages being written get copied. Its contents can
+// only be accessed through its methods.
+type Memory struct {
+	pages [numPages]*page
+
+	// A memory only writes in place the pages it copied since it was last
+	// cloned: owned[i] is the value of *epoch when page i was copied.
+	// Clones bump the epoch atomically, so that cloning doesn't race with
+	// other clones.
+	owned [numPages]uint64
+	epoch *uint64
+
+	view []byte // buffer of View
+}
+
+// Reset clears the memory.
+func (m *Memory) Reset() {
+	if m.epoch == nil {
+		m.epoch = new(uint64)
+		*m.epoch = 1
+	}
+	for i := range m.pages {
+		m.pages[i], m.owned[i] = zeroPage, 0
+	}
+}
+
+// Clone returns a copy of the memory, sharing its pages. It may be called
+// from several goroutines at once, as long as the memory isn't written
+// meanwhile.
+func (m *Memory) Clone() Memory {
+	atomic.AddUint64(m.epoch, 1)
+	c := Memory{pages: m.pages, epoch: new(uint64)}
+	*c.epoch = 1
+	return c
+}
+
+// shared tells whether page i may be shared with a clone
+func (m *Memory) shared(i int) bool {
+	return m.owned[i] != atomic.LoadUint64(m.epoch)
+}
+
+// writable returns page i, after copying it if it is shared
+func (m *Memory) writable(i int) *page {
+	if m.shared(i) {
+		p := *m.pages[i]
+		m.pages[i], m.owned[i] = &p, atomic.LoadUint64(m.epoch)
+	}
+	return m.pages[i]
+}
+
+// At returns the byte at addr.
+func (m *Memory) At(addr Pointer) byte {
+	return m.pages[addr/PageSize][addr%PageSize]
+}
+
+// Set writes the byte at addr. The page isn't copied if it already holds
+// the byte.
+func (m *Memory) Set(addr Pointer, b byte) {
+	if m.At(addr) != b {
+		m.writable(int(addr / PageSize))[addr%PageSize] = b
+	}
+}
+
+// Uint16 returns the little-endian word at addr. The address after 0xFFFF
+// is 0x0000.
+func (m *Memory) Uint16(addr Pointer) uint16 {
+	return uint16(m.At(addr)) | uint16(m.At(addr+1))<<8
+}
+
+// PutUint16 writes the little-endian word at addr.
+func (m *Memory) PutUint16(addr Pointer, x uint16) {
+	m.Set(addr, byte(x))
+	m.Set(addr+1, byte(x>>8))
+}
+
+// Read copies the bytes from addr into dst, up to the end of memory, and
+// returns the number of bytes copied.
+func (m *Memory) Read(addr Pointer, dst []byte) int {
+	n := 0
+	for a := int(addr); n < len(dst) && a < MemSize; {
+		c := copy(dst[n:], m.pages[a/PageSize][a%PageSize:])
+		n += c
+		a += c
+	}
+	return n
+}
+
+// Write copies src to addr, up to the end of memory, and returns the number
+// of bytes copied. Pages that already hold the bytes aren't copied.
+func (m *Memory) Write(addr Pointer, src []byte) int {
+	n := 0
+	for a := int(addr); n < len(src) && a < MemSize; {
+		i, off := a/PageSize, a%PageSize
+		end := n + PageSize - off
+		if end > len(src) {
+			end = len(src)
+		}
+		if string(m.pages[i][off:off+end-n]) != string(src[n:end]) {
+			copy(m.writable(i)[off:], src[n:end])
+		}
+		a += end - n
+		n = end
+	}
+	return n
+}
+
+// View returns the n bytes at addr, or fewer at the end of memory, without
+// copying them when possible. The returned slice must not be modified, and
+// is only valid until the next write to the memory or call to View.
+func (m *Memory) View(addr Pointer, n int) []byte {
+	if left := MemSize - int(addr); n > left {
+		n = left
+	}
+	off := int(addr % PageSize)
+	if off+n <= PageSize {
+		return m.pages[addr/PageSize][off : off+n]
+	}
+	if cap(m.view) < n {
+		m.view = make([]byte, n)
+	}
+	m.view = m.view[:n]
+	m.Read(addr, m.view)
+	return m.view
+}
+
+// Bytes returns a copy of the whole memory.
+func (m *Memory) Bytes() []byte {
+	b := make([]byte, MemSize)
+	m.Read(0, b)
+	return b
+}
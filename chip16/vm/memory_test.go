@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	a := assert.New(t)
+	var m Memory
+	m.Reset()
+
+	m.Set(0x1234, 0x42)
+	a.Equal(byte(0x42), m.At(0x1234))
+	a.Equal(byte(0), m.At(0x1233))
+	a.Equal(byte(0), zeroPage[0x34], "the zero page should never be written")
+
+	m.PutUint16(0xFFFF, 0xBEEF)
+	a.Equal(byte(0xEF), m.At(0xFFFF))
+	a.Equal(byte(0xBE), m.At(0x0000), "words should wrap around")
+	a.Equal(uint16(0xBEEF), m.Uint16(0xFFFF))
+
+	// Reads and writes crossing pages stop at the end of memory
+	a.Equal(4, m.Write(PageSize-2, []byte{1, 2, 3, 4}))
+	a.Equal([]byte{1, 2, 3, 4}, m.View(PageSize-2, 4))
+	a.Equal(2, m.Write(MemSize-2, []byte{5, 6, 7}))
+	a.Equal([]byte{5, 6}, m.View(MemSize-2, 4))
+	buf := make([]byte, 4)
+	a.Equal(1, m.Read(MemSize-1, buf))
+	a.Equal(byte(6), buf[0])
+
+	m.Reset()
+	a.Equal(make([]byte, MemSize), m.Bytes())
+}
+
+func TestMemoryClone(t *testing.T) {
+	a := assert.New(t)
+	var m Memory
+	m.Reset()
+	m.Set(0x100, 1)
+	m.Set(0x200, 2)
+
+	c := m.Clone()
+	a.Equal(m.Bytes(), c.Bytes())
+
+	// Only the written pages get copied
+	c.Set(0x100, 3)
+	a.False(c.shared(1))
+	a.True(c.shared(2))
+	a.Equal(byte(1), m.At(0x100))
+	a.Equal(byte(3), c.At(0x100))
+	a.Equal(byte(2), c.At(0x200))
+
+	// Writing the same bytes doesn't copy anything
+	c.Set(0x200, 2)
+	a.Equal(2, c.Write(0x1FF, []byte{0, 2}))
+	a.True(c.shared(2))
+	a.True(m.shared(2))
+
+	// The original copies the pages it writes too
+	m.Set(0x101, 4)
+	a.False(m.shared(1))
+	a.Equal(byte(0), c.At(0x101))
+}
+
+func TestMemoryConcurrentClones(t *testing.T) {
+	a := assert.New(t)
+	var m Memory
+	m.Reset()
+	m.Set(0x100, 1)
+
+	var wg sync.WaitGroup
+	clones := make([]Memory, 8)
+	for i := range clones {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clones[i] = m.Clone()
+			clones[i].Set(0x100, byte(i+2))
+		}(i)
+	}
+	wg.Wait()
+
+	m.Set(0x100, 42)
+	for i := range clones {
+		a.Equal(byte(i+2), clones[i].At(0x100))
+	}
+	a.Equal(byte(42), m.At(0x100))
+}
+
+func BenchmarkMemoryView(b *testing.B) {
+	var m Memory
+	m.Reset()
+	for n := 0; n < b.N; n++ {
+		m.View(PageSize-2, 4)
+	}
+}
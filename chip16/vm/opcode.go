@@ -5,8 +5,8 @@ import "encoding/binary"
 // Opcode is our internal representation of an opcode.
 type Opcode uint32
 
-// Reads an Opcode from a byte slice
-func readOpcode(s []byte) Opcode {
+// ReadOpcode reads an Opcode from a byte slice
+func ReadOpcode(s []byte) Opcode {
 	return Opcode(binary.BigEndian.Uint32(s))
 }
 
@@ -11,7 +11,7 @@ var o Opcode = 0x12345678
 func TestOpcodeRead(t *testing.T) {
 	a := assert.New(t)
 	s := []byte{0x12, 0x34, 0x56, 0x78}
-	a.Equal(o, readOpcode(s))
+	a.Equal(o, ReadOpcode(s))
 }
 
 func TestOpcodeMethods(t *testing.T) {
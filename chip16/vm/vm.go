@@ -1,9 +1,9 @@
 package vm
 
 import (
-	"encoding/binary"
 	"fmt"
 
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
 	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
 )
 
@@ -35,8 +35,8 @@ type State struct {
 	// SP is the Stack Pointer
 	SP Pointer
 
-	// RAM is a byte slice depicting the console's RAM
-	RAM []byte
+	// RAM is the console's memory.
+	RAM Memory
 
 	// Regs is an array of 16 CPU Registers
 	Regs [16]int16
@@ -46,16 +46,99 @@ type State struct {
 
 	// Graphics is the chip16's GPU state
 	Graphics *graphics.State
+
+	// Audio is the chip16's sound generator state
+	Audio *audio.State
+
+	// Cycles is the number of CPU cycles elapsed since power-on.
+	Cycles uint64
+
+	// Timing returns the number of cycles taken by an executed instruction.
+	// If nil, every instruction takes one cycle, as per spec. Instructions
+	// take at least one cycle, whatever it returns.
+	Timing func(v *State, o Opcode) uint64
+
+	// Hook, if not nil, is called after each instruction successfully
+	// executed by the CPU, e.g. to profile or trace a program. Clones don't
+	// inherit it.
+	Hook func(v *State, e Executed)
+
+	// WaitVBlank is set by VBLNK: the CPU is halted until the next frame.
+	WaitVBlank bool
+
+	// Calls is the shadow call stack, outermost call first. It is
+	// maintained by the call and return instructions, regardless of the
+	// data pushed onto the stack.
+	Calls []Frame
+
+	// StrictCalls makes RET fail when it doesn't match the innermost call.
+	StrictCalls bool
+}
+
+// Executed describes an instruction executed by the CPU.
+type Executed struct {
+	// PC is the address of the instruction.
+	PC Pointer
+
+	// SP is the stack pointer before the instruction.
+	SP Pointer
+
+	// Op is the instruction.
+	Op Opcode
+
+	// Cycles is the number of cycles it took.
+	Cycles uint64
 }
 
 // NewState creates a new State
 func NewState() *State {
-	return &State{
+	v := &State{
 		PC:       RAMStart,
 		SP:       StackStart,
-		RAM:      make([]byte, MemSize),
 		Graphics: graphics.NewState(),
+		Audio:    audio.NewState(),
 	}
+	v.RAM.Reset()
+	return v
+}
+
+// Reset restores the power-on state: cleared memory, registers and flags,
+// PC at RAMStart, SP at StackStart, a clear screen and no sound.
+func (v *State) Reset() {
+	v.RAM.Reset()
+	v.SoftReset()
+}
+
+// SoftReset works like Reset, but leaves the memory untouched, for programs
+// that keep data across resets.
+func (v *State) SoftReset() {
+	v.PC = RAMStart
+	v.SP = StackStart
+	v.Regs = [16]int16{}
+	v.Flags.Clear()
+	v.Cycles = 0
+	v.WaitVBlank = false
+	v.Calls = nil
+	v.Graphics.Reset()
+	v.Audio.Reset()
+}
+
+// Clone returns an independent copy of the state.
+//
+// RAM and the foreground are shared copy-on-write, by pages of PageSize
+// bytes and by rows of pixels: each state only copies the pages it writes,
+// so that clones that don't run (snapshots, rewind buffers) cost next to
+// nothing, and running ones little more. Clone may be called from several
+// goroutines at once, as long as the state isn't modified meanwhile.
+func (v *State) Clone() *State {
+	c := *v
+	c.RAM = v.RAM.Clone()
+	c.Hook = nil
+	c.Calls = append([]Frame(nil), v.Calls...)
+	c.Graphics = v.Graphics.Clone()
+	a := *v.Audio
+	c.Audio = &a
+	return &c
 }
 
 // Int16At reads a signed int16 at given address in RAM
@@ -63,7 +146,7 @@ func (v *State) Int16At(addr Pointer) (int16, error) {
 	if addr > PointerMax {
 		return 0, fmt.Errorf("address out of bounds")
 	}
-	return int16(binary.LittleEndian.Uint16(v.RAM[addr:])), nil
+	return int16(v.RAM.Uint16(addr)), nil
 }
 
 // PutInt16At writes a signed int16 at given address in RAM
@@ -71,7 +154,7 @@ func (v *State) PutInt16At(val int16, addr Pointer) error {
 	if addr > PointerMax {
 		return fmt.Errorf("address out of bounds")
 	}
-	binary.LittleEndian.PutUint16(v.RAM[addr:], uint16(val))
+	v.RAM.PutUint16(addr, uint16(val))
 	return nil
 }
 
@@ -80,7 +163,7 @@ func (v *State) PointerAt(addr Pointer) (Pointer, error) {
 	if addr > PointerMax {
 		return 0, fmt.Errorf("address out of bounds")
 	}
-	return Pointer(binary.LittleEndian.Uint16(v.RAM[addr:])), nil
+	return Pointer(v.RAM.Uint16(addr)), nil
 }
 
 // PutPointerAt writes a pointer at given address in RAM
@@ -88,7 +171,7 @@ func (v *State) PutPointerAt(val Pointer, addr Pointer) error {
 	if addr > PointerMax {
 		return fmt.Errorf("address out of bounds")
 	}
-	binary.LittleEndian.PutUint16(v.RAM[addr:], uint16(val))
+	v.RAM.PutUint16(addr, uint16(val))
 	return nil
 }
 
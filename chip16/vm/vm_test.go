@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReset(t *testing.T) {
+	a := assert.New(t)
+
+	dirty := func() *State {
+		v := NewState()
+		v.PC, v.SP = 0x1234, StackStart+8
+		v.RAM.Set(0x100, 0x42)
+		v.Regs[3] = 7
+		v.Flags.SetCarry(true)
+		v.Cycles = 1000
+		v.WaitVBlank = true
+		v.EnterCall(Frame{Caller: 0, Target: 0x10, SP: StackStart})
+		v.Graphics.BG = 3
+		v.Audio.Tone(500, 100)
+		return v
+	}
+	check := func(v *State) {
+		a.Equal(Pointer(RAMStart), v.PC)
+		a.Equal(Pointer(StackStart), v.SP)
+		a.Equal([16]int16{}, v.Regs)
+		a.Equal(CPUFlags(0), v.Flags)
+		a.Equal(uint64(0), v.Cycles)
+		a.False(v.WaitVBlank)
+		a.Empty(v.Calls)
+		a.Equal(uint8(0), v.Graphics.BG)
+		a.False(v.Audio.Playing())
+	}
+
+	v := dirty()
+	v.Reset()
+	check(v)
+	a.Equal(make([]byte, MemSize), v.RAM.Bytes())
+
+	v = dirty()
+	v.SoftReset()
+	check(v)
+	a.Equal(byte(0x42), v.RAM.At(0x100), "RAM should be kept")
+}
+
+func TestClone(t *testing.T) {
+	a := assert.New(t)
+	v := NewState()
+	v.RAM.Set(0x100, 1)
+	v.Graphics.SetPixel(0, 0, 1)
+	v.EnterCall(Frame{Caller: 0, Target: 0x10, SP: StackStart})
+	v.Audio.Tone(500, 100)
+
+	c := v.Clone()
+	a.Equal(v.RAM.Bytes(), c.RAM.Bytes())
+	a.Equal(v.Calls, c.Calls)
+	a.True(c.Audio.Playing())
+	a.True(&v.RAM.View(0x100, 1)[0] == &c.RAM.View(0x100, 1)[0], "RAM should be shared until written")
+	a.True(&v.Graphics.Row(0)[0] == &c.Graphics.Row(0)[0], "FG should be shared until written")
+
+	// Writes through methods are isolated, both ways
+	a.NoError(c.PutInt16At(0x1234, 0x200))
+	a.NoError(v.PutPointerAt(0x4321, 0x300))
+	c.SetController(0, ButtonA)
+	c.RAM.Set(0x100, 2)
+	a.Equal(byte(1), v.RAM.At(0x100))
+	a.Equal(byte(2), c.RAM.At(0x100))
+	x, _ := v.Int16At(0x200)
+	a.Equal(int16(0), x)
+	p, _ := c.PointerAt(0x300)
+	a.Equal(Pointer(0), p)
+	a.Equal(uint16(0), v.Controller(0))
+
+	// So are graphics, sound and calls
+	c.Graphics.SetPixel(0, 0, 2)
+	c.Graphics.Palette[1].R = 0x42
+	c.Audio.Stop()
+	c.Calls[0].Target = 0x20
+	a.Equal(uint8(1), v.Graphics.Pixel(0, 0))
+	a.Equal(uint8(0), v.Graphics.Palette[1].R)
+	a.True(v.Audio.Playing())
+	a.Equal(Pointer(0x10), v.Calls[0].Target)
+
+	// Resets don't touch clones
+	s := v.Clone()
+	s.Reset()
+	a.Equal(byte(1), v.RAM.At(0x100))
+	a.Equal(uint8(1), v.Graphics.Pixel(0, 0))
+	a.Equal(byte(0), s.RAM.At(0x100))
+}
+
+func BenchmarkClone(b *testing.B) {
+	v := NewState()
+	for n := 0; n < b.N; n++ {
+		v.Clone()
+	}
+}
+
+func BenchmarkCloneWrite(b *testing.B) {
+	v := NewState()
+	for n := 0; n < b.N; n++ {
+		c := v.Clone()
+		c.PutInt16At(1, 1)
+		c.Graphics.SetPixel(0, 0, 1)
+	}
+}
@@ -0,0 +1,164 @@
+// Package web is the platform independent part of the browser frontend: it
+// runs the machine, and converts its frames, sound and input to and from the
+// formats of the web APIs. The syscall/js side lives in cmd/chip16-web.
+//
+// Being platform independent, it can be tested natively, or under Node with
+// the wasm runner shipped with Go:
+//
+//		GOOS=js GOARCH=wasm go test -exec "$(go env GOROOT)/lib/wasm/go_js_wasm_exec" ./chip16/web
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+// Keymap maps KeyboardEvent codes to controller buttons.
+type Keymap map[string]uint16
+
+// DefaultKeymap maps the arrow keys to the directional pad, Enter to Start,
+// Shift to Select, and Z and X to A and B.
+var DefaultKeymap = Keymap{
+	"ArrowUp":    vm.ButtonUp,
+	"ArrowDown":  vm.ButtonDown,
+	"ArrowLeft":  vm.ButtonLeft,
+	"ArrowRight": vm.ButtonRight,
+	"Enter":      vm.ButtonStart,
+	"ShiftLeft":  vm.ButtonSelect,
+	"ShiftRight": vm.ButtonSelect,
+	"KeyZ":       vm.ButtonA,
+	"KeyX":       vm.ButtonB,
+}
+
+// Keys tracks the keys held on the keyboard. It is safe for concurrent use.
+type Keys struct {
+	Keymap Keymap
+
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+// NewKeys creates a Keys with the default keymap.
+func NewKeys() *Keys {
+	return &Keys{Keymap: DefaultKeymap, held: make(map[string]bool)}
+}
+
+// Down handles a keydown event. It tells whether the key is mapped, in which
+// case the event's default action should be prevented.
+func (k *Keys) Down(code string) bool {
+	return k.set(code, true)
+}
+
+// Up handles a keyup event. It tells whether the key is mapped.
+func (k *Keys) Up(code string) bool {
+	return k.set(code, false)
+}
+
+func (k *Keys) set(code string, held bool) bool {
+	if _, ok := k.Keymap[code]; !ok {
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if held {
+		k.held[code] = true
+	} else {
+		delete(k.held, code)
+	}
+	return true
+}
+
+// Release releases all keys, e.g. when the page loses focus.
+func (k *Keys) Release() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.held = make(map[string]bool)
+}
+
+// Buttons returns the controller buttons held.
+func (k *Keys) Buttons() uint16 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var buttons uint16
+	for code := range k.held {
+		buttons |= k.Keymap[code]
+	}
+	return buttons
+}
+
+// Float32LE converts samples to the little-endian bytes of a Float32Array
+// between -1 and 1, as the Web Audio API expects. dst must hold 4 bytes per
+// sample.
+func Float32LE(dst []byte, samples []int16) {
+	for i, s := range samples {
+		f := float32(s) / -math.MinInt16
+		binary.LittleEndian.PutUint32(dst[4*i:], math.Float32bits(f))
+	}
+}
+
+// Latency is the sound latency
+const Latency = 100 * time.Millisecond
+
+// Emulator runs a ROM for the browser.
+type Emulator struct {
+	Machine *chip16.Machine
+	Keys    *Keys
+
+	sound *audio.Pipeline
+	out   []int16
+}
+
+// NewEmulator loads a ROM image in a new machine. Sound is played at
+// sampleRate samples per second.
+func NewEmulator(image []byte, sampleRate int) (*Emulator, error) {
+	m, err := chip16.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.LoadROM(bytes.NewReader(image)); err != nil {
+		return nil, err
+	}
+	return &Emulator{
+		Machine: m,
+		Keys:    NewKeys(),
+		sound:   audio.NewPipeline(sampleRate, Latency),
+	}, nil
+}
+
+// Frame runs a frame with the held keys, and queues its sound.
+func (e *Emulator) Frame() error {
+	e.Machine.SetInput(0, e.Keys.Buttons())
+	if err := e.Machine.RunFrame(); err != nil {
+		return err
+	}
+	e.sound.Push(e.Machine.AudioSamples())
+	return nil
+}
+
+// Pixels renders the screen, and returns its RGBA pixels, as ImageData
+// expects them.
+func (e *Emulator) Pixels() ([]byte, error) {
+	img, err := e.Machine.Framebuffer()
+	if err != nil {
+		return nil, err
+	}
+	return img.Pix, nil
+}
+
+// Sound fills dst with n samples for an audio callback, as the bytes of a
+// Float32Array. It is silent when no sound is queued.
+func (e *Emulator) Sound(dst []byte, n int) {
+	if cap(e.out) < n {
+		e.out = make([]int16, n)
+	}
+	e.out = e.out[:n]
+	e.sound.Read(e.out)
+	Float32LE(dst, e.out)
+}
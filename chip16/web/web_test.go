@@ -0,0 +1,78 @@
+package web
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	a := assert.New(t)
+	k := NewKeys()
+
+	a.True(k.Down("ArrowUp"))
+	a.True(k.Down("KeyZ"))
+	a.True(k.Down("ShiftLeft"))
+	a.True(k.Down("ShiftRight"))
+	a.False(k.Down("KeyQ"))
+	a.Equal(uint16(vm.ButtonUp|vm.ButtonA|vm.ButtonSelect), k.Buttons())
+
+	// Select stays held as long as one of its keys is
+	a.True(k.Up("ShiftLeft"))
+	a.True(k.Up("KeyZ"))
+	a.Equal(uint16(vm.ButtonUp|vm.ButtonSelect), k.Buttons())
+
+	k.Release()
+	a.Equal(uint16(0), k.Buttons())
+}
+
+func TestFloat32LE(t *testing.T) {
+	a := assert.New(t)
+	dst := make([]byte, 12)
+	Float32LE(dst, []int16{0, math.MinInt16, 0x4000})
+
+	var f []float32
+	for i := 0; i < len(dst); i += 4 {
+		f = append(f, math.Float32frombits(binary.LittleEndian.Uint32(dst[i:])))
+	}
+	a.Equal([]float32{0, -1, 0.5}, f)
+}
+
+func TestEmulator(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := NewEmulator([]byte("CH16"), 48000)
+	a.Error(err, "invalid ROM")
+
+	prog := []byte{
+		0x03, 0x00, 0x03, 0x00, // BGC 3
+		0x22, 0x00, 0xF0, 0xFF, // LDM R0, 0xFFF0
+		0x02, 0x00, 0x00, 0x00, // VBLNK
+		0x10, 0x00, 0x00, 0x00, // JMP 0
+	}
+	e, err := NewEmulator(prog, 48000)
+	if !a.NoError(err) {
+		return
+	}
+
+	e.Keys.Down("ArrowLeft")
+	if !a.NoError(e.Frame()) {
+		return
+	}
+	a.Equal(uint16(vm.ButtonLeft), e.Machine.State().Controller(0))
+	a.Equal(int16(vm.ButtonLeft), e.Machine.State().Regs[0], "the ROM should read the controller")
+
+	pix, err := e.Pixels()
+	if a.NoError(err) {
+		a.Len(pix, 4*graphics.ScreenW*graphics.ScreenH)
+		a.Equal([]byte{0xBF, 0x39, 0x32, 0xFF}, pix[:4])
+	}
+
+	dst := make([]byte, 4*128)
+	e.Sound(dst, 128)
+	a.Equal(make([]byte, 4*128), dst, "the ROM is silent")
+}
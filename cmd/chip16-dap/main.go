@@ -0,0 +1,49 @@
+// Command chip16-dap is a Debug Adapter Protocol server for chip16 ROMs.
+//
+// Usage:
+//
+//		chip16-dap [-strict-calls] [-listen addr]
+//
+// By default, the adapter talks over its standard input and output, as
+// editors expect. The ROM and its symbol file are given by the "program" and
+// "symbols" attributes of the launch request.
+//
+// With -strict-calls, execution stops on RET instructions that don't match
+// the innermost call, e.g. because the function left data on the stack.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/dap"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+func main() {
+	listen := flag.String("listen", "", "TCP address to listen on, instead of standard input/output")
+	strict := flag.Bool("strict-calls", false, "stop on RET instructions that don't match the innermost call")
+	flag.Parse()
+
+	v := vm.NewState()
+	v.StrictCalls = *strict
+	d := debugger.New(v)
+
+	var err error
+	if *listen != "" {
+		log.Printf("listening on %s", *listen)
+		err = dap.ListenAndServe(*listen, d, nil)
+	} else {
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}
+		err = dap.Serve(rw, d, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
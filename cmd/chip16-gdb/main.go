@@ -0,0 +1,69 @@
+// Command chip16-gdb runs a chip16 ROM under a GDB remote serial protocol stub.
+//
+// Usage:
+//
+//		chip16-gdb [-strict-calls] [-listen addr] rom.c16
+//		chip16-gdb [-strict-calls] -stdio rom.c16
+//
+// With -stdio, the stub talks over its standard input and output, so that GDB
+// can spawn it with "target remote | chip16-gdb -stdio rom.c16".
+//
+// With -strict-calls, execution stops on RET instructions that don't match
+// the innermost call, e.g. because the function left data on the stack.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/debugger"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/gdbstub"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/rom"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:1234", "TCP address to listen on")
+	stdio := flag.Bool("stdio", false, "serve over standard input/output")
+	strict := flag.Bool("strict-calls", false, "stop on RET instructions that don't match the innermost call")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: chip16-gdb [-strict-calls] [-listen addr | -stdio] rom.c16")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := rom.Read(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	v := vm.NewState()
+	v.StrictCalls = *strict
+	if err := r.Load(v); err != nil {
+		log.Fatal(err)
+	}
+	d := debugger.New(v)
+
+	if *stdio {
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}
+		err = gdbstub.Serve(rw, d)
+	} else {
+		log.Printf("listening on %s", *listen)
+		err = gdbstub.ListenAndServe(*listen, d)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+// Command chip16-headless runs a chip16 ROM without any display, for a given
+// number of frames.
+//
+// Usage:
+//
+//		chip16-headless [-frames n] [-record file] [-wav file] [-screenshot file.png] [-cheats file] rom.c16
+//
+// With -record, every frame is recorded to an animated GIF (.gif) or a raw
+// YUV4MPEG2 stream (.y4m). With -wav, the sound is recorded to a WAV file,
+// in lockstep with the frames. With -screenshot, the last frame is saved as
+// a PNG image.
+//
+// Cheats are loaded from the -cheats file, or from the ROM's .cht file (e.g.
+// game.cht for game.c16) if there is one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/audio"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/capture"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cheat"
+)
+
+func newRecorder(f *os.File) (capture.Recorder, error) {
+	switch strings.ToLower(filepath.Ext(f.Name())) {
+	case ".gif":
+		return capture.NewGIF(f), nil
+	case ".y4m":
+		return capture.NewY4M(f), nil
+	}
+	return nil, fmt.Errorf("%s: unknown recording format", f.Name())
+}
+
+func screenshot(path string, m *chip16.Machine) error {
+	img, err := m.Framebuffer()
+	if err != nil {
+		return err
+	}
+	return capture.WritePNG(path, img)
+}
+
+func main() {
+	frames := flag.Int("frames", 600, "number of frames to run")
+	record := flag.String("record", "", "record frames to this file (.gif or .y4m)")
+	wav := flag.String("wav", "", "record sound to this WAV file")
+	shot := flag.String("screenshot", "", "save the last frame to this PNG file")
+	cheats := flag.String("cheats", "", "load cheats from this file (default: the ROM's .cht file, if any)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: chip16-headless [-frames n] [-record file] [-wav file] [-screenshot file.png] [-cheats file] rom.c16")
+		os.Exit(2)
+	}
+
+	m, err := chip16.LoadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := cheat.LoadFor(flag.Arg(0), *cheats)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.SetCheats(l)
+
+	var rec capture.Recorder
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if rec, err = newRecorder(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var sound *audio.WAVWriter
+	if *wav != "" {
+		f, err := os.Create(*wav)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if sound, err = audio.NewWAVWriter(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for n := 0; n < *frames; n++ {
+		if err = m.RunFrame(); err != nil {
+			err = fmt.Errorf("frame %d: %s", n, err)
+			break
+		}
+		if rec != nil {
+			if err = rec.Capture(m.State().Graphics); err != nil {
+				break
+			}
+		}
+		if sound != nil {
+			if err = sound.Write(m.AudioSamples()); err != nil {
+				break
+			}
+		}
+	}
+	// Keep what was recorded, even if the ROM failed
+	if rec != nil {
+		if cerr := rec.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if sound != nil {
+		if cerr := sound.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if *shot != "" {
+		if serr := screenshot(*shot, m); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+// Command chip16-img2spr converts PNG and GIF images to chip16 sprite data.
+//
+// Usage:
+//
+//		chip16-img2spr [-palette file | -emit-palette file] [-bin] [-label name] [-o output] image
+//
+// Images are quantised to the default palette, or to the one read from
+// -palette. With -emit-palette, a palette suited to the image is built and
+// written to the given file instead (its format is guessed from the
+// extension, see chip16-pal).
+//
+// The sprite is written as assembler source by default, with -bin as raw
+// data. Transparent pixels map to color 0.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/palette"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/sprite"
+)
+
+func readPalette(path string) ([]color.RGBA, error) {
+	f, err := palette.FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	pal, err := palette.Read(r, f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return pal, nil
+}
+
+func writePalette(path string, pal []color.RGBA) error {
+	f, err := palette.FormatOf(path)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := palette.Write(w, pal, f); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func main() {
+	palFile := flag.String("palette", "", "palette to quantise to")
+	emitPal := flag.String("emit-palette", "", "build a palette for the image, and write it to this file")
+	bin := flag.Bool("bin", false, "write raw sprite data instead of assembler source")
+	label := flag.String("label", "", "assembler label (default: image name)")
+	out := flag.String("o", "-", "output file")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *palFile != "" && *emitPal != "" {
+		fmt.Fprintln(os.Stderr, "usage: chip16-img2spr [-palette file | -emit-palette file] [-bin] [-label name] [-o output] image")
+		os.Exit(2)
+	}
+	in := flag.Arg(0)
+
+	f, err := os.Open(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %s", in, err)
+	}
+
+	pal := graphics.DefaultPalette()
+	switch {
+	case *palFile != "":
+		if pal, err = readPalette(*palFile); err != nil {
+			log.Fatal(err)
+		}
+	case *emitPal != "":
+		pal = sprite.Palette(img)
+		if err := writePalette(*emitPal, pal); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s, err := sprite.FromImage(img, pal)
+	if err != nil {
+		log.Fatalf("%s: %s", in, err)
+	}
+
+	var w io.WriteCloser = os.Stdout
+	if *out != "-" {
+		if w, err = os.Create(*out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *bin {
+		_, err = w.Write(s.Data)
+	} else {
+		if *label == "" {
+			*label = strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+		}
+		err = s.WriteAsm(w, *label)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
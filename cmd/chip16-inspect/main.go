@@ -0,0 +1,139 @@
+// Command chip16-inspect runs a chip16 ROM without any display, then dumps
+// the state of its GPU.
+//
+// Usage:
+//
+//		chip16-inspect [-frames n] [-state file] [-palette file.png] [-screen file.png] [-layers all|bg|fg]
+//			[-sprites file.png -addr addr [-count n] [-cols n] [-spr hhll]] [-scale n] rom.c16
+//
+// The ROM runs for -frames frames, from power-on or from the save state read
+// from -state. The background color, sprite settings and palette are then
+// printed, and images exported as PNG files:
+//
+//   - with -palette, the palette as swatches, the background color being
+//     framed;
+//   - with -screen, the screen, restricted to the given -layers;
+//   - with -sprites, -count consecutive sprites read from -addr, in rows of
+//     -cols, with the current sprite dimensions (or those given by -spr, as
+//     the SPR instruction's argument) and flips.
+//
+// Images are scaled up by -scale.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/capture"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/inspect"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/vm"
+)
+
+func loadState(m *chip16.Machine, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.LoadState(f); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+func parseLayers(s string) (graphics.Layer, error) {
+	switch s {
+	case "all":
+		return graphics.LayerAll, nil
+	case "bg":
+		return graphics.LayerBG, nil
+	case "fg":
+		return graphics.LayerFG, nil
+	}
+	return 0, fmt.Errorf("unknown layers %q", s)
+}
+
+func main() {
+	frames := flag.Int("frames", 60, "number of frames to run")
+	state := flag.String("state", "", "start from this save state")
+	pal := flag.String("palette", "", "save the palette to this PNG file")
+	screen := flag.String("screen", "", "save the screen to this PNG file")
+	layers := flag.String("layers", "all", "screen layers to save (all, bg or fg)")
+	sprites := flag.String("sprites", "", "save sprites to this PNG file")
+	addr := flag.String("addr", "", "address of the sprites")
+	count := flag.Int("count", 1, "number of sprites")
+	cols := flag.Int("cols", 8, "number of sprites per row")
+	spr := flag.String("spr", "", "sprite dimensions, as the SPR instruction's argument (default: current)")
+	scale := flag.Int("scale", 4, "scaling factor of images")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *sprites != "" && *addr == "" {
+		fmt.Fprintln(os.Stderr, "usage: chip16-inspect [-frames n] [-state file] [-palette file.png] [-screen file.png] [-layers all|bg|fg]")
+		fmt.Fprintln(os.Stderr, "                      [-sprites file.png -addr addr [-count n] [-cols n] [-spr hhll]] [-scale n] rom.c16")
+		os.Exit(2)
+	}
+	l, err := parseLayers(*layers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := chip16.LoadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *state != "" {
+		if err := loadState(m, *state); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for n := 0; n < *frames; n++ {
+		if err := m.RunFrame(); err != nil {
+			log.Fatalf("frame %d: %s", n, err)
+		}
+	}
+
+	v := m.State()
+	g := v.Graphics
+	fmt.Println(inspect.Summary(g))
+	fmt.Print(inspect.PaletteText(g))
+
+	if *pal != "" {
+		if err := capture.WritePNG(*pal, inspect.Palette(g, 4*(*scale))); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *screen != "" {
+		img, err := inspect.Layers(g, l, *scale)
+		if err == nil {
+			err = capture.WritePNG(*screen, img)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *sprites != "" {
+		a, err := strconv.ParseUint(*addr, 0, 16)
+		if err != nil {
+			log.Fatalf("bad address %q", *addr)
+		}
+		if *spr != "" {
+			hhll, err := strconv.ParseUint(*spr, 0, 16)
+			if err != nil {
+				log.Fatalf("bad sprite dimensions %q", *spr)
+			}
+			g.SpriteW, g.SpriteH = uint8(hhll), uint8(hhll>>8)
+		}
+		img, err := inspect.Sheet(g, v.RAM.Bytes(), vm.Pointer(a), *count, *cols, *scale)
+		if err == nil {
+			err = capture.WritePNG(*sprites, img)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
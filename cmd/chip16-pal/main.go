@@ -0,0 +1,73 @@
+// Command chip16-pal converts palettes between file formats, and to the
+// layout expected by the chip16 PAL instructions.
+//
+// Usage:
+//
+//		chip16-pal [-from format] [-to format] input output
+//
+// Formats are chip16 (48-byte PAL data), gpl (GIMP), jasc (Paint Shop Pro
+// .pal), act (Adobe Color Table) and hex. By default, they are guessed from
+// the file extensions (.bin for chip16 data). An output of "-" is standard
+// output, in which case -to is required.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/palette"
+)
+
+func format(name, path string) (palette.Format, error) {
+	if name != "" {
+		return palette.ParseFormat(name)
+	}
+	return palette.FormatOf(path)
+}
+
+func main() {
+	from := flag.String("from", "", "input format")
+	to := flag.String("to", "", "output format")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: chip16-pal [-from format] [-to format] input output")
+		os.Exit(2)
+	}
+	in, out := flag.Arg(0), flag.Arg(1)
+
+	inFormat, err := format(*from, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outFormat, err := format(*to, out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, err := palette.Read(f, inFormat)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %s", in, err)
+	}
+
+	var w io.WriteCloser = os.Stdout
+	if out != "-" {
+		if w, err = os.Create(out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := palette.Write(w, p, outFormat); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
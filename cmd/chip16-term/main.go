@@ -0,0 +1,211 @@
+// Command chip16-term runs a chip16 ROM in a truecolor terminal.
+//
+// Usage:
+//
+//		chip16-term [-scale n] [-hold frames] [-speed x] [-skip n] [-cheats file] rom.c16
+//
+// Frames are drawn with half block characters, downscaled by -scale (by
+// default, to fit the terminal). The arrow keys are the directional pad,
+// Enter is Start, Space is Select, and Z and X are A and B. P pauses, T
+// toggles turbo mode, and Q or Ctrl-C quits.
+//
+// Tab toggles the memory view, which keeps updating while the ROM runs. The
+// arrow keys move its cursor, hexadecimal digits overwrite the selected
+// bytes, / searches for a byte pattern (hexadecimal bytes such as DE AD, or a
+// double-quoted string) and N finds its next occurrence.
+//
+// Terminals don't report key releases: buttons stay held for -hold frames
+// after each key press, which should be longer than the auto-repeat interval.
+//
+// Cheats are loaded from the -cheats file, or from the ROM's .cht file (e.g.
+// game.cht for game.c16) if there is one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/cheat"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/scheduler"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/term"
+)
+
+// frontend is the terminal UI. Its mutex serializes the emulation and the
+// handling of keys, which may edit memory and redraw while paused.
+type frontend struct {
+	mu     sync.Mutex
+	m      *chip16.Machine
+	s      *scheduler.Scheduler
+	in     *term.Input
+	screen *term.Screen
+	rows   int // rows taken by a frame
+	mem    *memory
+}
+
+func (f *frontend) frame() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.m.SetInput(0, f.in.Frame())
+	return f.m.RunFrame()
+}
+
+func (f *frontend) render() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.draw()
+}
+
+// draw draws the screen or the memory view, and the status line
+func (f *frontend) draw() error {
+	var err error
+	if f.mem.shown {
+		err = f.mem.view.Render(os.Stdout)
+	} else {
+		err = f.screen.Draw(f.m.State().Graphics)
+	}
+	if err != nil {
+		return err
+	}
+	status := "running"
+	if f.s.Paused() {
+		status = "paused"
+	} else if f.s.Turbo() {
+		status = "turbo"
+	}
+	if f.mem.shown {
+		status = "memory " + status
+	}
+	_, err = fmt.Fprintf(os.Stdout, "\x1b[0m\x1b[%d;1H\x1b[K%s  speed %3.0f%%  %2.0f fps  %s",
+		f.rows+1, status, 100*f.s.Speed(), f.s.FPS(), f.mem.status())
+	return err
+}
+
+// readKeys handles the keys typed on stdin, until quit is called
+func (f *frontend) readKeys(quit func()) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			quit()
+			return
+		}
+		f.mu.Lock()
+		for _, k := range term.Decode(buf[:n]) {
+			if f.key(k) {
+				f.mu.Unlock()
+				quit()
+				return
+			}
+		}
+		if f.s.Paused() {
+			// Show edits and pausing right away
+			f.draw()
+		}
+		f.mu.Unlock()
+	}
+}
+
+// key handles a key, and tells whether to quit
+func (f *frontend) key(k term.Key) bool {
+	if k == term.KeyCtrlC {
+		return true
+	}
+	if f.mem.shown && f.mem.prompt != nil {
+		f.mem.key(k)
+		return false
+	}
+	switch k {
+	case 'q', 'Q':
+		return true
+	case 'p', 'P':
+		f.s.SetPaused(!f.s.Paused())
+	case 't', 'T':
+		f.s.SetTurbo(!f.s.Turbo())
+	case term.KeyTab:
+		f.mem.shown = !f.mem.shown
+		if f.mem.shown {
+			fmt.Fprint(os.Stdout, "\x1b[0m\x1b[2J")
+		} else {
+			f.screen.Reset()
+		}
+	default:
+		if f.mem.shown {
+			f.mem.key(k)
+		} else {
+			f.in.Press(k)
+		}
+	}
+	return false
+}
+
+func run(m *chip16.Machine, scale, hold int, speed float64, skip int) error {
+	fd := int(os.Stdin.Fd())
+	if scale == 0 {
+		cols, rows, err := term.Size(int(os.Stdout.Fd()))
+		if err != nil {
+			return err
+		}
+		scale = term.FitScale(cols, rows-1) // Leave room for the status line
+	}
+
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, old)
+
+	screen := term.NewScreen(os.Stdout, scale)
+	if err := screen.Reset(); err != nil {
+		return err
+	}
+	defer screen.Close()
+	_, rows := screen.Size()
+
+	f := &frontend{
+		m:      m,
+		in:     term.NewInput(),
+		screen: screen,
+		rows:   rows,
+		mem:    newMemory(m, rows-1),
+	}
+	f.in.Hold = hold
+	f.s = scheduler.New(f.frame, f.render)
+	f.s.SetSpeed(speed)
+	f.s.MaxSkip = skip
+
+	stop := make(chan struct{})
+	var once sync.Once
+	go f.readKeys(func() { once.Do(func() { close(stop) }) })
+	return f.s.Run(stop)
+}
+
+func main() {
+	scale := flag.Int("scale", 0, "downscaling factor (0 fits the terminal)")
+	hold := flag.Int("hold", term.DefaultHold, "number of frames buttons stay held after a key press")
+	speed := flag.Float64("speed", 1, "emulation speed, relative to real time")
+	skip := flag.Int("skip", 2, "maximum number of consecutive frames left undrawn when running late")
+	cheats := flag.String("cheats", "", "load cheats from this file (default: the ROM's .cht file, if any)")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: chip16-term [-scale n] [-hold frames] [-speed x] [-skip n] [-cheats file] rom.c16")
+		os.Exit(2)
+	}
+
+	m, err := chip16.LoadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := cheat.LoadFor(flag.Arg(0), *cheats)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.SetCheats(l)
+	if err := run(m, *scale, *hold, *speed, *skip); err != nil {
+		log.Fatal(err)
+	}
+}
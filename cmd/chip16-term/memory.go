@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/ArnaudCalmettes/go-chip16/chip16"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/memview"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/term"
+)
+
+// memory is the memory view, toggled with Tab
+type memory struct {
+	view    *memview.View
+	shown   bool
+	prompt  []rune // search being typed, if not nil
+	pattern []byte // last searched pattern
+	msg     string // outcome of the last command
+}
+
+func newMemory(m *chip16.Machine, rows int) *memory {
+	return &memory{view: memview.New(m.State(), m.ROM(), rows)}
+}
+
+// key handles a key pressed in the memory view
+func (mem *memory) key(k term.Key) {
+	if mem.prompt != nil {
+		mem.promptKey(k)
+		return
+	}
+	mem.msg = ""
+	switch k {
+	case term.KeyUp:
+		mem.view.Move(-memview.BytesPerRow)
+	case term.KeyDown:
+		mem.view.Move(memview.BytesPerRow)
+	case term.KeyLeft:
+		mem.view.Move(-1)
+	case term.KeyRight:
+		mem.view.Move(1)
+	case '/':
+		mem.prompt = []rune{}
+	case 'n', 'N':
+		mem.find()
+	default:
+		mem.view.Type(rune(k))
+	}
+}
+
+// promptKey handles a key typed in the search prompt
+func (mem *memory) promptKey(k term.Key) {
+	switch k {
+	case term.KeyEnter:
+		p, err := memview.ParsePattern(string(mem.prompt))
+		mem.prompt = nil
+		if err != nil {
+			mem.msg = err.Error()
+			return
+		}
+		mem.pattern = p
+		mem.find()
+	case term.KeyEscape:
+		mem.prompt = nil
+	case 0x7F, 0x08: // Backspace
+		if n := len(mem.prompt); n > 0 {
+			mem.prompt = mem.prompt[:n-1]
+		}
+	default:
+		if k >= 0x20 && k < 0x7F {
+			mem.prompt = append(mem.prompt, rune(k))
+		}
+	}
+}
+
+func (mem *memory) find() {
+	switch {
+	case mem.pattern == nil:
+		mem.msg = "no search (type /)"
+	case !mem.view.FindNext(mem.pattern):
+		mem.msg = "pattern not found"
+	}
+}
+
+// status returns the search prompt, or the last message
+func (mem *memory) status() string {
+	if !mem.shown {
+		return ""
+	}
+	if mem.prompt != nil {
+		return "/" + string(mem.prompt)
+	}
+	return mem.msg
+}
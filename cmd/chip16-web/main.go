@@ -0,0 +1,176 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command chip16-web runs chip16 ROMs in a web browser.
+//
+// Build it, and serve it along with index.html and the wasm_exec.js of the Go
+// distribution:
+//
+//		GOOS=js GOARCH=wasm go build -o chip16.wasm ./cmd/chip16-web
+//		cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// The page starts a ROM with chip16.run(rom, canvas), where rom is a
+// Uint8Array holding its image. It must be called from a user gesture (e.g.
+// a click) for browsers to allow sound. run returns an error message, or
+// null.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/ArnaudCalmettes/go-chip16/chip16/graphics"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/scheduler"
+	"github.com/ArnaudCalmettes/go-chip16/chip16/web"
+)
+
+// soundBuffer is the number of samples per audio callback
+const soundBuffer = 1024
+
+// The running ROM
+var (
+	emulator *web.Emulator
+	stop     chan struct{}
+	audioCtx js.Value
+	mute     func() // stops the sound
+)
+
+// uint8Array returns a Uint8Array view on the bytes of a typed array
+func uint8Array(a js.Value) js.Value {
+	return js.Global().Get("Uint8Array").New(a.Get("buffer"), a.Get("byteOffset"), a.Get("byteLength"))
+}
+
+func logError(err error) {
+	js.Global().Get("console").Call("error", "chip16: "+err.Error())
+}
+
+// halt stops the running ROM, if any
+func halt() {
+	if emulator == nil {
+		return
+	}
+	close(stop)
+	mute()
+	audioCtx.Call("close")
+	emulator = nil
+}
+
+// playSound plays the emulator's sound on ctx, and returns a function
+// stopping it
+func playSound(ctx js.Value, e *web.Emulator) func() {
+	node := ctx.Call("createScriptProcessor", soundBuffer, 0, 1)
+	buf := make([]byte, 4*soundBuffer)
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		out := args[0].Get("outputBuffer").Call("getChannelData", 0)
+		n := out.Get("length").Int()
+		if len(buf) < 4*n {
+			buf = make([]byte, 4*n)
+		}
+		e.Sound(buf, n)
+		js.CopyBytesToJS(uint8Array(out), buf[:4*n])
+		return nil
+	})
+	node.Set("onaudioprocess", f)
+	node.Call("connect", ctx.Get("destination"))
+	return func() {
+		node.Call("disconnect")
+		node.Set("onaudioprocess", js.Null())
+		f.Release()
+	}
+}
+
+// newRender returns a function drawing the emulator's screen on canvas
+func newRender(canvas js.Value, e *web.Emulator) func() error {
+	canvas.Set("width", graphics.ScreenW)
+	canvas.Set("height", graphics.ScreenH)
+	ctx := canvas.Call("getContext", "2d")
+	img := ctx.Call("createImageData", graphics.ScreenW, graphics.ScreenH)
+	data := uint8Array(img.Get("data"))
+	return func() error {
+		pix, err := e.Pixels()
+		if err != nil {
+			return err
+		}
+		js.CopyBytesToJS(data, pix)
+		ctx.Call("putImageData", img, 0, 0)
+		return nil
+	}
+}
+
+func run(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return "usage: chip16.run(rom, canvas)"
+	}
+	image := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(image, args[0])
+
+	halt()
+	ctx := js.Global().Get("AudioContext").New()
+	e, err := web.NewEmulator(image, ctx.Get("sampleRate").Int())
+	if err != nil {
+		ctx.Call("close")
+		return err.Error()
+	}
+	emulator, stop, audioCtx = e, make(chan struct{}), ctx
+	mute = playSound(ctx, e)
+
+	s := scheduler.New(e.Frame, newRender(args[1], e))
+	s.MaxSkip = 2
+	go func(stop chan struct{}) {
+		if err := s.Run(stop); err != nil {
+			logError(err)
+		}
+	}(stop)
+	return nil
+}
+
+// onKey returns a keyboard event listener
+func onKey(handle func(k *web.Keys, code string) bool) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if emulator != nil && handle(emulator.Keys, args[0].Get("code").String()) {
+			args[0].Call("preventDefault")
+		}
+		return nil
+	})
+}
+
+// listen adds an event listener to target, and returns a function removing
+// it
+func listen(target js.Value, event string, f js.Func) func() {
+	target.Call("addEventListener", event, f)
+	return func() {
+		target.Call("removeEventListener", event, f)
+		f.Release()
+	}
+}
+
+func main() {
+	doc, win := js.Global().Get("document"), js.Global()
+	unload := make(chan struct{})
+	teardown := []func(){
+		listen(doc, "keydown", onKey((*web.Keys).Down)),
+		listen(doc, "keyup", onKey((*web.Keys).Up)),
+		listen(win, "blur", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if emulator != nil {
+				emulator.Keys.Release()
+			}
+			return nil
+		})),
+		listen(win, "unload", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			close(unload)
+			return nil
+		})),
+	}
+
+	runFunc := js.FuncOf(run)
+	win.Set("chip16", js.ValueOf(map[string]interface{}{
+		"run": runFunc,
+	}))
+	<-unload
+
+	halt()
+	win.Delete("chip16")
+	runFunc.Release()
+	for _, f := range teardown {
+		f()
+	}
+}